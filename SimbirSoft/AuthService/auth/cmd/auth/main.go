@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,6 +10,7 @@ import (
 
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/app"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/metrics"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/tracing"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
 )
 
@@ -31,19 +33,34 @@ func main() {
 
 	log.Info("starting app", slog.Any("config", cfg))
 
+	// инициализация трассировки
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, cfg.Env)
+	if err != nil {
+		panic(err)
+	}
+
 	// инициализация приложения
 
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	application := app.New(log, cfg)
 
 	// запустить gRPC сервер
 	go application.GRPCDSrv.MustRun()
 
+	// запустить доставку webhook
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		application.Webhooks.Run(webhooksCtx)
+	}()
+
 	//запускаем сервер по сбору метрик
 	go func() {
-		if err := metrics.Listen("0.0.0.0:8082"); err != nil {
-			log.Error("Failed to start metrics server: %v", err)
+		log.Info("Serving metrics", slog.String("addr", cfg.Metrics.Address+"/metrics"))
+		if err := metrics.Listen(cfg.Metrics.Address); err != nil {
+			log.Error("Failed to start metrics server", slog.String("err", err.Error()))
 		}
-		log.Info("Serving metrics at :8082/metrics")
 	}()
 
 	stop := make(chan os.Signal, 1)
@@ -53,6 +70,13 @@ func main() {
 
 	application.GRPCDSrv.Stop()
 
+	stopWebhooks()
+	<-webhooksDone
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error("failed to flush traces", slog.String("err", err.Error()))
+	}
+
 	log.Info("Gracefully stopped")
 
 }
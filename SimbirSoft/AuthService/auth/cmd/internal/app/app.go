@@ -2,32 +2,62 @@ package app
 
 import (
 	"log/slog"
-	"time"
 
 	grpcapp "gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/app/grpc"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/keyring"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/mailer"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/services/auth"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/webhooks"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
 )
 
 type App struct {
 	GRPCDSrv *grpcapp.App
+	Webhooks *webhooks.Dispatcher
 }
 
-func New(log *slog.Logger, grpcPort int, storagePath string, tokenTTL time.Duration) *App {
+func New(log *slog.Logger, cfg *config.Config) *App {
+	// мастер-ключ для секретов подписи, в prod без него не стартуем
+
+	masterKey, err := keyring.LoadForEnv(log, cfg.Secrets, cfg.Env)
+	if err != nil {
+		panic(err)
+	}
+
 	// инициализация хранилища
 
+	storage, err := postgresql.New(cfg.StoragePath, masterKey)
+	if err != nil {
+		panic(err)
+	}
+
+	// инициализация почты для magic link
+
+	mail, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		panic(err)
+	}
+
 	// инициализация auth
 
-	storage, err := postgresql.New(storagePath)
+	authService := auth.New(log, storage, storage, storage, storage, storage, storage, storage, storage, storage, mail,
+		cfg.TokenTTL, cfg.ImpersonationTTL, cfg.ExchangeTTL, cfg.DefaultRealm, cfg.MagicLink)
+
+	grpcApp, err := grpcapp.New(log, authService, cfg.GRPC.Port, cfg.GRPC.TLS)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, storage, storage, tokenTTL)
+	// доставка событий из outbox во внешние сервисы
 
-	grpcApp := grpcapp.New(log, authService, grpcPort)
+	dispatcher, err := webhooks.New(log, storage, cfg.Webhooks)
+	if err != nil {
+		panic(err)
+	}
 
 	return &App{
 		GRPCDSrv: grpcApp,
+		Webhooks: dispatcher,
 	}
 }
@@ -9,16 +9,29 @@ import (
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	server "gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/grpc"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/tlsconfig"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// Методы, доступ к которым ограничивается списком разрешенных сертификатов
+var subjectRestrictedMethods = map[string]bool{
+	"/auth.Auth/ValidateToken": true,
+	"/auth.Auth/Introspect":    true,
+	"/auth.Auth/TokenExchange": true,
+}
+
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
 	port       int
+	tls        *tlsconfig.Reloader
 }
 
 func unaryInterceptorLogger(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
@@ -36,14 +49,70 @@ func unaryInterceptorLogger(ctx context.Context, req any, info *grpc.UnaryServer
 	return m, err
 }
 
-func New(log *slog.Logger, authService server.Auth, port int) *App {
-	// Объединяем перехватчики в один с помощью ChainUnaryInterceptor
-	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			unaryInterceptorLogger,                 // перехватчик для логгирования
-			grpc_prometheus.UnaryServerInterceptor, // перехватчик для метрик Prometheus
-		),
-	)
+// subjectAllowListInterceptor пропускает вызовы ограниченных методов только от клиентов,
+// предъявивших проверенный сертификат с разрешенным subject (полный DN или CN)
+func subjectAllowListInterceptor(allowed []string) grpc.UnaryServerInterceptor {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, subject := range allowed {
+		allowedSet[subject] = true
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !subjectRestrictedMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "peer certificate is required")
+		}
+
+		tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+			return nil, status.Error(codes.PermissionDenied, "peer certificate is required")
+		}
+
+		subject := tlsInfo.State.VerifiedChains[0][0].Subject
+		if !allowedSet[subject.String()] && !allowedSet[subject.CommonName] {
+			return nil, status.Error(codes.PermissionDenied, "peer is not allowed to call this method")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func New(log *slog.Logger, authService server.Auth, port int, tlsCfg config.TLSConfig) (*App, error) {
+	const op = "grpcapp.New"
+
+	interceptors := []grpc.UnaryServerInterceptor{
+		unaryInterceptorLogger,                 // перехватчик для логгирования
+		grpc_prometheus.UnaryServerInterceptor, // перехватчик для метрик Prometheus
+	}
+
+	if len(tlsCfg.ValidateTokenAllowedSubjects) > 0 {
+		if !tlsCfg.Enabled {
+			log.Warn("validate token allow-list is set but TLS is disabled, restricted methods will be rejected")
+		}
+		interceptors = append(interceptors, subjectAllowListInterceptor(tlsCfg.ValidateTokenAllowedSubjects))
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()), // трассировка входящих запросов
+		grpc.ChainUnaryInterceptor(interceptors...),    // объединяем перехватчики в один
+	}
+
+	var reloader *tlsconfig.Reloader
+	if tlsCfg.Enabled {
+		var err error
+		reloader, err = tlsconfig.NewReloader(log, tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile, tlsCfg.ReloadInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(tlsCfg.RequireClientCert))))
+	}
+
+	grpcServer := grpc.NewServer(opts...)
 
 	// Регистрируем метрики
 	grpc_prometheus.Register(grpcServer)
@@ -56,7 +125,8 @@ func New(log *slog.Logger, authService server.Auth, port int) *App {
 		log:        log,
 		gRPCServer: grpcServer,
 		port:       port,
-	}
+		tls:        reloader,
+	}, nil
 }
 
 // MustRun runs gRPC server and panics if any error occurs.
@@ -93,6 +163,10 @@ func (a *App) Stop() {
 		Info("stopping gRPC server")
 
 	a.gRPCServer.GracefulStop()
+
+	if a.tls != nil {
+		a.tls.Close()
+	}
 }
 
 func logger(format string, a ...any) {
@@ -2,30 +2,88 @@ package server
 
 import (
 	"context"
+	"net/url"
 	"strings"
+	"time"
 
 	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 type Auth interface {
 	Login(
 		ctx context.Context,
+		realm string,
+		appID int64,
 		email string,
 		password string,
-		idSec int,
+		client models.ClientContext,
+		audience []string,
+		scope []string,
 	) (token string, err error)
 	RegisterNewUser(
 		ctx context.Context,
+		realm string,
 		email string,
 		password string,
 	) (statusMsg string, err error)
-	Logout(ctx context.Context, token string) (invalidToken string, err error)
-	ValidateToken(ctx context.Context, token string, idSec int) (id int, err error)
+	Logout(ctx context.Context, realm string, token string) (invalidToken string, err error)
+	ValidateToken(
+		ctx context.Context,
+		realm string,
+		appID int64,
+		token string,
+		client models.ClientContext,
+		audience string,
+		scopes []string,
+	) (models.Identity, error)
+	Introspect(ctx context.Context, realm string, token string) (models.Introspection, error)
+	RequestMagicLink(ctx context.Context, realm string, appID int64, email string, redirectURL string) error
+	ConsumeMagicLink(ctx context.Context, realm string, token string, client models.ClientContext) (authToken string, err error)
+	Impersonate(
+		ctx context.Context,
+		realm string,
+		adminToken string,
+		appID int64,
+		targetID int64,
+		reason string,
+		client models.ClientContext,
+	) (token string, expiresAt time.Time, err error)
+	TokenExchange(
+		ctx context.Context,
+		realm string,
+		subjectToken string,
+		client models.ClientContext,
+		audience []string,
+		scope []string,
+	) (models.ExchangedToken, error)
+	CreateApp(ctx context.Context, realm string, adminToken string, app models.App) (models.App, error)
+	UpdateApp(ctx context.Context, realm string, adminToken string, app models.App) (models.App, error)
+	ListApps(ctx context.Context, realm string, adminToken string) ([]models.App, error)
+	ListDeliveries(ctx context.Context, realm string, adminToken string, status string, limit int) ([]models.Delivery, error)
+	ReplayDelivery(ctx context.Context, realm string, adminToken string, id int64) error
 }
 
+// realmMetadataKey selects the realm of requests without the realm field
+const realmMetadataKey = "x-realm"
+
+// Типы токенов RFC 8693, других токенов auth не выдает
+const (
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	tokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Контекст клиента для привязки токена, если в запросе нет поля client
+const (
+	forwardedForMetadataKey = "x-forwarded-for"
+	userAgentMetadataKey    = "user-agent"
+)
+
 type serverAPI struct {
 	api.UnimplementedAuthServer
 	auth Auth
@@ -40,9 +98,24 @@ func (s *serverAPI) Login(ctx context.Context, req *api.LoginRequest) (*api.Logi
 		return nil, err
 	}
 
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), 1) //TODO: Здесь заглушка тип 1 секрет выбираем ибо протошник надо менять
+	token, err := s.auth.Login(ctx, realmFromRequest(ctx, req.GetRealm()), req.GetAppId(), req.GetEmail(), req.GetPassword(),
+		clientFromRequest(ctx, req.GetClient()), req.GetAudience(), strings.Fields(req.GetScope()))
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid credentials") {
+		if strings.Contains(err.Error(), "client context required") {
+			return nil, status.Error(codes.InvalidArgument, "client context required by the app binding")
+		} else if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		} else if strings.Contains(err.Error(), "unknown app") {
+			return nil, status.Error(codes.InvalidArgument, "unknown app")
+		} else if strings.Contains(err.Error(), "app is disabled") {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		} else if strings.Contains(err.Error(), "user is disabled") {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		} else if strings.Contains(err.Error(), "unknown scope") {
+			return nil, status.Error(codes.InvalidArgument, "unknown scope")
+		} else if strings.Contains(err.Error(), "scope requires the admin role") {
+			return nil, status.Error(codes.PermissionDenied, "scope requires the admin role")
+		} else if strings.Contains(err.Error(), "invalid credentials") {
 			return nil, status.Errorf(codes.InvalidArgument, "Wrong email or password")
 		} else if strings.Contains(err.Error(), "no rows in result set") {
 			return nil, status.Errorf(codes.InvalidArgument, "Wrong email or password")
@@ -62,11 +135,18 @@ func (s *serverAPI) Register(ctx context.Context, req *api.RegisterRequest) (*ap
 		return nil, err
 	}
 
-	statusMsg, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
+	statusMsg, err := s.auth.RegisterNewUser(ctx, realmFromRequest(ctx, req.GetRealm()), req.GetEmail(), req.GetPassword())
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key value") {
 			return nil, status.Errorf(codes.AlreadyExists, "user already exists")
 		}
+		if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+		// причина отказа из политики realm понятна пользователю, ее и возвращаем
+		if i := strings.Index(err.Error(), "weak password"); i >= 0 {
+			return nil, status.Error(codes.InvalidArgument, err.Error()[i:])
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
@@ -80,8 +160,12 @@ func (s *serverAPI) Logout(ctx context.Context, req *api.LogoutRequest) (*api.Lo
 		return nil, err
 	}
 
-	invalidToken, err := s.auth.Logout(ctx, req.GetToken())
+	invalidToken, err := s.auth.Logout(ctx, realmFromRequest(ctx, ""), req.GetToken())
 	if err != nil {
+		if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
@@ -91,17 +175,384 @@ func (s *serverAPI) Logout(ctx context.Context, req *api.LogoutRequest) (*api.Lo
 }
 
 func (s *serverAPI) ValidateToken(ctx context.Context, req *api.ValidateTokenRequest) (*api.ValidateTokenResponse, error) {
+	if err := validateScope(req.GetScopes()); err != nil {
+		return nil, err
+	}
+
+	// контекст клиента здесь только из поля: вызывающий - сервис, а не клиент, которому выдан токен
+	client := models.ClientContext{
+		IP:            req.GetClient().GetIp(),
+		UserAgent:     req.GetClient().GetUserAgent(),
+		KeyThumbprint: req.GetClient().GetKeyThumbprint(),
+	}
 
-	id, err := s.auth.ValidateToken(ctx, req.GetToken(), 1)
+	identity, err := s.auth.ValidateToken(ctx, realmFromRequest(ctx, req.GetRealm()), req.GetAppId(), req.GetToken(), client,
+		req.GetAudience(), req.GetScopes())
 	if err != nil {
-		return nil, status.Error(codes.PermissionDenied, "invalid token")
+		if strings.Contains(err.Error(), "insufficient scope") {
+			return nil, status.Error(codes.PermissionDenied, "insufficient scope")
+		}
+		if strings.Contains(err.Error(), "invalid token") {
+			return nil, status.Error(codes.PermissionDenied, "invalid token")
+		}
+		if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
 	}
 
 	return &api.ValidateTokenResponse{
-		Id: int64(id),
+		Id:      identity.UserID,
+		ActorId: identity.ActorID,
+		Scope:   strings.Join(identity.Scopes, " "),
+	}, nil
+}
+
+func (s *serverAPI) Introspect(ctx context.Context, req *api.IntrospectRequest) (*api.IntrospectResponse, error) {
+	info, err := s.auth.Introspect(ctx, realmFromRequest(ctx, req.GetRealm()), req.GetToken())
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if !info.Active {
+		return &api.IntrospectResponse{Active: false}, nil
+	}
+
+	var act *api.Actor
+	if info.Actor != "" {
+		act = &api.Actor{Sub: info.Actor}
+	}
+
+	return &api.IntrospectResponse{
+		Active:   true,
+		Sub:      info.Subject,
+		Email:    info.Email,
+		Exp:      info.ExpiresAt.Unix(),
+		Iat:      info.IssuedAt.Unix(),
+		Jti:      info.JTI,
+		Scope:    info.Scope,
+		Aud:      info.Audience,
+		ClientId: info.ClientID,
+		Act:      act,
+		Iss:      info.Issuer,
 	}, nil
 }
 
+func (s *serverAPI) RequestMagicLink(ctx context.Context, req *api.RequestMagicLinkRequest) (*api.RequestMagicLinkResponse, error) {
+	if err := validateRequestMagicLink(req); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RequestMagicLink(ctx, realmFromRequest(ctx, ""), req.GetAppId(), req.GetEmail(), req.GetRedirectUrl()); err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unknown realm"):
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		case strings.Contains(err.Error(), "unknown app"):
+			return nil, status.Error(codes.InvalidArgument, "unknown app")
+		case strings.Contains(err.Error(), "app is disabled"):
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		case strings.Contains(err.Error(), "redirect url is not allowed"):
+			return nil, status.Error(codes.InvalidArgument, "redirect url is not allowed")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &api.RequestMagicLinkResponse{}, nil
+}
+
+func (s *serverAPI) ConsumeMagicLink(ctx context.Context, req *api.ConsumeMagicLinkRequest) (*api.ConsumeMagicLinkResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	token, err := s.auth.ConsumeMagicLink(ctx, realmFromRequest(ctx, ""), req.GetToken(), clientFromRequest(ctx, req.GetClient()))
+	if err != nil {
+		if strings.Contains(err.Error(), "client context required") {
+			return nil, status.Error(codes.InvalidArgument, "client context required by the app binding")
+		}
+		if strings.Contains(err.Error(), "invalid or expired magic link") {
+			return nil, status.Error(codes.PermissionDenied, "invalid or expired magic link")
+		}
+		if strings.Contains(err.Error(), "unknown app") || strings.Contains(err.Error(), "app is disabled") {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		if strings.Contains(err.Error(), "unknown realm") {
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &api.ConsumeMagicLinkResponse{
+		Token: token,
+	}, nil
+}
+
+func (s *serverAPI) Impersonate(ctx context.Context, req *api.ImpersonateRequest) (*api.ImpersonateResponse, error) {
+	if err := validateImpersonate(req); err != nil {
+		return nil, err
+	}
+
+	token, expiresAt, err := s.auth.Impersonate(ctx, realmFromRequest(ctx, ""), req.GetToken(), req.GetAppId(),
+		req.GetTargetUserId(), req.GetReason(), clientFromRequest(ctx, req.GetClient()))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "invalid token"):
+			// токен администратора, в том числе отключенного
+			return nil, adminError(err)
+		case strings.Contains(err.Error(), "target user not found"):
+			return nil, status.Error(codes.NotFound, "user not found")
+		case strings.Contains(err.Error(), "user is disabled"):
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		case strings.Contains(err.Error(), "client context required"):
+			return nil, status.Error(codes.InvalidArgument, "client context required by the app binding")
+		case strings.Contains(err.Error(), "unknown app"):
+			return nil, status.Error(codes.InvalidArgument, "unknown app")
+		case strings.Contains(err.Error(), "app is disabled"):
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+
+		return nil, adminError(err)
+	}
+
+	return &api.ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+func (s *serverAPI) TokenExchange(ctx context.Context, req *api.TokenExchangeRequest) (*api.TokenExchangeResponse, error) {
+	if err := validateTokenExchange(req); err != nil {
+		return nil, err
+	}
+
+	// контекст клиента только из поля, как в ValidateToken: обмен запрашивает сервис
+	client := models.ClientContext{
+		IP:            req.GetClient().GetIp(),
+		UserAgent:     req.GetClient().GetUserAgent(),
+		KeyThumbprint: req.GetClient().GetKeyThumbprint(),
+	}
+
+	exchanged, err := s.auth.TokenExchange(ctx, realmFromRequest(ctx, req.GetRealm()), req.GetSubjectToken(), client,
+		req.GetAudience(), strings.Fields(req.GetScope()))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "insufficient scope"):
+			return nil, status.Error(codes.PermissionDenied, "insufficient scope")
+		case strings.Contains(err.Error(), "invalid token"), strings.Contains(err.Error(), "user is disabled"):
+			return nil, status.Error(codes.PermissionDenied, "invalid token")
+		case strings.Contains(err.Error(), "unknown realm"):
+			return nil, status.Error(codes.InvalidArgument, "unknown realm")
+		}
+
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &api.TokenExchangeResponse{
+		AccessToken:     exchanged.Token,
+		IssuedTokenType: tokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(exchanged.ExpiresAt).Round(time.Second) / time.Second),
+		Scope:           strings.Join(exchanged.Scopes, " "),
+	}, nil
+}
+
+func (s *serverAPI) CreateApp(ctx context.Context, req *api.CreateAppRequest) (*api.CreateAppResponse, error) {
+	if err := validateCreateApp(req); err != nil {
+		return nil, err
+	}
+
+	app, err := s.auth.CreateApp(ctx, realmFromRequest(ctx, ""), req.GetToken(), models.App{
+		Name:            req.GetName(),
+		RedirectOrigins: req.GetRedirectOrigins(),
+		TokenTTL:        time.Duration(req.GetTokenTtlSeconds()) * time.Second,
+		Binding:         req.GetBinding(),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "app already exists") {
+			return nil, status.Error(codes.AlreadyExists, "app already exists")
+		}
+
+		return nil, adminError(err)
+	}
+
+	return &api.CreateAppResponse{App: appToProto(app)}, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *api.UpdateAppRequest) (*api.UpdateAppResponse, error) {
+	if err := validateUpdateApp(req); err != nil {
+		return nil, err
+	}
+
+	app, err := s.auth.UpdateApp(ctx, realmFromRequest(ctx, ""), req.GetToken(), models.App{
+		ID:              req.GetAppId(),
+		RedirectOrigins: req.GetRedirectOrigins(),
+		TokenTTL:        time.Duration(req.GetTokenTtlSeconds()) * time.Second,
+		Binding:         req.GetBinding(),
+		Enabled:         req.GetEnabled(),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown app") {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+
+		return nil, adminError(err)
+	}
+
+	return &api.UpdateAppResponse{App: appToProto(app)}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *api.ListAppsRequest) (*api.ListAppsResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	apps, err := s.auth.ListApps(ctx, realmFromRequest(ctx, ""), req.GetToken())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := &api.ListAppsResponse{Apps: make([]*api.App, 0, len(apps))}
+	for _, app := range apps {
+		resp.Apps = append(resp.Apps, appToProto(app))
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListWebhookDeliveries(ctx context.Context, req *api.ListWebhookDeliveriesRequest) (*api.ListWebhookDeliveriesResponse, error) {
+	if err := validateListWebhookDeliveries(req); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.auth.ListDeliveries(ctx, realmFromRequest(ctx, ""), req.GetToken(), req.GetStatus(), int(req.GetLimit()))
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	resp := &api.ListWebhookDeliveriesResponse{Deliveries: make([]*api.WebhookDelivery, 0, len(deliveries))}
+	for _, d := range deliveries {
+		var deliveredAt int64
+		if !d.DeliveredAt.IsZero() {
+			deliveredAt = d.DeliveredAt.Unix()
+		}
+
+		resp.Deliveries = append(resp.Deliveries, &api.WebhookDelivery{
+			Id:            d.ID,
+			EventId:       d.Event.ID,
+			EventType:     d.Event.Type,
+			UserId:        d.Event.UserID,
+			Endpoint:      d.Endpoint,
+			Status:        d.Status,
+			Attempts:      int32(d.Attempts),
+			NextAttemptAt: d.NextAttemptAt.Unix(),
+			LastError:     d.LastError,
+			CreatedAt:     d.CreatedAt.Unix(),
+			DeliveredAt:   deliveredAt,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ReplayWebhookDelivery(ctx context.Context, req *api.ReplayWebhookDeliveryRequest) (*api.ReplayWebhookDeliveryResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	if req.GetDeliveryId() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "delivery_id is required")
+	}
+
+	if err := s.auth.ReplayDelivery(ctx, realmFromRequest(ctx, ""), req.GetToken(), req.GetDeliveryId()); err != nil {
+		if strings.Contains(err.Error(), "webhook delivery not found") {
+			return nil, status.Error(codes.NotFound, "webhook delivery not found")
+		}
+
+		return nil, adminError(err)
+	}
+
+	return &api.ReplayWebhookDeliveryResponse{}, nil
+}
+
+// adminError maps the errors common to admin calls, see Auth.requireAdmin.
+func adminError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), "unknown realm"):
+		return status.Error(codes.InvalidArgument, "unknown realm")
+	case strings.Contains(err.Error(), "invalid token"):
+		return status.Error(codes.Unauthenticated, "invalid token")
+	case strings.Contains(err.Error(), "admin role required"),
+		strings.Contains(err.Error(), "impersonation token can't be used for admin actions"):
+		return status.Error(codes.PermissionDenied, "admin role required")
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+func appToProto(app models.App) *api.App {
+	return &api.App{
+		Id:              app.ID,
+		Name:            app.Name,
+		RedirectOrigins: app.RedirectOrigins,
+		TokenTtlSeconds: int64(app.TokenTTL / time.Second),
+		Binding:         app.Binding,
+		Enabled:         app.Enabled,
+		CreatedAt:       app.CreatedAt.Unix(),
+	}
+}
+
+// realmFromRequest returns the realm field if set, otherwise the x-realm metadata.
+// An empty result means the default realm.
+func realmFromRequest(ctx context.Context, field string) string {
+	if field != "" {
+		return field
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(realmMetadataKey); len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+// clientFromRequest returns the client field of the request, its empty parts are taken from
+// the x-forwarded-for (the first address) and user-agent metadata and the peer address.
+func clientFromRequest(ctx context.Context, field *api.ClientContext) models.ClientContext {
+	client := models.ClientContext{
+		IP:            field.GetIp(),
+		UserAgent:     field.GetUserAgent(),
+		KeyThumbprint: field.GetKeyThumbprint(),
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if client.IP == "" {
+		if v := md.Get(forwardedForMetadataKey); len(v) > 0 {
+			first, _, _ := strings.Cut(v[0], ",")
+			client.IP = strings.TrimSpace(first)
+		} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			client.IP = p.Addr.String()
+		}
+	}
+
+	if client.UserAgent == "" {
+		if v := md.Get(userAgentMetadataKey); len(v) > 0 {
+			client.UserAgent = v[0]
+		}
+	}
+
+	return client
+}
+
 func validateLogin(req *api.LoginRequest) error {
 	if req.GetEmail() == "" {
 		return status.Errorf(codes.InvalidArgument, "email is required")
@@ -114,9 +565,61 @@ func validateLogin(req *api.LoginRequest) error {
 	if req.GetPassword() == "" {
 		return status.Errorf(codes.InvalidArgument, "password is required")
 	}
-	if len(req.GetPassword()) <= 4 {
-		return status.Errorf(codes.InvalidArgument, "password should be bigger than 4 letters")
+
+	if err := validateAudience(req.GetAudience()); err != nil {
+		return err
+	}
+	if err := validateScope(strings.Fields(req.GetScope())); err != nil {
+		return err
 	}
+	// длина и сложность пароля проверяются политикой realm
+	return nil
+}
+
+func validateTokenExchange(req *api.TokenExchangeRequest) error {
+	if req.GetSubjectToken() == "" {
+		return status.Errorf(codes.InvalidArgument, "subject_token is required")
+	}
+
+	switch req.GetSubjectTokenType() {
+	case "", tokenTypeAccessToken, tokenTypeJWT:
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported subject_token_type")
+	}
+
+	if len(req.GetAudience()) == 0 {
+		return status.Errorf(codes.InvalidArgument, "audience is required")
+	}
+	if err := validateAudience(req.GetAudience()); err != nil {
+		return err
+	}
+
+	scope := strings.Fields(req.GetScope())
+	if len(scope) == 0 {
+		return status.Errorf(codes.InvalidArgument, "scope is required")
+	}
+
+	return validateScope(scope)
+}
+
+func validateAudience(audience []string) error {
+	for _, aud := range audience {
+		if aud == "" || strings.ContainsAny(aud, " \t\n") {
+			return status.Errorf(codes.InvalidArgument, "audience %q must be a non-empty name without spaces", aud)
+		}
+	}
+
+	return nil
+}
+
+// validateScope checks the scope tokens of RFC 6749: printable ASCII except space, '"' and backslash.
+func validateScope(scopes []string) error {
+	for _, scope := range scopes {
+		if scope == "" || strings.IndexFunc(scope, func(r rune) bool { return r < 0x21 || r > 0x7e || r == '"' || r == '\\' }) >= 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid scope %q", scope)
+		}
+	}
+
 	return nil
 }
 
@@ -132,9 +635,101 @@ func validateRegister(req *api.RegisterRequest) error {
 	if req.GetPassword() == "" {
 		return status.Errorf(codes.InvalidArgument, "password is required")
 	}
-	if len(req.GetPassword()) <= 4 {
-		return status.Errorf(codes.InvalidArgument, "password should be bigger than 4 letters")
+	// длина и сложность пароля проверяются политикой realm
+	return nil
+}
+
+func validateRequestMagicLink(req *api.RequestMagicLinkRequest) error {
+	if req.GetEmail() == "" {
+		return status.Errorf(codes.InvalidArgument, "email is required")
+	}
+
+	if !strings.Contains(req.GetEmail(), "@") {
+		return status.Errorf(codes.InvalidArgument, "incorrect email")
 	}
+
+	return nil
+}
+
+func validateImpersonate(req *api.ImpersonateRequest) error {
+	if req.GetToken() == "" {
+		return status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	if req.GetTargetUserId() <= 0 {
+		return status.Errorf(codes.InvalidArgument, "target_user_id is required")
+	}
+
+	if strings.TrimSpace(req.GetReason()) == "" {
+		return status.Errorf(codes.InvalidArgument, "reason is required")
+	}
+
+	return nil
+}
+
+func validateCreateApp(req *api.CreateAppRequest) error {
+	if req.GetToken() == "" {
+		return status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	if strings.TrimSpace(req.GetName()) == "" {
+		return status.Errorf(codes.InvalidArgument, "name is required")
+	}
+
+	return validateAppSettings(req.GetRedirectOrigins(), req.GetTokenTtlSeconds(), req.GetBinding())
+}
+
+func validateUpdateApp(req *api.UpdateAppRequest) error {
+	if req.GetToken() == "" {
+		return status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	if req.GetAppId() <= 0 {
+		return status.Errorf(codes.InvalidArgument, "app_id is required")
+	}
+
+	return validateAppSettings(req.GetRedirectOrigins(), req.GetTokenTtlSeconds(), req.GetBinding())
+}
+
+// validateAppSettings: redirect origins are compared with the origin of redirect URLs as strings,
+// so only the exact scheme://host[:port] form is accepted.
+func validateAppSettings(origins []string, ttlSeconds int64, binding string) error {
+	if ttlSeconds < 0 {
+		return status.Errorf(codes.InvalidArgument, "token_ttl_seconds can't be negative")
+	}
+
+	switch binding {
+	case "", models.BindingNone, models.BindingIP, models.BindingUserAgent, models.BindingIPUserAgent, models.BindingKey:
+	default:
+		return status.Errorf(codes.InvalidArgument, "binding must be none, ip, user_agent, ip_user_agent or key")
+	}
+
+	for _, origin := range origins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Scheme+"://"+u.Host != origin {
+			return status.Errorf(codes.InvalidArgument, "redirect origin %q must be scheme://host[:port]", origin)
+		}
+	}
+
+	return nil
+}
+
+func validateListWebhookDeliveries(req *api.ListWebhookDeliveriesRequest) error {
+	if req.GetToken() == "" {
+		return status.Errorf(codes.InvalidArgument, "Token is missed")
+	}
+
+	switch req.GetStatus() {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return status.Errorf(codes.InvalidArgument, "status must be pending, delivered or dead")
+	}
+
+	if req.GetLimit() < 0 {
+		return status.Errorf(codes.InvalidArgument, "limit can't be negative")
+	}
+
 	return nil
 }
 
@@ -1,25 +1,110 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	models "gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
 )
 
+var ErrNoKeyID = errors.New("token has no key id")
+
+// Способы входа, попадают в claim amr (RFC 8176) и в журнал аудита
+const (
+	MethodPassword  = "pwd"
+	MethodMagicLink = "magic_link"
+)
+
+// MyClaims: sub - ID пользователя, iss - realm, aud - realm и сервисы, для которых выдан токен,
+// scope - разрешения через пробел (RFC 8693), kid в заголовке - ID секрета, которым подписан токен,
+// app_id - приложение, для которого выдан токен (его секретом токен и подписан),
+// cnf - к какому клиенту привязан токен приложения
 type MyClaims struct {
 	jwt.RegisteredClaims
-	Email string `json:"email"`
+	Email string        `json:"email"`
+	Scope string        `json:"scope,omitempty"`
+	AMR   []string      `json:"amr,omitempty"`
+	Act   *Actor        `json:"act,omitempty"`
+	AppID int64         `json:"app_id,omitempty"`
+	Cnf   *Confirmation `json:"cnf,omitempty"`
+}
+
+// tokenOptions are the optional claims of a new token.
+type tokenOptions struct {
+	amr      []string
+	act      *Actor
+	audience []string // besides the realm
+	scope    []string
+	cnf      *Confirmation
+}
+
+// Confirmation is the RFC 7800 cnf claim. jkt is the thumbprint of the client key as in
+// DPoP (RFC 9449), ctx is our own member: a hash of the client subnet and/or user agent.
+type Confirmation struct {
+	JKT     string `json:"jkt,omitempty"`
+	Context string `json:"ctx,omitempty"`
+}
+
+// Actor is the RFC 8693 act claim: who acts on behalf of the subject.
+type Actor struct {
+	Subject string `json:"sub"`
 }
 
-// NewToken creates new JWT token for given user.
-func NewToken(user models.User, secret models.Secret, duration time.Duration) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+// NewToken creates new JWT token for given user of the realm, method is how the user authenticated.
+// The token is also issued for the audience services and limited to the scope if they are not empty.
+// A token signed with a secret of an app is issued for that app, cnf binds it to the client if not nil.
+func NewToken(user models.User, realm string, secret models.Secret, duration time.Duration, method string,
+	audience []string, scope []string, cnf *Confirmation) (string, error) {
+	return newToken(user, realm, secret, duration, tokenOptions{amr: []string{method}, audience: audience, scope: scope, cnf: cnf})
+}
 
-	claims := token.Claims.(jwt.MapClaims)
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
+// NewImpersonationToken creates a token for the user with the admin as the actor.
+// Like NewToken, a secret of an app issues it for that app and cnf binds it to the client.
+func NewImpersonationToken(user models.User, realm string, adminID int64, secret models.Secret, duration time.Duration,
+	cnf *Confirmation) (string, error) {
+	return newToken(user, realm, secret, duration, tokenOptions{act: &Actor{Subject: strconv.FormatInt(adminID, 10)}, cnf: cnf})
+}
+
+// NewExchangedToken creates a token for the subject of another token (RFC 8693) with the new audience
+// and scope. The actor, the authentication methods and the client binding of the subject token are kept,
+// the secret must be of the app of the subject token.
+func NewExchangedToken(user models.User, realm string, secret models.Secret, duration time.Duration, subject *MyClaims,
+	audience []string, scope []string) (string, error) {
+	return newToken(user, realm, secret, duration,
+		tokenOptions{amr: subject.AMR, act: subject.Act, audience: audience, scope: scope, cnf: subject.Cnf})
+}
+
+func newToken(user models.User, realm string, secret models.Secret, duration time.Duration, opts tokenOptions) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, MyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    realm,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  append(jwt.ClaimStrings{realm}, opts.audience...),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			ID:        jti,
+		},
+		Email: user.Email,
+		Scope: strings.Join(opts.scope, " "),
+		AMR:   opts.amr,
+		Act:   opts.act,
+		AppID: secret.AppID,
+		Cnf:   opts.cnf,
+	})
+	token.Header["kid"] = strconv.FormatInt(secret.ID, 10)
 
 	tokenString, err := token.SignedString([]byte(secret.Secret))
 	if err != nil {
@@ -29,7 +114,24 @@ func NewToken(user models.User, secret models.Secret, duration time.Duration) (s
 	return tokenString, nil
 }
 
-func ValidateToken(accessToken string, secret models.Secret) (payload *MyClaims, err error) {
+// KeyID returns ID of the secret the token claims to be signed with.
+// The signature is not checked, use ValidateToken with the secret afterwards.
+func KeyID(accessToken string) (int, error) {
+	parsedToken, _, err := jwt.NewParser().ParseUnverified(accessToken, &MyClaims{})
+	if err != nil {
+		return 0, err
+	}
+
+	kid, ok := parsedToken.Header["kid"].(string)
+	if !ok {
+		return 0, ErrNoKeyID
+	}
+
+	return strconv.Atoi(kid)
+}
+
+// ValidateToken checks the signature, the expiry and that the token was issued in the realm.
+func ValidateToken(accessToken string, secret models.Secret, realm string) (payload *MyClaims, err error) {
 
 	claims := &MyClaims{}
 
@@ -38,7 +140,7 @@ func ValidateToken(accessToken string, secret models.Secret) (payload *MyClaims,
 			return nil, errors.New("invalid signing method")
 		}
 		return []byte(secret.Secret), nil
-	})
+	}, jwt.WithExpirationRequired(), jwt.WithIssuer(realm), jwt.WithAudience(realm))
 	if err != nil {
 		return nil, err
 	}
@@ -49,3 +151,44 @@ func ValidateToken(accessToken string, secret models.Secret) (payload *MyClaims,
 
 	return claims, nil
 }
+
+// UserID returns the subject as user ID.
+func (c *MyClaims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// Scopes returns the scope claim as a list, empty if the token is not limited to a scope.
+func (c *MyClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScopes reports whether the token is granted all the scopes. A token without
+// the scope claim has none of them.
+func (c *MyClaims) HasScopes(scopes []string) bool {
+	granted := c.Scopes()
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ActorID returns ID of the admin acting as the user, 0 if there is no act claim.
+func (c *MyClaims) ActorID() (int64, error) {
+	if c.Act == nil {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(c.Act.Subject, 10, 64)
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,246 @@
+// Package keyring implements envelope encryption of signing secrets.
+//
+// Every secret is encrypted with its own random data key (AES-256-GCM) and the
+// data key is encrypted with the master key. Changing the master key only
+// re-wraps the data keys, the secrets themselves stay the same. Both are bound to
+// the ID of the secret, so a ciphertext copied into another row does not decrypt.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+const KeySize = 32
+
+const envLocal = "local"
+
+var (
+	ErrNoMasterKey    = errors.New("master key is not configured")
+	ErrWrongMasterKey = errors.New("secret is encrypted with another master key")
+	ErrInvalidKeySize = fmt.Errorf("master key must be %d bytes", KeySize)
+)
+
+// devKey is used only in the local environment when no master key is configured,
+// so that a local checkout runs without any setup. It is derived from a string in
+// the repository and protects nothing.
+var devKey = sha256.Sum256([]byte("auth local development master key"))
+
+// MasterKey wraps and unwraps data keys.
+type MasterKey struct {
+	aead cipher.AEAD
+	id   string
+}
+
+// Sealed is an encrypted secret as it is stored in the database.
+type Sealed struct {
+	Ciphertext []byte // nonce || AES-GCM(data key, secret)
+	WrappedKey []byte // nonce || AES-GCM(master key, data key)
+	KeyID      string // ID of the master key that wrapped the data key
+}
+
+func New(key []byte) (*MasterKey, error) {
+	const op = "keyring.New"
+
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidKeySize)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sum := sha256.Sum256(key)
+
+	return &MasterKey{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// Load reads the base64 encoded master key from the config, the environment
+// variable wins over the file. Returns ErrNoMasterKey if neither is set.
+func Load(cfg config.SecretsConfig) (*MasterKey, error) {
+	const op = "keyring.Load"
+
+	encoded := cfg.MasterKey
+	if encoded == "" && cfg.MasterKeyFile != "" {
+		b, err := os.ReadFile(cfg.MasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		encoded = string(b)
+	}
+
+	if encoded == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoMasterKey)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%s: master key is not valid base64: %w", op, err)
+	}
+
+	return New(key)
+}
+
+// LoadForEnv is Load that falls back to a built-in development key in the local environment.
+// In any other environment, including a misspelled one, a missing master key is an error.
+func LoadForEnv(log *slog.Logger, cfg config.SecretsConfig, env string) (*MasterKey, error) {
+	key, err := Load(cfg)
+	if errors.Is(err, ErrNoMasterKey) && env == envLocal {
+		log.Warn("master key is not configured, using the development key; never do this outside of local")
+
+		return New(devKey[:])
+	}
+
+	return key, err
+}
+
+// GenerateKey returns a new base64 encoded master key.
+func GenerateKey() (string, error) {
+	key, err := randomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ID identifies the master key without revealing it.
+func (k *MasterKey) ID() string {
+	return k.id
+}
+
+// Seal encrypts the secret with a new data key and wraps the data key.
+// secretID is the ID of the row the secret is stored in.
+func (k *MasterKey) Seal(secretID int64, secret []byte) (Sealed, error) {
+	const op = "keyring.Seal"
+
+	dataKey, err := randomBytes(KeySize)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ad := additionalData(secretID)
+
+	ciphertext, err := seal(dataAEAD, secret, ad)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	wrapped, err := seal(k.aead, dataKey, ad)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Sealed{Ciphertext: ciphertext, WrappedKey: wrapped, KeyID: k.id}, nil
+}
+
+// Open unwraps the data key and decrypts the secret of the row secretID.
+func (k *MasterKey) Open(secretID int64, s Sealed) ([]byte, error) {
+	const op = "keyring.Open"
+
+	ad := additionalData(secretID)
+
+	dataKey, err := k.unwrap(s, ad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := open(dataAEAD, s.Ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return secret, nil
+}
+
+// Rewrap re-encrypts the data key of the secret secretID under another master key.
+func (k *MasterKey) Rewrap(secretID int64, s Sealed, to *MasterKey) (Sealed, error) {
+	const op = "keyring.Rewrap"
+
+	ad := additionalData(secretID)
+
+	dataKey, err := k.unwrap(s, ad)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	wrapped, err := seal(to.aead, dataKey, ad)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Sealed{Ciphertext: s.Ciphertext, WrappedKey: wrapped, KeyID: to.id}, nil
+}
+
+func (k *MasterKey) unwrap(s Sealed, ad []byte) ([]byte, error) {
+	if s.KeyID != k.id {
+		return nil, ErrWrongMasterKey
+	}
+
+	return open(k.aead, s.WrappedKey, ad)
+}
+
+// additionalData is authenticated together with the ciphertexts of the secret.
+func additionalData(secretID int64) []byte {
+	return strconv.AppendInt([]byte("secret:"), secretID, 10)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
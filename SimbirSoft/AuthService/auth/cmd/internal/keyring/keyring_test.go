@@ -0,0 +1,119 @@
+package keyring
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := newTestKey(t)
+	other := newTestKey(t)
+
+	sealed, err := key.Seal(1, []byte("signing secret"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		key      *MasterKey
+		secretID int64
+		sealed   Sealed
+		wantErr  bool
+	}{
+		{name: "same row", key: key, secretID: 1, sealed: sealed},
+		{name: "copied into another row", key: key, secretID: 2, sealed: sealed, wantErr: true},
+		{name: "another master key", key: other, secretID: 1, sealed: sealed, wantErr: true},
+		{
+			name:     "wrapped key of another row",
+			key:      key,
+			secretID: 1,
+			sealed:   Sealed{Ciphertext: sealed.Ciphertext, WrappedKey: mustSeal(t, key, 2).WrappedKey, KeyID: sealed.KeyID},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := tt.key.Open(tt.secretID, tt.sealed)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "signing secret", string(secret))
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey := newTestKey(t)
+	newKey := newTestKey(t)
+
+	sealed := mustSeal(t, oldKey, 7)
+
+	rewrapped, err := oldKey.Rewrap(7, sealed, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID(), rewrapped.KeyID)
+
+	secret, err := newKey.Open(7, rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "signing secret", string(secret))
+
+	_, err = oldKey.Rewrap(8, sealed, newKey)
+	assert.Error(t, err)
+}
+
+func TestLoadForEnv_DevKeyOnlyInLocal(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		env     string
+		wantErr bool
+	}{
+		{env: "local"},
+		{env: "dev", wantErr: true},
+		{env: "staging", wantErr: true},
+		{env: "prod", wantErr: true},
+		{env: "production", wantErr: true},
+		{env: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			key, err := LoadForEnv(log, config.SecretsConfig{}, tt.env)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrNoMasterKey)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NotNil(t, key)
+		})
+	}
+}
+
+func newTestKey(t *testing.T) *MasterKey {
+	t.Helper()
+
+	b, err := randomBytes(KeySize)
+	require.NoError(t, err)
+
+	key, err := New(b)
+	require.NoError(t, err)
+
+	return key
+}
+
+func mustSeal(t *testing.T, key *MasterKey, secretID int64) Sealed {
+	t.Helper()
+
+	sealed, err := key.Seal(secretID, []byte("signing secret"))
+	require.NoError(t, err)
+
+	return sealed
+}
@@ -0,0 +1,124 @@
+// Package mailer delivers emails sent by the auth service.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+const (
+	KindFile = "file"
+	KindSMTP = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.Kind.
+func New(cfg config.MailerConfig) (Mailer, error) {
+	const op = "mailer.New"
+
+	switch cfg.Kind {
+	case KindFile:
+		return NewFileOutbox(cfg.OutboxDir, cfg.From)
+	case KindSMTP:
+		return &SMTP{addr: cfg.SMTPAddress, from: cfg.From, username: cfg.SMTPUsername, password: cfg.SMTPPassword}, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown mailer %q", op, cfg.Kind)
+	}
+}
+
+// FileOutbox writes every message to its own .eml file, for local use.
+type FileOutbox struct {
+	dir  string
+	from string
+}
+
+func NewFileOutbox(dir, from string) (*FileOutbox, error) {
+	const op = "mailer.NewFileOutbox"
+
+	// письма содержат одноразовые токены входа
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &FileOutbox{dir: dir, from: from}, nil
+}
+
+func (o *FileOutbox) Send(_ context.Context, msg Message) error {
+	const op = "mailer.FileOutbox.Send"
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+
+	err := os.WriteFile(filepath.Join(o.dir, name), format(o.from, msg), 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SMTP sends messages through an SMTP relay, with PLAIN auth if a username is set.
+type SMTP struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+func (s *SMTP) Send(_ context.Context, msg Message) error {
+	const op = "mailer.SMTP.Send"
+
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+
+	if err := smtp.SendMail(s.addr, auth, s.from, []string{msg.To}, format(s.from, msg)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
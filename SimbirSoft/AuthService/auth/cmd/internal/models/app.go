@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Режимы привязки токенов приложения к клиенту, см. App.Binding
+const (
+	BindingNone        = "none"
+	BindingIP          = "ip"         // подсеть клиента: /24 для IPv4, /64 для IPv6
+	BindingUserAgent   = "user_agent" // User-Agent клиента
+	BindingIPUserAgent = "ip_user_agent"
+	BindingKey         = "key" // отпечаток публичного ключа клиента (RFC 7638), как jkt в DPoP
+)
+
+// App is a client application of a realm. Its tokens are signed with its own secret
+// and carry its ID, so they are rejected by other apps.
+type App struct {
+	ID              int64
+	RealmID         int64
+	Name            string
+	RedirectOrigins []string      // scheme://host[:port] magic links may lead to
+	TokenTTL        time.Duration // 0 means the TTL of the realm
+	Binding         string        // what tokens are bound to, one of the Binding* modes
+	Enabled         bool
+	CreatedAt       time.Time
+}
+
+// ClientContext describes the client a token is issued to or presented by.
+// Only the parts required by the binding mode of the app are used.
+type ClientContext struct {
+	IP            string
+	UserAgent     string
+	KeyThumbprint string // base64url SHA-256 JWK thumbprint of the client key
+}
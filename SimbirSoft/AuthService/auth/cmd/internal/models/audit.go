@@ -0,0 +1,21 @@
+package models
+
+// Audit events
+const (
+	EventLogin            = "login"
+	EventMagicLinkRequest = "magic_link_requested"
+	EventImpersonation    = "impersonation"
+	EventAppCreated       = "app_created"
+	EventAppUpdated       = "app_updated"
+	EventWebhookReplay    = "webhook_replayed"
+	EventTokenExchange    = "token_exchange"
+)
+
+// AuditEvent is a row of the audit log. UserID is 0 if the user is unknown,
+// for impersonation it is the admin and the target is in Details.
+type AuditEvent struct {
+	UserID  int64
+	Event   string
+	Method  string            // login method, see jwt.Method*
+	Details map[string]string // free-form context, stored as JSON
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Domain events, written to the outbox in the same transaction as the change of the user
+const (
+	EventUserRegistered   = "user.registered"
+	EventUserEmailChanged = "user.email_changed"
+	EventUserDisabled     = "user.disabled"
+	EventUserEnabled      = "user.enabled"
+	EventUserDeleted      = "user.deleted"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // attempts are exhausted, only a replay sends it again
+)
+
+// OutboxEvent is a domain event of a user of the realm.
+type OutboxEvent struct {
+	ID        int64
+	RealmID   int64
+	Realm     string // name of the realm, filled when the event is read for delivery
+	Type      string
+	UserID    int64
+	Data      map[string]string // e.g. email, old_email
+	CreatedAt time.Time
+}
+
+// Delivery is an event sent to one webhook endpoint.
+type Delivery struct {
+	ID            int64
+	Event         OutboxEvent
+	Endpoint      string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	DeliveredAt   time.Time // zero until delivered
+	CreatedAt     time.Time
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Realm is a tenant: users, signing secrets, token TTL and the password policy are per realm.
+type Realm struct {
+	ID        int64
+	Name      string
+	TokenTTL  time.Duration // 0 means token_ttl of the config
+	Password  PasswordPolicy
+	CreatedAt time.Time
+}
+
+type PasswordPolicy struct {
+	MinLength    int
+	RequireDigit bool
+	RequireUpper bool
+}
+
+// Check returns a readable reason if the password doesn't satisfy the policy.
+func (p PasswordPolicy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("password should be at least %d characters", p.MinLength)
+	}
+
+	if p.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		return errors.New("password should contain a digit")
+	}
+
+	if p.RequireUpper && !strings.ContainsFunc(password, unicode.IsUpper) {
+		return errors.New("password should contain an uppercase letter")
+	}
+
+	return nil
+}
+
+// Scope is a scope Login may grant in the realm, AdminOnly ones only to admins of the realm.
+type Scope struct {
+	Name      string
+	AdminOnly bool
+}
@@ -1,6 +1,18 @@
 package models
 
+import "time"
+
 type Secret struct {
-	ID     int64
-	Secret string
+	ID      int64
+	RealmID int64
+	AppID   int64 // 0 for secrets of the realm itself
+	Secret  string
+}
+
+// SecretInfo is secret metadata that is safe to show.
+type SecretInfo struct {
+	ID        int64
+	KeyID     string // master key the secret is encrypted with
+	Active    bool   // new tokens are signed with the active secret
+	CreatedAt time.Time
 }
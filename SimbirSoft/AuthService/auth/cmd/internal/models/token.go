@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Introspection describes a token as seen by the auth service (RFC 7662).
+// All fields except Active are empty for an inactive token.
+type Introspection struct {
+	Active    bool
+	Issuer    string // realm the token was issued in
+	Subject   string
+	Email     string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	JTI       string
+	Scope     string
+	Audience  []string
+	ClientID  string
+	Actor     string // ID of the admin for an impersonation token
+}
+
+// Identity is the owner of a valid token.
+type Identity struct {
+	UserID  int64
+	ActorID int64    // admin acting as the user, 0 if the token is not an impersonation token
+	Scopes  []string // empty if the token is not limited to a scope
+}
+
+// ExchangedToken is the result of a token exchange (RFC 8693).
+type ExchangedToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Scopes    []string
+}
+
+// Impersonated reports whether an admin acts as the user.
+func (i Identity) Impersonated() bool {
+	return i.ActorID != 0
+}
@@ -2,6 +2,9 @@ package models
 
 type User struct {
 	ID       int64
+	RealmID  int64
 	Email    string
 	PassHash []byte
+	IsAdmin  bool // may impersonate other users
+	Disabled bool // can't log in
 }
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+)
+
+// CreateApp registers an enabled app in the realm with a new signing secret.
+// The adminToken must belong to an admin of the realm.
+func (a *Auth) CreateApp(ctx context.Context, realmName string, adminToken string, app models.App) (models.App, error) {
+	const op = "Auth.CreateApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.String("app", app.Name),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	admin, err := a.requireAdmin(ctx, realm, adminToken)
+	if err != nil {
+		log.Warn("app creation denied", slog.String("err", err.Error()))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret := make([]byte, appSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.RealmID = realm.ID
+	saved, err := a.apps.SaveApp(ctx, app, secret)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+
+		log.Error("failed to save app", slog.String("err", err.Error()))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		UserID:  admin.ID,
+		Event:   models.EventAppCreated,
+		Details: map[string]string{"app_id": strconv.FormatInt(saved.ID, 10), "name": saved.Name},
+	})
+
+	log.Info("app created", slog.Int64("app_id", saved.ID))
+
+	return saved, nil
+}
+
+// UpdateApp replaces the redirect origins, the token TTL and the enabled flag of the app.
+// Disabling the app invalidates all its tokens at once.
+func (a *Auth) UpdateApp(ctx context.Context, realmName string, adminToken string, app models.App) (models.App, error) {
+	const op = "Auth.UpdateApp"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.Int64("app_id", app.ID),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	admin, err := a.requireAdmin(ctx, realm, adminToken)
+	if err != nil {
+		log.Warn("app update denied", slog.String("err", err.Error()))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.RealmID = realm.ID
+	updated, err := a.apps.UpdateApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w %d", op, ErrUnknownApp, app.ID)
+		}
+
+		log.Error("failed to update app", slog.String("err", err.Error()))
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		UserID: admin.ID,
+		Event:  models.EventAppUpdated,
+		Details: map[string]string{
+			"app_id":  strconv.FormatInt(updated.ID, 10),
+			"enabled": strconv.FormatBool(updated.Enabled),
+		},
+	})
+
+	log.Info("app updated", slog.Bool("enabled", updated.Enabled))
+
+	return updated, nil
+}
+
+// ListApps returns the apps of the realm.
+func (a *Auth) ListApps(ctx context.Context, realmName string, adminToken string) ([]models.App, error) {
+	const op = "Auth.ListApps"
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.requireAdmin(ctx, realm, adminToken); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	apps, err := a.apps.Apps(ctx, realm.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
@@ -2,14 +2,24 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/jwt"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/mailer"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/metrics"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,177 +29,970 @@ const (
 )
 
 type Auth struct {
-	log         *slog.Logger
-	usrSaver    UserSaver
-	usrProvider UserProvider
-	appProvider AppProvider // Я использую для одного secret
-	tokenTTL    time.Duration
+	log              *slog.Logger
+	usrSaver         UserSaver
+	usrProvider      UserProvider
+	secrets          SecretProvider
+	apps             AppProvider
+	deliveries       DeliveryProvider
+	realms           RealmProvider
+	revoker          TokenRevoker
+	magicLinks       MagicLinkStorage
+	auditor          Auditor
+	mailer           mailer.Mailer
+	tokenTTL         time.Duration
+	impersonationTTL time.Duration
+	exchangeTTL      time.Duration
+	defaultRealm     string
+	magicLink        config.MagicLinkConfig
 }
 
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, passHash []byte) (statusMsg string, err error)
+	SaveUser(ctx context.Context, realmID int64, email string, passHash []byte) (statusMsg string, err error)
 }
 
 type UserProvider interface {
-	User(ctx context.Context, email string) (models.User, error)
+	User(ctx context.Context, realmID int64, email string) (models.User, error)
+	UserByID(ctx context.Context, id int64) (models.User, error)
 }
 
-type AppProvider interface {
+// SecretProvider отдает секреты подписи: активным секретом realm или приложения подписываются
+// новые токены, остальные нужны для проверки уже выданных (по kid)
+type SecretProvider interface {
 	Secret(ctx context.Context, id int) (models.Secret, error)
-	GetPayload(ctx context.Context, payload *jwt.MyClaims) (models.User, error)
+	ActiveSecret(ctx context.Context, realmID int64) (models.Secret, error)
+	ActiveAppSecret(ctx context.Context, appID int64) (models.Secret, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, id int64) (models.App, error)
+	Apps(ctx context.Context, realmID int64) ([]models.App, error)
+	SaveApp(ctx context.Context, app models.App, secret []byte) (models.App, error)
+	UpdateApp(ctx context.Context, app models.App) (models.App, error)
+}
+
+// DeliveryProvider отдает доставки webhook событий realm для администраторов
+type DeliveryProvider interface {
+	Deliveries(ctx context.Context, realmID int64, status string, limit int) ([]models.Delivery, error)
+	ReplayDelivery(ctx context.Context, realmID int64, id int64) error
+}
+
+// RealmProvider отдает realm и scopes, которые в нем можно получить при Login
+type RealmProvider interface {
+	Realm(ctx context.Context, name string) (models.Realm, error)
+	Scopes(ctx context.Context, realmID int64) ([]models.Scope, error)
+}
+
+type TokenRevoker interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type MagicLinkStorage interface {
+	SaveMagicLink(ctx context.Context, userID int64, appID int64, tokenHash []byte, expiresAt time.Time) error
+	ConsumeMagicLink(ctx context.Context, realmID int64, tokenHash []byte) (models.User, int64, error)
+}
+
+type Auditor interface {
+	RecordAudit(ctx context.Context, event models.AuditEvent) error
 }
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
+	// ErrInvalidToken covers expired, revoked and malformed tokens and tokens signed with an unknown key
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInvalidMagicLink covers unknown, expired and already used links
+	ErrInvalidMagicLink = errors.New("invalid or expired magic link")
+	ErrNotAdmin         = errors.New("admin role required")
+	ErrTargetNotFound   = errors.New("target user not found")
+	// ErrNestedImpersonation: an impersonation token can't be used for admin actions, including impersonating again
+	ErrNestedImpersonation = errors.New("impersonation token can't be used for admin actions")
+	ErrUnknownRealm        = errors.New("unknown realm")
+	// ErrWeakPassword is followed by the reason, see models.PasswordPolicy.Check
+	ErrWeakPassword = errors.New("weak password")
+	// ErrUnknownApp covers apps of other realms too
+	ErrUnknownApp  = errors.New("unknown app")
+	ErrAppDisabled = errors.New("app is disabled")
+	ErrAppExists   = errors.New("app already exists")
+	// ErrRedirectNotAllowed: the origin of the redirect URL is not in the redirect origins of the app
+	ErrRedirectNotAllowed = errors.New("redirect url is not allowed")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrDeliveryNotFound   = errors.New("webhook delivery not found")
+	// ErrClientContextRequired: the binding mode of the app needs a part of the client context the request lacks
+	ErrClientContextRequired = errors.New("client context required by the app binding")
+	// ErrInsufficientScope: the token is valid, but not for the audience or the scopes of the request
+	ErrInsufficientScope = errors.New("insufficient scope")
+	// ErrUnknownScope: the requested scope is not in the scopes of the realm
+	ErrUnknownScope = errors.New("unknown scope")
+	// ErrAdminScope: the requested scope is granted only to admins of the realm
+	ErrAdminScope = errors.New("scope requires the admin role")
+)
+
+const (
+	// Размер одноразового токена magic link в байтах
+	magicLinkTokenSize = 32
+	// Размер секрета HS256 приложения в байтах, как в cmd/secrets
+	appSecretSize = 32
 )
 
 func New(
 	log *slog.Logger,
 	userSaver UserSaver,
 	userProvider UserProvider,
-	appProvider AppProvider, // Я использую для одного secret
+	secrets SecretProvider,
+	apps AppProvider,
+	deliveries DeliveryProvider,
+	realms RealmProvider,
+	revoker TokenRevoker,
+	magicLinks MagicLinkStorage,
+	auditor Auditor,
+	mailer mailer.Mailer,
 	tokenTTL time.Duration,
+	impersonationTTL time.Duration,
+	exchangeTTL time.Duration,
+	defaultRealm string,
+	magicLink config.MagicLinkConfig,
 ) *Auth {
 	return &Auth{
-		usrSaver:    userSaver,
-		usrProvider: userProvider,
-		log:         log,
-		appProvider: appProvider,
-		tokenTTL:    tokenTTL,
+		usrSaver:         userSaver,
+		usrProvider:      userProvider,
+		log:              log,
+		secrets:          secrets,
+		apps:             apps,
+		deliveries:       deliveries,
+		realms:           realms,
+		revoker:          revoker,
+		magicLinks:       magicLinks,
+		auditor:          auditor,
+		mailer:           mailer,
+		tokenTTL:         tokenTTL,
+		impersonationTTL: impersonationTTL,
+		exchangeTTL:      exchangeTTL,
+		defaultRealm:     defaultRealm,
+		magicLink:        magicLink,
 	}
 }
 
-// Login checks if user with given credentials exists in the system and returns access token.
+// Login checks if user with given credentials exists in the realm and returns access token.
+// An empty realmName means the default realm. With appID the token is issued for the app,
+// which must be an enabled app of the realm, and is bound to the client as the app requires.
+// The token is also issued for the audience services and limited to the scope if they are not empty.
 //
 // If user exists, but password is incorrect, returns error.
 // If user doesn't exist, returns error.
-func (a *Auth) Login(ctx context.Context, email string, password string, idSec int) (string, error) {
+func (a *Auth) Login(
+	ctx context.Context,
+	realmName string,
+	appID int64,
+	email string,
+	password string,
+	client models.ClientContext,
+	audience []string,
+	scope []string,
+) (string, error) {
 	const op = "Auth.Login"
 
 	log := a.log.With(
 		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.Int64("app_id", appID),
 		slog.String("username", email),
 	)
 
 	log.Info("attempting to login user")
 
-	user, err := a.usrProvider.User(ctx, email)
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.app(ctx, realm, appID)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.usrProvider.User(ctx, realm.ID, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Warn("user not found", slog.String("err", err.Error()))
+			metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials).Inc()
 
 			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 
 		a.log.Error("failed to get user", slog.String("err", err.Error()))
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
 
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
+	start := time.Now()
+	err = bcrypt.CompareHashAndPassword(user.PassHash, []byte(password))
+	metrics.BcryptDuration.WithLabelValues(metrics.BcryptCompare).Observe(time.Since(start).Seconds())
+	if err != nil {
 		a.log.Info("invalid credentials", slog.String("err", err.Error()))
+		metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials).Inc()
 
 		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
 
-	sec, err := a.appProvider.Secret(ctx, idSec)
+	// проверяем после пароля: иначе по ответу можно узнать, что учетная запись существует
+	if user.Disabled {
+		log.Info("disabled user tried to log in")
+		metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	// scope запрашивает клиент, поэтому выдается только то, что есть в списке realm
+	if err := a.checkScope(ctx, realm, user, scope); err != nil {
+		if errors.Is(err, ErrUnknownScope) || errors.Is(err, ErrAdminScope) {
+			log.Info("scope not granted", slog.String("err", err.Error()))
+			metrics.Logins.WithLabelValues(metrics.ResultInvalid).Inc()
+		} else {
+			log.Error("failed to check scope", slog.String("err", err.Error()))
+			metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.issueToken(ctx, realm, app, user, jwt.MethodPassword, client, audience, scope)
 	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
 	log.Info("user logged in successfully")
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
+
+	return token, nil
+}
 
-	token, err := jwt.NewToken(user, sec, a.tokenTTL)
+// RequestMagicLink emails a one-time login link to the user of the realm. With appID the token
+// is issued for the app; redirectURL is passed to the link page and its origin must be one
+// of the redirect origins of the app.
+//
+// Unknown emails are not an error, so the caller can't find out who is registered.
+func (a *Auth) RequestMagicLink(ctx context.Context, realmName string, appID int64, email string, redirectURL string) error {
+	const op = "Auth.RequestMagicLink"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.Int64("app_id", appID),
+		slog.String("email", email),
+	)
+
+	realm, err := a.realm(ctx, realmName)
 	if err != nil {
-		a.log.Error("failed to generate token", slog.String("err", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.app(ctx, realm, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// проверяем до поиска пользователя: ответ не должен зависеть от того, зарегистрирован ли email
+	if redirectURL != "" && !redirectAllowed(app, redirectURL) {
+		log.Warn("magic link redirect rejected", slog.String("redirect_url", redirectURL))
+
+		return fmt.Errorf("%s: %w", op, ErrRedirectNotAllowed)
+	}
+
+	user, err := a.usrProvider.User(ctx, realm.ID, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("magic link requested for unknown email")
+
+			return nil
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled {
+		log.Info("magic link requested for a disabled user")
+
+		return nil
+	}
+
+	raw := make([]byte, magicLinkTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := a.magicLinks.SaveMagicLink(ctx, user.ID, app.ID, hashToken(token), time.Now().Add(a.magicLink.TTL)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	link, err := a.magicLinkURL(token, redirectURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Follow the link to log in, it expires in %s and works once:\r\n\r\n%s\r\n",
+			a.magicLink.TTL, link),
+	})
+	if err != nil {
+		log.Error("failed to send magic link", slog.String("err", err.Error()))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{UserID: user.ID, Event: models.EventMagicLinkRequest, Method: jwt.MethodMagicLink})
+
+	log.Info("magic link sent")
+
+	return nil
+}
+
+// ConsumeMagicLink exchanges a one-time link token for an auth token bound to the client
+// which opened the link. A link of a user of another realm is invalid.
+func (a *Auth) ConsumeMagicLink(ctx context.Context, realmName string, token string, client models.ClientContext) (string, error) {
+	const op = "Auth.ConsumeMagicLink"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, appID, err := a.magicLinks.ConsumeMagicLink(ctx, realm.ID, hashToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrMagicLinkNotFound) {
+			log.Info("invalid magic link")
+			metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials).Inc()
+
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidMagicLink)
+		}
+
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// пользователя могли отключить, пока письмо шло
+	if user.Disabled {
+		log.Info("magic link of a disabled user", slog.Int64("user_id", user.ID))
+		metrics.Logins.WithLabelValues(metrics.ResultInvalidCredentials).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidMagicLink)
+	}
+
+	// приложение могли отключить, пока письмо шло
+	app, err := a.app(ctx, realm, appID)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authToken, err := a.issueToken(ctx, realm, app, user, jwt.MethodMagicLink, client, nil, nil)
+	if err != nil {
+		metrics.Logins.WithLabelValues(metrics.ResultError).Inc()
 
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	log.Info("user logged in with magic link", slog.Int64("user_id", user.ID))
+	metrics.Logins.WithLabelValues(metrics.ResultSuccess).Inc()
+
+	return authToken, nil
+}
+
+// Impersonate issues a short-lived token for the target user on behalf of the admin
+// the adminToken belongs to. The token carries the admin in the act claim.
+// The admin and the target must be in the same realm. With appID the token is issued
+// for the app and bound to the client as the app requires, like a Login token.
+func (a *Auth) Impersonate(
+	ctx context.Context,
+	realmName string,
+	adminToken string,
+	appID int64,
+	targetID int64,
+	reason string,
+	client models.ClientContext,
+) (string, time.Time, error) {
+	const op = "Auth.Impersonate"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.Int64("app_id", appID),
+		slog.Int64("target_user_id", targetID),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.app(ctx, realm, appID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	admin, err := a.requireAdmin(ctx, realm, adminToken)
+	if err != nil {
+		log.Warn("impersonation denied", slog.String("err", err.Error()))
+
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	target, err := a.usrProvider.UserByID(ctx, targetID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrTargetNotFound)
+		}
+
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if target.RealmID != realm.ID {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrTargetNotFound)
+	}
+	// как и Login, отключенному пользователю токен не выдается
+	if target.Disabled {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	cnf, err := confirmation(app.Binding, client)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sec, err := a.signingSecret(ctx, realm, app)
+	if err != nil {
+		log.Error("failed to get signing secret", slog.String("err", err.Error()))
+
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	expiresAt := time.Now().Add(a.impersonationTTL)
+
+	token, err := jwt.NewImpersonationToken(target, realm.Name, admin.ID, sec, a.impersonationTTL, cnf)
+	if err != nil {
+		log.Error("failed to generate token", slog.String("err", err.Error()))
+
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := map[string]string{
+		"target_user_id": strconv.FormatInt(target.ID, 10),
+		"reason":         reason,
+	}
+	if app.ID != 0 {
+		details["app_id"] = strconv.FormatInt(app.ID, 10)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		UserID:  admin.ID,
+		Event:   models.EventImpersonation,
+		Details: details,
+	})
+
+	log.Info("admin impersonates user", slog.Int64("admin_id", admin.ID), slog.String("reason", reason))
+
+	return token, expiresAt, nil
+}
+
+// issueToken signs a token with the active secret of the app, or of the realm if app is zero,
+// and records the login. The TTL of the app overrides the TTL of the realm, the binding mode
+// of the app decides what of the client context the token is bound to.
+func (a *Auth) issueToken(
+	ctx context.Context,
+	realm models.Realm,
+	app models.App,
+	user models.User,
+	method string,
+	client models.ClientContext,
+	audience []string,
+	scope []string,
+) (string, error) {
+	// до подписи: без нужной части контекста клиента токен не выдается
+	cnf, err := confirmation(app.Binding, client)
+	if err != nil {
+		return "", err
+	}
+
+	sec, err := a.signingSecret(ctx, realm, app)
+	if err != nil {
+		a.log.Error("failed to get signing secret",
+			slog.String("realm", realm.Name),
+			slog.Int64("app_id", app.ID),
+			slog.String("err", err.Error()),
+		)
+
+		return "", err
+	}
+
+	ttl := a.tokenTTL
+	if app.TokenTTL > 0 {
+		ttl = app.TokenTTL
+	} else if realm.TokenTTL > 0 {
+		ttl = realm.TokenTTL
+	}
+
+	token, err := jwt.NewToken(user, realm.Name, sec, ttl, method, audience, scope, cnf)
+	if err != nil {
+		a.log.Error("failed to generate token", slog.String("err", err.Error()))
+
+		return "", err
+	}
+
+	var details map[string]string
+	if app.ID != 0 {
+		details = map[string]string{"app_id": strconv.FormatInt(app.ID, 10)}
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{UserID: user.ID, Event: models.EventLogin, Method: method, Details: details})
+
 	return token, nil
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, email string, password string) (string, error) {
+// signingSecret returns the active secret of the app, or of the realm if app is zero.
+func (a *Auth) signingSecret(ctx context.Context, realm models.Realm, app models.App) (models.Secret, error) {
+	if app.ID != 0 {
+		return a.secrets.ActiveAppSecret(ctx, app.ID)
+	}
+
+	return a.secrets.ActiveSecret(ctx, realm.ID)
+}
+
+// requireAdmin returns the owner of the token if it is an admin of the realm.
+// Impersonation tokens are refused even if the actor is an admin.
+func (a *Auth) requireAdmin(ctx context.Context, realm models.Realm, token string) (models.User, error) {
+	claims, user, err := a.parseToken(ctx, realm, token)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if claims.Act != nil {
+		return models.User{}, fmt.Errorf("%w: actor %s", ErrNestedImpersonation, claims.Act.Subject)
+	}
+
+	// роль проверяется по базе, а не по токену: отозванный админ теряет доступ сразу
+	if !user.IsAdmin {
+		return models.User{}, fmt.Errorf("%w: user %d", ErrNotAdmin, user.ID)
+	}
+
+	return user, nil
+}
+
+// recordAudit doesn't fail the operation, a lost audit record is only logged.
+func (a *Auth) recordAudit(ctx context.Context, event models.AuditEvent) {
+	if err := a.auditor.RecordAudit(ctx, event); err != nil {
+		a.log.Error("failed to record audit event",
+			slog.String("event", event.Event),
+			slog.Int64("user_id", event.UserID),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// realm resolves the realm by name, an empty name means the default realm.
+func (a *Auth) realm(ctx context.Context, name string) (models.Realm, error) {
+	if name == "" {
+		name = a.defaultRealm
+	}
+
+	realm, err := a.realms.Realm(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrRealmNotFound) {
+			return models.Realm{}, fmt.Errorf("%w %q", ErrUnknownRealm, name)
+		}
+
+		return models.Realm{}, err
+	}
+
+	return realm, nil
+}
+
+// app resolves an enabled app of the realm, id 0 means no app and returns the zero App.
+func (a *Auth) app(ctx context.Context, realm models.Realm, id int64) (models.App, error) {
+	if id == 0 {
+		return models.App{}, nil
+	}
+
+	app, err := a.apps.App(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%w %d", ErrUnknownApp, id)
+		}
+
+		return models.App{}, err
+	}
+	if app.RealmID != realm.ID {
+		return models.App{}, fmt.Errorf("%w %d", ErrUnknownApp, id)
+	}
+	if !app.Enabled {
+		return models.App{}, fmt.Errorf("%w: %d", ErrAppDisabled, id)
+	}
+
+	return app, nil
+}
+
+// redirectAllowed reports whether the origin of rawURL is one of the redirect origins of the app.
+func redirectAllowed(app models.App, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	return slices.Contains(app.RedirectOrigins, u.Scheme+"://"+u.Host)
+}
+
+// magicLinkURL fills the link template of the config, the redirect goes to the redirect_uri parameter.
+func (a *Auth) magicLinkURL(token string, redirectURL string) (string, error) {
+	link := strings.ReplaceAll(a.magicLink.URL, "{token}", token)
+	if redirectURL == "" {
+		return link, nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("redirect_uri", redirectURL)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// RegisterNewUser creates a user in the realm if the password satisfies the realm policy.
+func (a *Auth) RegisterNewUser(ctx context.Context, realmName string, email string, password string) (string, error) {
 
 	const op = "auth.RegisterNewUser"
 
 	log := a.log.With(
 		slog.String("op", op),
+		slog.String("realm", realmName),
 		slog.String("email", email),
 	)
 
 	log.Info("registering user")
 
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		metrics.Registrations.WithLabelValues(metrics.ResultError).Inc()
+
+		return Fail, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := realm.Password.Check(password); err != nil {
+		log.Info("password rejected by the realm policy", slog.String("err", err.Error()))
+		metrics.Registrations.WithLabelValues(metrics.ResultWeakPassword).Inc()
+
+		return Fail, fmt.Errorf("%s: %w: %w", op, ErrWeakPassword, err)
+	}
+
+	start := time.Now()
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	metrics.BcryptDuration.WithLabelValues(metrics.BcryptHash).Observe(time.Since(start).Seconds())
 	if err != nil {
 		log.Error("failed to generate password hash", slog.String("err", err.Error()))
+		metrics.Registrations.WithLabelValues(metrics.ResultError).Inc()
 
 		return Fail, fmt.Errorf("%s: %w", op, err)
 	}
 
-	msg, err := a.usrSaver.SaveUser(ctx, email, passHash)
+	msg, err := a.usrSaver.SaveUser(ctx, realm.ID, email, passHash)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserExists) {
 			log.Warn("user already exists", slog.String("err", err.Error()))
+			metrics.Registrations.WithLabelValues(metrics.ResultUserExists).Inc()
 
 			return Fail, fmt.Errorf("%s: %w", op, ErrUserExists)
 		}
 
 		log.Error("failed to save user", slog.String("err", err.Error()))
+		metrics.Registrations.WithLabelValues(metrics.ResultError).Inc()
 
 		return Fail, fmt.Errorf("%s: %w", op, err)
 	}
 
+	metrics.Registrations.WithLabelValues(metrics.ResultSuccess).Inc()
+
 	return msg, nil
 }
 
-func (a *Auth) Logout(ctx context.Context, token string) (string, error) {
+// Logout revokes the token. Logging out with an already inactive token is not an error.
+func (a *Auth) Logout(ctx context.Context, realmName string, token string) (string, error) {
 	const op = "Auth.Logout"
 
 	log := a.log.With(
 		slog.String("op", op),
-		slog.String("token", token),
+		slog.String("realm", realmName),
 	)
 
 	log.Info("logging out ...")
 
-	token = ""
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, _, err := a.parseToken(ctx, realm, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Info("token is already inactive", slog.String("err", err.Error()))
+
+			return "", nil
+		}
+
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.revoker.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Error("failed to revoke token", slog.String("err", err.Error()))
 
-	// TODO: Хз как, нужно подумать как испортить токен, как костыль мб переприсваивать новый невалидный токен.
-	// Но я не могу ибо в proto файле я в респонсе указал чисто как bool, а не string
-	//P.S поменял
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
 	log.Info("successfully logged out")
 
-	return token, nil
+	return "", nil
 }
 
-func (a *Auth) ValidateToken(ctx context.Context, token string, idSec int) (int, error) {
+// ValidateToken returns the user the token was issued to and, for an impersonation token, the admin.
+// A token issued in another realm or for another app is invalid, appID 0 accepts only tokens
+// issued without an app. If the app binds tokens, client must be the client the token was bound to.
+//
+// A non-empty audience must be one of the audiences the token was issued for and the token must be
+// granted all the scopes, a token without the scope claim has none. Otherwise ErrInsufficientScope.
+// Admin only scopes are granted while the user is an admin, the identity has only the granted scopes.
+func (a *Auth) ValidateToken(
+	ctx context.Context,
+	realmName string,
+	appID int64,
+	token string,
+	client models.ClientContext,
+	audience string,
+	scopes []string,
+) (models.Identity, error) {
 	const op = "Auth.ValidateToken"
 
 	log := a.log.With(
 		slog.String("op", op),
-		slog.String("token", token),
+		slog.String("realm", realmName),
+		slog.Int64("app_id", appID),
 	)
 
 	log.Info("validating token ...")
 
-	sec, err := a.appProvider.Secret(ctx, idSec)
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		metrics.TokenValidations.WithLabelValues(metrics.ResultError).Inc()
+
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, user, err := a.parseToken(ctx, realm, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+		} else {
+			metrics.TokenValidations.WithLabelValues(metrics.ResultError).Inc()
+		}
+
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if claims.AppID != appID {
+		metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+
+		return models.Identity{}, fmt.Errorf("%s: %w: issued for app %d", op, ErrInvalidToken, claims.AppID)
+	}
+
+	if err := a.checkAppBinding(ctx, claims, client); err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Info("token presented by another client", slog.String("err", err.Error()))
+			metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+		} else {
+			metrics.TokenValidations.WithLabelValues(metrics.ResultError).Inc()
+		}
+
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// realm есть в aud любого токена, поэтому сервис всегда указывает свое имя, а не realm
+	if audience != "" && (audience == realm.Name || !slices.Contains(claims.Audience, audience)) {
+		metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+
+		return models.Identity{}, fmt.Errorf("%s: %w: not issued for %q", op, ErrInsufficientScope, audience)
+	}
+
+	granted, err := a.grantedScopes(ctx, realm, user, claims.Scopes())
+	if err != nil {
+		log.Error("failed to check granted scopes", slog.String("err", err.Error()))
+		metrics.TokenValidations.WithLabelValues(metrics.ResultError).Inc()
+
+		return models.Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+
+			return models.Identity{}, fmt.Errorf("%s: %w: %v required, %v granted", op, ErrInsufficientScope, scopes, granted)
+		}
+	}
+
+	actorID, err := claims.ActorID()
 	if err != nil {
-		return -1, fmt.Errorf("%s: %w", op, err)
+		metrics.TokenValidations.WithLabelValues(metrics.ResultInvalid).Inc()
+
+		return models.Identity{}, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
 	}
 
-	MyPayload, err := jwt.ValidateToken(token, sec)
+	metrics.TokenValidations.WithLabelValues(metrics.ResultValid).Inc()
+
+	return models.Identity{UserID: user.ID, ActorID: actorID, Scopes: granted}, nil
+}
+
+// Introspect describes the token. An inactive token, including a token of another realm or of
+// a disabled or deleted user, is not an error.
+func (a *Auth) Introspect(ctx context.Context, realmName string, token string) (models.Introspection, error) {
+	const op = "Auth.Introspect"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+	)
+
+	realm, err := a.realm(ctx, realmName)
 	if err != nil {
-		return -1, fmt.Errorf("%s: %w", op, err)
+		return models.Introspection{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	user, err := a.appProvider.GetPayload(ctx, MyPayload)
+	claims, _, err := a.parseToken(ctx, realm, token)
 	if err != nil {
-		return -1, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, ErrInvalidToken) {
+			log.Info("token is inactive", slog.String("err", err.Error()))
+
+			return models.Introspection{Active: false}, nil
+		}
+
+		return models.Introspection{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	var actor string
+	if claims.Act != nil {
+		actor = claims.Act.Subject
+	}
+
+	var clientID string
+	if claims.AppID != 0 {
+		clientID = strconv.FormatInt(claims.AppID, 10)
+	}
+
+	return models.Introspection{
+		Active:    true,
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		ExpiresAt: claims.ExpiresAt.Time,
+		IssuedAt:  claims.IssuedAt.Time,
+		JTI:       claims.ID,
+		Scope:     claims.Scope,
+		Audience:  claims.Audience,
+		ClientID:  clientID,
+		Actor:     actor,
+	}, nil
+}
+
+// parseToken checks the signature with the secret named in the kid header, the realm, the app,
+// the expiry, revocation and that the user still exists and is not disabled. Returns the user of
+// the token and ErrInvalidToken if the token must not be accepted.
+func (a *Auth) parseToken(ctx context.Context, realm models.Realm, token string) (*jwt.MyClaims, models.User, error) {
+	kid, err := jwt.KeyID(token)
+	if err != nil {
+		return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	sec, err := a.secrets.Secret(ctx, kid)
+	if err != nil {
+		if errors.Is(err, storage.ErrSecretNotFound) {
+			return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+
+		return nil, models.User{}, err
+	}
+
+	// ключ другого realm: iss и aud тоже не совпадут, но подпись чужим ключом не принимаем вовсе
+	if sec.RealmID != realm.ID {
+		return nil, models.User{}, fmt.Errorf("%w: signed with a key of another realm", ErrInvalidToken)
+	}
+
+	claims, err := jwt.ValidateToken(token, sec, realm.Name)
+	if err != nil {
+		return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, models.User{}, ErrInvalidToken
+	}
+
+	// токен приложения подписан его секретом, app_id с чужим ключом - подделка
+	if claims.AppID != sec.AppID {
+		return nil, models.User{}, fmt.Errorf("%w: app_id doesn't match the signing key", ErrInvalidToken)
+	}
+	if claims.AppID != 0 {
+		app, err := a.apps.App(ctx, claims.AppID)
+		if err != nil {
+			return nil, models.User{}, err
+		}
+		if !app.Enabled {
+			return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, ErrAppDisabled)
+		}
+	}
+
+	revoked, err := a.revoker.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, models.User{}, err
+	}
+	if revoked {
+		return nil, models.User{}, fmt.Errorf("%w: token is revoked", ErrInvalidToken)
+	}
+
+	// userctl disable и delete действуют на уже выданные токены сразу, а не по истечении
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	user, err := a.usrProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, models.User{}, fmt.Errorf("%w: user %d is deleted", ErrInvalidToken, userID)
+		}
+
+		return nil, models.User{}, err
+	}
+	if user.Disabled {
+		return nil, models.User{}, fmt.Errorf("%w: %w", ErrInvalidToken, ErrUserDisabled)
+	}
 
-	return int(user.ID), nil
+	return claims, user, nil
 }
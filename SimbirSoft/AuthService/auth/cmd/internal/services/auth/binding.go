@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/jwt"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+)
+
+// Размер подсети, к которой привязывается токен: смена адреса внутри сети оператора токен не ломает
+const (
+	ipv4BindingBits = 24
+	ipv6BindingBits = 64
+)
+
+// confirmation builds the cnf claim binding a token of an app with the given mode to the client,
+// nil if the mode doesn't bind tokens.
+func confirmation(mode string, client models.ClientContext) (*jwt.Confirmation, error) {
+	switch mode {
+	case "", models.BindingNone:
+		return nil, nil
+	case models.BindingKey:
+		if client.KeyThumbprint == "" {
+			return nil, fmt.Errorf("%w: key thumbprint", ErrClientContextRequired)
+		}
+
+		return &jwt.Confirmation{JKT: client.KeyThumbprint}, nil
+	}
+
+	hash, err := contextHash(mode, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwt.Confirmation{Context: hash}, nil
+}
+
+// checkAppBinding checks the binding of a token of an app with its current mode: after the mode
+// is changed tokens issued with the old one are refused. Tokens without an app are not bound.
+func (a *Auth) checkAppBinding(ctx context.Context, claims *jwt.MyClaims, client models.ClientContext) error {
+	if claims.AppID == 0 {
+		return nil
+	}
+
+	app, err := a.apps.App(ctx, claims.AppID)
+	if err != nil {
+		return err
+	}
+
+	return checkBinding(app.Binding, claims.Cnf, client)
+}
+
+// checkBinding reports whether the client presenting the token is the one it was bound to.
+// A token issued before the app started binding tokens has no cnf and is refused.
+func checkBinding(mode string, cnf *jwt.Confirmation, client models.ClientContext) error {
+	if mode == "" || mode == models.BindingNone {
+		return nil
+	}
+	if cnf == nil {
+		return fmt.Errorf("%w: token is not bound to a client", ErrInvalidToken)
+	}
+
+	if mode == models.BindingKey {
+		if cnf.JKT == "" || subtle.ConstantTimeCompare([]byte(cnf.JKT), []byte(client.KeyThumbprint)) != 1 {
+			return fmt.Errorf("%w: token binding mismatch", ErrInvalidToken)
+		}
+
+		return nil
+	}
+
+	hash, err := contextHash(mode, client)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if cnf.Context == "" || subtle.ConstantTimeCompare([]byte(cnf.Context), []byte(hash)) != 1 {
+		return fmt.Errorf("%w: token binding mismatch", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// contextHash hashes the parts of the client context the mode binds to. The token is readable
+// by anyone holding it, so it carries the hash instead of the address and the user agent.
+func contextHash(mode string, client models.ClientContext) (string, error) {
+	var subnet, userAgent string
+
+	if mode == models.BindingIP || mode == models.BindingIPUserAgent {
+		prefix, err := clientSubnet(client.IP)
+		if err != nil {
+			return "", err
+		}
+		subnet = prefix.String()
+	}
+
+	if mode == models.BindingUserAgent || mode == models.BindingIPUserAgent {
+		if client.UserAgent == "" {
+			return "", fmt.Errorf("%w: user agent", ErrClientContextRequired)
+		}
+		userAgent = client.UserAgent
+	}
+
+	if subnet == "" && userAgent == "" {
+		return "", fmt.Errorf("unknown binding mode %q", mode)
+	}
+
+	sum := sha256.Sum256([]byte(mode + "\n" + subnet + "\n" + userAgent))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// clientSubnet returns the subnet of the client address, with or without a port.
+func clientSubnet(ip string) (netip.Prefix, error) {
+	if ip == "" {
+		return netip.Prefix{}, fmt.Errorf("%w: ip", ErrClientContextRequired)
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		addrPort, portErr := netip.ParseAddrPort(ip)
+		if portErr != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: bad ip %q", ErrClientContextRequired, ip)
+		}
+		addr = addrPort.Addr()
+	}
+
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return addr.Prefix(ipv4BindingBits)
+	}
+
+	return addr.Prefix(ipv6BindingBits)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/jwt"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+)
+
+// TokenExchange trades the subject token for a narrower short-lived token of the same user (RFC 8693),
+// e.g. for a service to call another one on behalf of the user.
+//
+// The new token is issued only for the audience and only with the scope, both must be non-empty and
+// be a part of what the subject token was issued for, otherwise ErrInsufficientScope. It lives
+// no longer than the exchange TTL and the subject token and keeps the actor of an impersonation token.
+// A token of an app stays a token of that app: it is signed with the secret of the app and bound
+// to the same client as the subject token, which is exchanged only for that client.
+func (a *Auth) TokenExchange(
+	ctx context.Context,
+	realmName string,
+	subjectToken string,
+	client models.ClientContext,
+	audience []string,
+	scope []string,
+) (models.ExchangedToken, error) {
+	const op = "Auth.TokenExchange"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.String("audience", strings.Join(audience, " ")),
+		slog.String("scope", strings.Join(scope, " ")),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, user, err := a.parseToken(ctx, realm, subjectToken)
+	if err != nil {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkAppBinding(ctx, claims, client); err != nil {
+		log.Info("subject token presented by another client", slog.String("err", err.Error()))
+
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// обмен только сужает: иначе токен без нужного aud или scope превращался бы в токен с ними
+	if len(audience) == 0 || len(scope) == 0 {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w: audience and scope are required", op, ErrInsufficientScope)
+	}
+	for _, aud := range audience {
+		if aud == realm.Name || !slices.Contains(claims.Audience, aud) {
+			return models.ExchangedToken{}, fmt.Errorf("%s: %w: subject token is not issued for %q", op, ErrInsufficientScope, aud)
+		}
+	}
+	if !claims.HasScopes(scope) {
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w: subject token is granted %q", op, ErrInsufficientScope, claims.Scope)
+	}
+
+	ttl := min(a.exchangeTTL, time.Until(claims.ExpiresAt.Time))
+	expiresAt := time.Now().Add(ttl)
+
+	// parseToken уже проверил, что приложение токена есть и включено
+	app := models.App{ID: claims.AppID}
+
+	sec, err := a.signingSecret(ctx, realm, app)
+	if err != nil {
+		log.Error("failed to get signing secret", slog.String("err", err.Error()))
+
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwt.NewExchangedToken(user, realm.Name, sec, ttl, claims, audience, scope)
+	if err != nil {
+		log.Error("failed to generate token", slog.String("err", err.Error()))
+
+		return models.ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := map[string]string{
+		"subject_jti": claims.ID,
+		"audience":    strings.Join(audience, " "),
+		"scope":       strings.Join(scope, " "),
+	}
+	if app.ID != 0 {
+		details["app_id"] = strconv.FormatInt(app.ID, 10)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		UserID:  user.ID,
+		Event:   models.EventTokenExchange,
+		Details: details,
+	})
+
+	log.Info("token exchanged", slog.Int64("user_id", user.ID))
+
+	return models.ExchangedToken{Token: token, ExpiresAt: expiresAt, Scopes: scope}, nil
+}
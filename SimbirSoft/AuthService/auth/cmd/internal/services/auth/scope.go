@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+)
+
+// checkScope returns ErrUnknownScope if a requested scope is not one of the scopes of the realm
+// and ErrAdminScope if it is granted only to admins and the user is not one.
+func (a *Auth) checkScope(ctx context.Context, realm models.Realm, user models.User, scope []string) error {
+	if len(scope) == 0 {
+		return nil
+	}
+
+	grantable, err := a.realms.Scopes(ctx, realm.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range scope {
+		i := slices.IndexFunc(grantable, func(g models.Scope) bool { return g.Name == s })
+		if i < 0 {
+			return fmt.Errorf("%w: %q", ErrUnknownScope, s)
+		}
+		if grantable[i].AdminOnly && !user.IsAdmin {
+			return fmt.Errorf("%w: %q", ErrAdminScope, s)
+		}
+	}
+
+	return nil
+}
+
+// grantedScopes returns the scopes of the token the user still holds. Admin only scopes
+// are dropped once the user is no longer an admin: like revoke-admin, it takes effect
+// immediately and not when the token expires.
+func (a *Auth) grantedScopes(ctx context.Context, realm models.Realm, user models.User, scopes []string) ([]string, error) {
+	if len(scopes) == 0 || user.IsAdmin {
+		return scopes, nil
+	}
+
+	grantable, err := a.realms.Scopes(ctx, realm.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(scopes, func(s string) bool {
+		return slices.ContainsFunc(grantable, func(g models.Scope) bool { return g.Name == s && g.AdminOnly })
+	}), nil
+}
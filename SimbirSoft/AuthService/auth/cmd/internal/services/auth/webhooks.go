@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+)
+
+// Ограничения выдачи ListDeliveries
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// ListDeliveries returns the latest webhook deliveries of events of the realm, newest first.
+// An empty status means any, limit 0 means the default.
+func (a *Auth) ListDeliveries(ctx context.Context, realmName string, adminToken string, status string, limit int) ([]models.Delivery, error) {
+	const op = "Auth.ListDeliveries"
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.requireAdmin(ctx, realm, adminToken); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	limit = min(limit, maxDeliveriesLimit)
+
+	deliveries, err := a.deliveries.Deliveries(ctx, realm.ID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDelivery sends the delivery again with a fresh attempt budget, usually a dead one
+// after the receiver is fixed.
+func (a *Auth) ReplayDelivery(ctx context.Context, realmName string, adminToken string, id int64) error {
+	const op = "Auth.ReplayDelivery"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("realm", realmName),
+		slog.Int64("delivery_id", id),
+	)
+
+	realm, err := a.realm(ctx, realmName)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	admin, err := a.requireAdmin(ctx, realm, adminToken)
+	if err != nil {
+		log.Warn("replay denied", slog.String("err", err.Error()))
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.deliveries.ReplayDelivery(ctx, realm.ID, id); err != nil {
+		if errors.Is(err, storage.ErrDeliveryNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrDeliveryNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.recordAudit(ctx, models.AuditEvent{
+		UserID:  admin.ID,
+		Event:   models.EventWebhookReplay,
+		Details: map[string]string{"delivery_id": strconv.FormatInt(id, 10)},
+	})
+
+	log.Info("webhook delivery replayed", slog.Int64("admin_id", admin.ID))
+
+	return nil
+}
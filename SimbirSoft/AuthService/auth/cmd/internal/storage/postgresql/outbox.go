@@ -0,0 +1,244 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+)
+
+const (
+	insertEventCommand string = "INSERT INTO outbox(realm_id, event_type, user_id, data) VALUES($1, $2, $3, $4)"
+
+	// SKIP LOCKED: несколько экземпляров auth разбирают outbox, не мешая друг другу
+	undispatchedCommand   string = "SELECT id, event_type FROM outbox WHERE dispatched_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED"
+	saveDeliveryCommand   string = "INSERT INTO webhook_deliveries(event_id, endpoint) VALUES($1, $2) ON CONFLICT (event_id, endpoint) DO NOTHING"
+	markDispatchedCommand string = "UPDATE outbox SET dispatched_at = now() WHERE id = ANY($1)"
+
+	// Взятая доставка откладывается на lease: если экземпляр упадет, не дослав ее, ее возьмет другой
+	claimDeliveriesCommand string = `UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = now() + $2 * interval '1 millisecond'
+		FROM outbox o JOIN realms r ON r.id = o.realm_id
+		WHERE o.id = d.event_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + deliveryColumns
+	markDeliveredCommand string = "UPDATE webhook_deliveries SET status = 'delivered', delivered_at = now(), last_error = NULL WHERE id = $1"
+	markFailedCommand    string = "UPDATE webhook_deliveries SET status = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1"
+
+	deliveryColumns string = `d.id, d.endpoint, d.status, d.attempts, d.next_attempt_at, COALESCE(d.last_error, ''),
+		d.delivered_at, d.created_at, o.id, o.realm_id, r.name, o.event_type, COALESCE(o.user_id, 0), o.data, o.created_at`
+	listDeliveriesCommand string = `SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d JOIN outbox o ON o.id = d.event_id JOIN realms r ON r.id = o.realm_id
+		WHERE o.realm_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC LIMIT $3`
+	replayDeliveryCommand string = `UPDATE webhook_deliveries d
+		SET status = 'pending', attempts = 0, next_attempt_at = now(), last_error = NULL, delivered_at = NULL
+		FROM outbox o
+		WHERE d.id = $1 AND o.id = d.event_id AND o.realm_id = $2`
+)
+
+// insertEvent writes the event to the outbox within the transaction of the change.
+func insertEvent(ctx context.Context, tx *sql.Tx, realmID int64, eventType string, userID int64, data map[string]string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, insertEventCommand, realmID, eventType, userID, payload)
+
+	return err
+}
+
+// FanOutEvents creates a delivery for every endpoint route returns for the event type
+// and marks the events as dispatched. Returns the number of dispatched events.
+func (s *Storage) FanOutEvents(ctx context.Context, limit int, route func(eventType string) []string) (int, error) {
+	const op = "storage.postgresql.FanOutEvents"
+
+	ctx, span := startSpan(ctx, op, undispatchedCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, undispatchedCommand, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var ids []int64
+	var types []string
+	for rows.Next() {
+		var id int64
+		var eventType string
+		if err := rows.Scan(&id, &eventType); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+		types = append(types, eventType)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	for i, id := range ids {
+		for _, endpoint := range route(types[i]) {
+			if _, err := tx.ExecContext(ctx, saveDeliveryCommand, id, endpoint); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, markDispatchedCommand, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(ids), nil
+}
+
+// ClaimDeliveries takes due pending deliveries and counts the attempt. Until lease passes
+// nobody else takes them, a delivery which is neither delivered nor failed in time is retried.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.Delivery, error) {
+	const op = "storage.postgresql.ClaimDeliveries"
+
+	ctx, span := startSpan(ctx, op, claimDeliveriesCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, claimDeliveriesCommand, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+func (s *Storage) MarkDelivered(ctx context.Context, id int64) error {
+	const op = "storage.postgresql.MarkDelivered"
+
+	ctx, span := startSpan(ctx, op, markDeliveredCommand)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, markDeliveredCommand, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MarkFailed records the error of the attempt and schedules the next one, a dead delivery is not retried.
+func (s *Storage) MarkFailed(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time, dead bool) error {
+	const op = "storage.postgresql.MarkFailed"
+
+	ctx, span := startSpan(ctx, op, markFailedCommand)
+	defer span.End()
+
+	status := models.DeliveryPending
+	if dead {
+		status = models.DeliveryDead
+	}
+
+	if _, err := s.db.ExecContext(ctx, markFailedCommand, id, status, nextAttemptAt, lastErr); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Deliveries lists the latest deliveries of events of the realm, an empty status means any.
+func (s *Storage) Deliveries(ctx context.Context, realmID int64, status string, limit int) ([]models.Delivery, error) {
+	const op = "storage.postgresql.Deliveries"
+
+	ctx, span := startSpan(ctx, op, listDeliveriesCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, listDeliveriesCommand, realmID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDelivery schedules the delivery of an event of the realm again with a fresh attempt budget.
+func (s *Storage) ReplayDelivery(ctx context.Context, realmID int64, id int64) error {
+	const op = "storage.postgresql.ReplayDelivery"
+
+	ctx, span := startSpan(ctx, op, replayDeliveryCommand)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, replayDeliveryCommand, id, realmID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeliveryNotFound)
+	}
+
+	return nil
+}
+
+// scanDeliveries reads rows of deliveryColumns and closes them.
+func scanDeliveries(rows *sql.Rows) ([]models.Delivery, error) {
+	defer rows.Close()
+
+	var deliveries []models.Delivery
+	for rows.Next() {
+		var d models.Delivery
+		var deliveredAt sql.NullTime
+		var data []byte
+
+		err := rows.Scan(&d.ID, &d.Endpoint, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError,
+			&deliveredAt, &d.CreatedAt, &d.Event.ID, &d.Event.RealmID, &d.Event.Realm, &d.Event.Type,
+			&d.Event.UserID, &data, &d.Event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+
+		if err := json.Unmarshal(data, &d.Event.Data); err != nil {
+			return nil, fmt.Errorf("data of event %d: %w", d.Event.ID, err)
+		}
+
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -3,28 +3,94 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
-	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/jwt"
+	"github.com/lib/pq"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/keyring"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	Success string = "successfully registred"
 	Fail    string = "registration failed"
 
-	saveCommand   string = "INSERT INTO users(email, pass_hash) VALUES($1, $2)"
-	selectCommand string = "SELECT id, email, pass_hash FROM users WHERE email = $1"
-	secretCommand string = "SELECT id, secret FROM secrets WHERE id = $1"
+	saveCommand        string = "INSERT INTO users(realm_id, email, pass_hash) VALUES($1, $2, $3) RETURNING id"
+	selectCommand      string = "SELECT id, realm_id, email, pass_hash, is_admin, disabled FROM users WHERE realm_id = $1 AND email = $2"
+	selectByIDCommand  string = "SELECT id, realm_id, email, pass_hash, is_admin, disabled FROM users WHERE id = $1"
+	setAdminCommand    string = "UPDATE users SET is_admin = $3 WHERE realm_id = $1 AND email = $2"
+	changeEmailCommand string = "UPDATE users SET email = $3 WHERE realm_id = $1 AND email = $2 RETURNING id"
+	setDisabledCommand string = "UPDATE users SET disabled = $3 WHERE realm_id = $1 AND email = $2 AND disabled <> $3 RETURNING id"
+	existsCommand      string = "SELECT EXISTS(SELECT 1 FROM users WHERE realm_id = $1 AND email = $2)"
+	deleteUserCommand  string = "DELETE FROM users WHERE realm_id = $1 AND email = $2 RETURNING id"
+
+	realmColumns       string = "id, name, token_ttl_seconds, password_min_length, password_require_digit, password_require_upper, created_at"
+	realmCommand       string = "SELECT " + realmColumns + " FROM realms WHERE name = $1"
+	listRealmsCommand  string = "SELECT " + realmColumns + " FROM realms ORDER BY id"
+	saveRealmCommand   string = "INSERT INTO realms(name, token_ttl_seconds, password_min_length, password_require_digit, password_require_upper) VALUES($1, $2, $3, $4, $5) RETURNING id"
+	updateRealmCommand string = "UPDATE realms SET token_ttl_seconds = $2, password_min_length = $3, password_require_digit = $4, password_require_upper = $5 WHERE name = $1"
+
+	scopesCommand      string = "SELECT name, admin_only FROM scopes WHERE realm_id = $1 ORDER BY name"
+	saveScopeCommand   string = "INSERT INTO scopes(realm_id, name, admin_only) VALUES($1, $2, $3) ON CONFLICT (realm_id, name) DO UPDATE SET admin_only = EXCLUDED.admin_only"
+	deleteScopeCommand string = "DELETE FROM scopes WHERE realm_id = $1 AND name = $2"
+
+	appColumns       string = "id, realm_id, name, redirect_origins, token_ttl_seconds, binding_mode, enabled, created_at"
+	appCommand       string = "SELECT " + appColumns + " FROM apps WHERE id = $1"
+	listAppsCommand  string = "SELECT " + appColumns + " FROM apps WHERE realm_id = $1 ORDER BY id"
+	saveAppCommand   string = "INSERT INTO apps(realm_id, name, redirect_origins, token_ttl_seconds, binding_mode) VALUES($1, $2, $3, $4, $5) RETURNING " + appColumns
+	updateAppCommand string = "UPDATE apps SET redirect_origins = $3, token_ttl_seconds = $4, binding_mode = $5, enabled = $6 WHERE id = $1 AND realm_id = $2 RETURNING " + appColumns
+
+	secretCommand          string = "SELECT id, realm_id, COALESCE(app_id, 0), ciphertext, wrapped_key, key_id FROM secrets WHERE id = $1"
+	activeSecretCommand    string = "SELECT id, realm_id, COALESCE(app_id, 0), ciphertext, wrapped_key, key_id FROM secrets WHERE realm_id = $1 AND app_id IS NULL AND active"
+	activeAppSecretCommand string = "SELECT id, realm_id, COALESCE(app_id, 0), ciphertext, wrapped_key, key_id FROM secrets WHERE app_id = $1 AND active"
+	nextSecretIDCommand    string = "SELECT nextval('secrets_id_seq')" // ID шифруется вместе с секретом, поэтому берется заранее
+	saveSecretCommand      string = "INSERT INTO secrets(id, realm_id, ciphertext, wrapped_key, key_id, active) VALUES($1, $2, $3, $4, $5, $6)"
+	saveAppSecretCommand   string = "INSERT INTO secrets(id, realm_id, app_id, ciphertext, wrapped_key, key_id, active) VALUES($1, $2, $3, $4, $5, $6, TRUE)"
+	deactivateCommand      string = "UPDATE secrets SET active = FALSE WHERE realm_id = $1 AND app_id IS NULL AND active"
+	hasActiveCommand       string = "SELECT EXISTS(SELECT 1 FROM secrets WHERE realm_id = $1 AND app_id IS NULL AND active)"
+	listSecretsCommand     string = "SELECT id, key_id, active, created_at FROM secrets WHERE realm_id = $1 AND app_id IS NULL ORDER BY id"
+	lockSecretsCommand     string = "SELECT id, ciphertext, wrapped_key, key_id FROM secrets ORDER BY id FOR UPDATE"
+	rewrapCommand          string = "UPDATE secrets SET wrapped_key = $2, key_id = $3 WHERE id = $1"
+
+	// Открытые секреты остаются только между миграциями 3 и 11
+	hasPlaintextColumnCommand string = "SELECT EXISTS(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'secrets' AND column_name = 'secret')"
+	lockPlaintextCommand      string = "SELECT id, secret FROM secrets WHERE secret IS NOT NULL ORDER BY id FOR UPDATE"
+	sealPlaintextCommand      string = "UPDATE secrets SET ciphertext = $2, wrapped_key = $3, key_id = $4, secret = NULL WHERE id = $1"
+
+	revokeCommand    string = "INSERT INTO revoked_tokens(jti, expires_at) VALUES($1, $2) ON CONFLICT (jti) DO NOTHING"
+	isRevokedCommand string = "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)"
+
+	saveMagicLinkCommand string = "INSERT INTO magic_links(user_id, app_id, token_hash, expires_at) VALUES($1, $2, $3, $4)"
+	// Ссылка гасится тем же запросом, которым читается: повторное использование невозможно даже при гонке
+	consumeMagicLinkCommand string = `WITH consumed AS (
+		UPDATE magic_links SET consumed_at = now()
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > now()
+			AND user_id IN (SELECT id FROM users WHERE realm_id = $2)
+		RETURNING user_id, app_id
+	)
+	SELECT u.id, u.realm_id, u.email, u.pass_hash, u.disabled, COALESCE(c.app_id, 0) FROM users u JOIN consumed c ON c.user_id = u.id`
+
+	auditCommand string = "INSERT INTO audit_log(user_id, event, method, details) VALUES($1, $2, $3, $4)"
+
+	importUserCommand  string = "INSERT INTO users(realm_id, email, pass_hash) VALUES($1, $2, $3) ON CONFLICT (realm_id, email) DO NOTHING RETURNING id"
+	exportUsersCommand string = "SELECT id, realm_id, email, pass_hash FROM users WHERE realm_id = $1 ORDER BY id"
 )
 
+var tracer = otel.Tracer("gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql")
+
 type Storage struct {
-	db *sql.DB
+	db  *sql.DB
+	key *keyring.MasterKey // расшифровывает секреты подписи
 }
 
-func New(storagePath string) (*Storage, error) {
+func New(storagePath string, key *keyring.MasterKey) (*Storage, error) {
 	const op = "storage.postgresql.New"
 
 	db, err := sql.Open("postgres", storagePath)
@@ -32,62 +98,561 @@ func New(storagePath string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, key: key}, nil
 }
 
-func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (string, error) {
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// SaveUser creates the user and the user.registered event in one transaction.
+func (s *Storage) SaveUser(ctx context.Context, realmID int64, email string, passHash []byte) (string, error) {
 	const op = "storage.postgresql.SaveUser"
 
-	stmt, err := s.db.Prepare(saveCommand)
+	ctx, span := startSpan(ctx, op, saveCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key value") {
-			return Fail, fmt.Errorf("%s: %s", op, "user already exists")
-		}
+		return Fail, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
 
+	var id int64
+	if err := tx.QueryRowContext(ctx, saveCommand, realmID, email, passHash).Scan(&id); err != nil {
 		return Fail, fmt.Errorf("%s: %w", op, err)
 	}
 
-	res, err := stmt.ExecContext(ctx, email, passHash)
+	if err := insertEvent(ctx, tx, realmID, models.EventUserRegistered, id, map[string]string{"email": email}); err != nil {
+		return Fail, fmt.Errorf("%s: %w", op, err)
+	}
 
-	if err != nil {
-		return Fail, fmt.Errorf("%s, %s: %w", res, op, err)
+	if err := tx.Commit(); err != nil {
+		return Fail, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return Success, nil // Стрингу возвращать нехорошо
 }
 
-func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+func (s *Storage) User(ctx context.Context, realmID int64, email string) (models.User, error) {
 	const op = "storage.postgresql.User"
 
+	ctx, span := startSpan(ctx, op, selectCommand)
+	defer span.End()
+
 	stmt, err := s.db.Prepare(selectCommand)
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, email)
+	row := stmt.QueryRowContext(ctx, realmID, email)
 
 	var user models.User
-	err = row.Scan(&user.ID, &user.Email, &user.PassHash)
+	err = row.Scan(&user.ID, &user.RealmID, &user.Email, &user.PassHash, &user.IsAdmin, &user.Disabled)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return user, nil
 }
 
-// Secret returns Secret.
+func (s *Storage) UserByID(ctx context.Context, id int64) (models.User, error) {
+	const op = "storage.postgresql.UserByID"
+
+	ctx, span := startSpan(ctx, op, selectByIDCommand)
+	defer span.End()
+
+	var user models.User
+	err := s.db.QueryRowContext(ctx, selectByIDCommand, id).Scan(&user.ID, &user.RealmID, &user.Email, &user.PassHash, &user.IsAdmin, &user.Disabled)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// SetAdmin grants or revokes the admin role.
+func (s *Storage) SetAdmin(ctx context.Context, realmID int64, email string, isAdmin bool) error {
+	const op = "storage.postgresql.SetAdmin"
+
+	ctx, span := startSpan(ctx, op, setAdminCommand)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, setAdminCommand, realmID, email, isAdmin)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ChangeEmail changes the email of the user and writes the user.email_changed event.
+// Returns storage.ErrUserExists if the new email is taken in the realm.
+func (s *Storage) ChangeEmail(ctx context.Context, realmID int64, email string, newEmail string) error {
+	const op = "storage.postgresql.ChangeEmail"
+
+	ctx, span := startSpan(ctx, op, changeEmailCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, changeEmailCommand, realmID, email, newEmail).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	data := map[string]string{"old_email": email, "email": newEmail}
+	if err := insertEvent(ctx, tx, realmID, models.EventUserEmailChanged, id, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetDisabled disables or enables the user and writes the user.disabled or user.enabled event.
+// Setting the current state again is a no-op without an event.
+func (s *Storage) SetDisabled(ctx context.Context, realmID int64, email string, disabled bool) error {
+	const op = "storage.postgresql.SetDisabled"
+
+	ctx, span := startSpan(ctx, op, setDisabledCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, setDisabledCommand, realmID, email, disabled).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, existsCommand, realmID, email).Scan(&exists); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !exists {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	event := models.EventUserEnabled
+	if disabled {
+		event = models.EventUserDisabled
+	}
+	if err := insertEvent(ctx, tx, realmID, event, id, map[string]string{"email": email}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user with its magic links and writes the user.deleted event.
+func (s *Storage) DeleteUser(ctx context.Context, realmID int64, email string) error {
+	const op = "storage.postgresql.DeleteUser"
+
+	ctx, span := startSpan(ctx, op, deleteUserCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, deleteUserCommand, realmID, email).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertEvent(ctx, tx, realmID, models.EventUserDeleted, id, map[string]string{"email": email}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Realm returns the realm by name, storage.ErrRealmNotFound if there is none.
+func (s *Storage) Realm(ctx context.Context, name string) (models.Realm, error) {
+	const op = "storage.postgresql.Realm"
+
+	ctx, span := startSpan(ctx, op, realmCommand)
+	defer span.End()
+
+	realm, err := scanRealm(s.db.QueryRowContext(ctx, realmCommand, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Realm{}, fmt.Errorf("%s: %w", op, storage.ErrRealmNotFound)
+		}
+
+		return models.Realm{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return realm, nil
+}
+
+func (s *Storage) Realms(ctx context.Context) ([]models.Realm, error) {
+	const op = "storage.postgresql.Realms"
+
+	ctx, span := startSpan(ctx, op, listRealmsCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, listRealmsCommand)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var realms []models.Realm
+	for rows.Next() {
+		realm, err := scanRealm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		realms = append(realms, realm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return realms, nil
+}
+
+// SaveRealm creates a realm, storage.ErrRealmExists if the name is taken.
+func (s *Storage) SaveRealm(ctx context.Context, realm models.Realm) (int64, error) {
+	const op = "storage.postgresql.SaveRealm"
+
+	ctx, span := startSpan(ctx, op, saveRealmCommand)
+	defer span.End()
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, saveRealmCommand, realm.Name, ttlSeconds(realm.TokenTTL),
+		realm.Password.MinLength, realm.Password.RequireDigit, realm.Password.RequireUpper).Scan(&id)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrRealmExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpdateRealm replaces the token TTL and the password policy of the realm.
+func (s *Storage) UpdateRealm(ctx context.Context, realm models.Realm) error {
+	const op = "storage.postgresql.UpdateRealm"
+
+	ctx, span := startSpan(ctx, op, updateRealmCommand)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, updateRealmCommand, realm.Name, ttlSeconds(realm.TokenTTL),
+		realm.Password.MinLength, realm.Password.RequireDigit, realm.Password.RequireUpper)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRealmNotFound)
+	}
+
+	return nil
+}
+
+// Scopes returns the scopes Login may grant in the realm.
+func (s *Storage) Scopes(ctx context.Context, realmID int64) ([]models.Scope, error) {
+	const op = "storage.postgresql.Scopes"
+
+	ctx, span := startSpan(ctx, op, scopesCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, scopesCommand, realmID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var scopes []models.Scope
+	for rows.Next() {
+		var scope models.Scope
+		if err := rows.Scan(&scope.Name, &scope.AdminOnly); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		scopes = append(scopes, scope)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return scopes, nil
+}
+
+// SaveScope adds the scope to the realm or changes whether it is admin only.
+func (s *Storage) SaveScope(ctx context.Context, realmID int64, scope models.Scope) error {
+	const op = "storage.postgresql.SaveScope"
+
+	ctx, span := startSpan(ctx, op, saveScopeCommand)
+	defer span.End()
+
+	if _, err := s.db.ExecContext(ctx, saveScopeCommand, realmID, scope.Name, scope.AdminOnly); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteScope removes the scope from the realm, storage.ErrScopeNotFound if there is none.
+// Issued tokens keep it until they expire.
+func (s *Storage) DeleteScope(ctx context.Context, realmID int64, name string) error {
+	const op = "storage.postgresql.DeleteScope"
+
+	ctx, span := startSpan(ctx, op, deleteScopeCommand)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, deleteScopeCommand, realmID, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrScopeNotFound)
+	}
+
+	return nil
+}
+
+func scanRealm(row interface{ Scan(dest ...any) error }) (models.Realm, error) {
+	var realm models.Realm
+	var ttl sql.NullInt64
+
+	err := row.Scan(&realm.ID, &realm.Name, &ttl, &realm.Password.MinLength,
+		&realm.Password.RequireDigit, &realm.Password.RequireUpper, &realm.CreatedAt)
+	if err != nil {
+		return models.Realm{}, err
+	}
+
+	realm.TokenTTL = time.Duration(ttl.Int64) * time.Second
+
+	return realm, nil
+}
+
+// ttlSeconds stores an unset TTL as NULL.
+func ttlSeconds(ttl time.Duration) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(ttl / time.Second), Valid: ttl > 0}
+}
+
+// App returns the app by ID, storage.ErrAppNotFound if there is none.
+func (s *Storage) App(ctx context.Context, id int64) (models.App, error) {
+	const op = "storage.postgresql.App"
+
+	ctx, span := startSpan(ctx, op, appCommand)
+	defer span.End()
+
+	app, err := scanApp(s.db.QueryRowContext(ctx, appCommand, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+func (s *Storage) Apps(ctx context.Context, realmID int64) ([]models.App, error) {
+	const op = "storage.postgresql.Apps"
+
+	ctx, span := startSpan(ctx, op, listAppsCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, listAppsCommand, realmID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// SaveApp creates the app together with its active signing secret,
+// storage.ErrAppExists if the realm already has an app with this name.
+func (s *Storage) SaveApp(ctx context.Context, app models.App, secret []byte) (models.App, error) {
+	const op = "storage.postgresql.SaveApp"
+
+	ctx, span := startSpan(ctx, op, saveAppCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	saved, err := scanApp(tx.QueryRowContext(ctx, saveAppCommand, app.RealmID, app.Name,
+		pq.Array(app.RedirectOrigins), ttlSeconds(app.TokenTTL), bindingMode(app.Binding)))
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secretID, sealed, err := s.sealNew(ctx, tx, secret)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, saveAppSecretCommand, secretID, saved.RealmID, saved.ID, sealed.Ciphertext, sealed.WrappedKey, sealed.KeyID)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return saved, nil
+}
+
+// UpdateApp replaces the redirect origins, the token TTL, the binding mode and the enabled flag of the app of the realm.
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "storage.postgresql.UpdateApp"
+
+	ctx, span := startSpan(ctx, op, updateAppCommand)
+	defer span.End()
+
+	updated, err := scanApp(s.db.QueryRowContext(ctx, updateAppCommand, app.ID, app.RealmID,
+		pq.Array(app.RedirectOrigins), ttlSeconds(app.TokenTTL), bindingMode(app.Binding), app.Enabled))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
+func scanApp(row interface{ Scan(dest ...any) error }) (models.App, error) {
+	var app models.App
+	var ttl sql.NullInt64
+
+	err := row.Scan(&app.ID, &app.RealmID, &app.Name, pq.Array(&app.RedirectOrigins), &ttl, &app.Binding, &app.Enabled, &app.CreatedAt)
+	if err != nil {
+		return models.App{}, err
+	}
+	app.TokenTTL = time.Duration(ttl.Int64) * time.Second
+
+	return app, nil
+}
+
+// bindingMode stores an empty mode as models.BindingNone.
+func bindingMode(mode string) string {
+	if mode == "" {
+		return models.BindingNone
+	}
+
+	return mode
+}
+
+// nullID stores 0 as NULL for optional references.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// Secret returns the decrypted signing secret.
 func (s *Storage) Secret(ctx context.Context, id int) (models.Secret, error) {
-	const op = "storage.sqlite.Secret"
+	const op = "storage.postgresql.Secret"
+
+	ctx, span := startSpan(ctx, op, secretCommand)
+	defer span.End()
 
-	stmt, err := s.db.Prepare(secretCommand)
+	sec, err := s.scanSecret(s.db.QueryRowContext(ctx, secretCommand, id))
 	if err != nil {
 		return models.Secret{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, id)
+	return sec, nil
+}
+
+// ActiveSecret returns the decrypted secret new tokens of the realm are signed with.
+func (s *Storage) ActiveSecret(ctx context.Context, realmID int64) (models.Secret, error) {
+	const op = "storage.postgresql.ActiveSecret"
+
+	ctx, span := startSpan(ctx, op, activeSecretCommand)
+	defer span.End()
 
-	var sec models.Secret
-	err = row.Scan(&sec.ID, &sec.Secret)
+	sec, err := s.scanSecret(s.db.QueryRowContext(ctx, activeSecretCommand, realmID))
 	if err != nil {
 		return models.Secret{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -95,21 +660,423 @@ func (s *Storage) Secret(ctx context.Context, id int) (models.Secret, error) {
 	return sec, nil
 }
 
-func (s *Storage) GetPayload(ctx context.Context, payload *jwt.MyClaims) (models.User, error) {
-	const op = "storage.sqlite.GetPayload"
+// ActiveAppSecret returns the decrypted secret tokens of the app are signed with.
+func (s *Storage) ActiveAppSecret(ctx context.Context, appID int64) (models.Secret, error) {
+	const op = "storage.postgresql.ActiveAppSecret"
 
-	stmt, err := s.db.Prepare("SELECT id FROM users WHERE email = $1")
+	ctx, span := startSpan(ctx, op, activeAppSecretCommand)
+	defer span.End()
+
+	sec, err := s.scanSecret(s.db.QueryRowContext(ctx, activeAppSecretCommand, appID))
 	if err != nil {
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.Secret{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sec, nil
+}
+
+// SaveSecret encrypts and stores a new secret of the realm. With activate it replaces the active one,
+// otherwise it becomes active only if the realm has no active secret yet.
+func (s *Storage) SaveSecret(ctx context.Context, realmID int64, secret []byte, activate bool) (int64, error) {
+	const op = "storage.postgresql.SaveSecret"
+
+	ctx, span := startSpan(ctx, op, saveSecretCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if activate {
+		if _, err := tx.ExecContext(ctx, deactivateCommand, realmID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		var hasActive bool
+		if err := tx.QueryRowContext(ctx, hasActiveCommand, realmID).Scan(&hasActive); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		activate = !hasActive
+	}
+
+	id, sealed, err := s.sealNew(ctx, tx, secret)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, saveSecretCommand, id, realmID, sealed.Ciphertext, sealed.WrappedKey, sealed.KeyID, activate)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Secrets lists secrets metadata of the realm, the secrets themselves are not decrypted.
+func (s *Storage) Secrets(ctx context.Context, realmID int64) ([]models.SecretInfo, error) {
+	const op = "storage.postgresql.Secrets"
+
+	ctx, span := startSpan(ctx, op, listSecretsCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, listSecretsCommand, realmID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var secrets []models.SecretInfo
+	for rows.Next() {
+		var info models.SecretInfo
+		if err := rows.Scan(&info.ID, &info.KeyID, &info.Active, &info.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		secrets = append(secrets, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return secrets, nil
+}
+
+// RewrapSecrets re-encrypts the data keys of all secrets under the new master key
+// in a single transaction. Returns the number of re-encrypted secrets.
+func (s *Storage) RewrapSecrets(ctx context.Context, newKey *keyring.MasterKey) (int, error) {
+	const op = "storage.postgresql.RewrapSecrets"
+
+	ctx, span := startSpan(ctx, op, rewrapCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, lockSecretsCommand)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var ids []int64
+	var sealed []keyring.Sealed
+	for rows.Next() {
+		var id int64
+		var sec keyring.Sealed
+		if err := rows.Scan(&id, &sec.Ciphertext, &sec.WrappedKey, &sec.KeyID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+		sealed = append(sealed, sec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, sec := range sealed {
+		rewrapped, err := s.key.Rewrap(ids[i], sec, newKey)
+		if err != nil {
+			return 0, fmt.Errorf("%s: secret %d: %w", op, ids[i], err)
+		}
+
+		if _, err := tx.ExecContext(ctx, rewrapCommand, ids[i], rewrapped.WrappedKey, rewrapped.KeyID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(ids), nil
+}
+
+// EncryptPlaintextSecrets encrypts the secrets still stored in plaintext by
+// 3_encrypted_secrets in a single transaction. Returns the number of encrypted secrets,
+// 0 once migration 11 has dropped the plaintext column.
+func (s *Storage) EncryptPlaintextSecrets(ctx context.Context) (int, error) {
+	const op = "storage.postgresql.EncryptPlaintextSecrets"
+
+	ctx, span := startSpan(ctx, op, sealPlaintextCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var hasPlaintext bool
+	if err := tx.QueryRowContext(ctx, hasPlaintextColumnCommand).Scan(&hasPlaintext); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !hasPlaintext {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, lockPlaintextCommand)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var ids []int64
+	var secrets []string
+	for rows.Next() {
+		var id int64
+		var secret string
+		if err := rows.Scan(&id, &secret); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+		secrets = append(secrets, secret)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, secret := range secrets {
+		sealed, err := s.key.Seal(ids[i], []byte(secret))
+		if err != nil {
+			return 0, fmt.Errorf("%s: secret %d: %w", op, ids[i], err)
+		}
+
+		if _, err := tx.ExecContext(ctx, sealPlaintextCommand, ids[i], sealed.Ciphertext, sealed.WrappedKey, sealed.KeyID); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
-	row := stmt.QueryRowContext(ctx, payload.Email)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(ids), nil
+}
+
+// sealNew reserves the ID of a new secret and encrypts the secret for it.
+func (s *Storage) sealNew(ctx context.Context, tx *sql.Tx, secret []byte) (int64, keyring.Sealed, error) {
+	var id int64
+	if err := tx.QueryRowContext(ctx, nextSecretIDCommand).Scan(&id); err != nil {
+		return 0, keyring.Sealed{}, err
+	}
+
+	sealed, err := s.key.Seal(id, secret)
+	if err != nil {
+		return 0, keyring.Sealed{}, err
+	}
+
+	return id, sealed, nil
+}
+
+func (s *Storage) scanSecret(row *sql.Row) (models.Secret, error) {
+	var id, realmID, appID int64
+	var sealed keyring.Sealed
+	err := row.Scan(&id, &realmID, &appID, &sealed.Ciphertext, &sealed.WrappedKey, &sealed.KeyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Secret{}, storage.ErrSecretNotFound
+		}
+
+		return models.Secret{}, err
+	}
+
+	secret, err := s.key.Open(id, sealed)
+	if err != nil {
+		return models.Secret{}, err
+	}
+
+	return models.Secret{ID: id, RealmID: realmID, AppID: appID, Secret: string(secret)}, nil
+}
+
+// RevokeToken remembers the token ID until the token expires.
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.postgresql.RevokeToken"
+
+	ctx, span := startSpan(ctx, op, revokeCommand)
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, revokeCommand, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.postgresql.IsTokenRevoked"
+
+	ctx, span := startSpan(ctx, op, isRevokedCommand)
+	defer span.End()
+
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, isRevokedCommand, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// SaveMagicLink stores the link, appID is 0 if the token is not issued for an app.
+func (s *Storage) SaveMagicLink(ctx context.Context, userID int64, appID int64, tokenHash []byte, expiresAt time.Time) error {
+	const op = "storage.postgresql.SaveMagicLink"
+
+	ctx, span := startSpan(ctx, op, saveMagicLinkCommand)
+	defer span.End()
+
+	_, err := s.db.ExecContext(ctx, saveMagicLinkCommand, userID, nullID(appID), tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink marks the link of a user of the realm as used and returns the user
+// and the app the link was requested for (0 if none).
+// Returns storage.ErrMagicLinkNotFound for unknown, expired and already used links.
+func (s *Storage) ConsumeMagicLink(ctx context.Context, realmID int64, tokenHash []byte) (models.User, int64, error) {
+	const op = "storage.postgresql.ConsumeMagicLink"
+
+	ctx, span := startSpan(ctx, op, consumeMagicLinkCommand)
+	defer span.End()
 
 	var user models.User
-	err = row.Scan(&user.ID)
+	var appID int64
+	err := s.db.QueryRowContext(ctx, consumeMagicLinkCommand, tokenHash, realmID).Scan(&user.ID, &user.RealmID, &user.Email, &user.PassHash, &user.Disabled, &appID)
 	if err != nil {
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, 0, fmt.Errorf("%s: %w", op, storage.ErrMagicLinkNotFound)
+		}
+
+		return models.User{}, 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return user, nil
+	return user, appID, nil
+}
+
+func (s *Storage) RecordAudit(ctx context.Context, event models.AuditEvent) error {
+	const op = "storage.postgresql.RecordAudit"
+
+	ctx, span := startSpan(ctx, op, auditCommand)
+	defer span.End()
+
+	details := []byte("{}")
+	if len(event.Details) > 0 {
+		var err error
+		details, err = json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var userID sql.NullInt64
+	if event.UserID != 0 {
+		userID = sql.NullInt64{Int64: event.UserID, Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, auditCommand, userID, event.Event, event.Method, details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ImportUsers inserts users of the realm with ready password hashes in one transaction,
+// with a user.registered event for every created user.
+// The returned slice has an entry per user: nil or storage.ErrUserExists.
+func (s *Storage) ImportUsers(ctx context.Context, realmID int64, users []models.User) ([]error, error) {
+	const op = "storage.postgresql.ImportUsers"
+
+	ctx, span := startSpan(ctx, op, importUserCommand)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, importUserCommand)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	results := make([]error, len(users))
+	for i, user := range users {
+		var id int64
+		err := stmt.QueryRowContext(ctx, realmID, user.Email, user.PassHash).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			results[i] = storage.ErrUserExists
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := insertEvent(ctx, tx, realmID, models.EventUserRegistered, id, map[string]string{"email": user.Email}); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// ForEachUser streams all users of the realm ordered by id.
+func (s *Storage) ForEachUser(ctx context.Context, realmID int64, fn func(models.User) error) error {
+	const op = "storage.postgresql.ForEachUser"
+
+	ctx, span := startSpan(ctx, op, exportUsersCommand)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, exportUsersCommand, realmID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.RealmID, &user.Email, &user.PassHash); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// startSpan opens a client span for a single SQL statement.
+func startSpan(ctx context.Context, op string, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(query),
+		),
+	)
 }
@@ -7,4 +7,18 @@ var (
 
 	ErrUserNotFound  = errors.New("user not found")
 	ErrUserNotFound2 = errors.New("crypto/bcrypt: hashedPassword is not the hash of the given password")
+
+	ErrSecretNotFound = errors.New("secret not found")
+
+	ErrMagicLinkNotFound = errors.New("magic link not found, expired or already used")
+
+	ErrRealmNotFound = errors.New("realm not found")
+	ErrRealmExists   = errors.New("realm already exists")
+
+	ErrScopeNotFound = errors.New("scope not found")
+
+	ErrAppNotFound = errors.New("app not found")
+	ErrAppExists   = errors.New("app already exists")
+
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
 )
@@ -0,0 +1,205 @@
+// Package webhooks delivers domain events from the outbox to the configured endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/metrics"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/webhook"
+)
+
+// Сколько байт ответа сохраняем в last_error
+const maxErrorBody = 512
+
+type Storage interface {
+	FanOutEvents(ctx context.Context, limit int, route func(eventType string) []string) (int, error)
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.Delivery, error)
+	MarkDelivered(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time, dead bool) error
+}
+
+type endpoint struct {
+	secret []byte
+	events []string
+}
+
+type Dispatcher struct {
+	log       *slog.Logger
+	storage   Storage
+	cfg       config.WebhooksConfig
+	endpoints map[string]endpoint
+	client    *http.Client
+}
+
+// New checks that every endpoint has its secret in the environment.
+func New(log *slog.Logger, storage Storage, cfg config.WebhooksConfig) (*Dispatcher, error) {
+	const op = "webhooks.New"
+
+	endpoints := make(map[string]endpoint, len(cfg.Endpoints))
+	for _, e := range cfg.Endpoints {
+		secret := os.Getenv(e.SecretEnv)
+		if e.SecretEnv == "" || secret == "" {
+			return nil, fmt.Errorf("%s: webhook %s: secret_env is not set", op, e.URL)
+		}
+
+		endpoints[e.URL] = endpoint{secret: []byte(secret), events: e.Events}
+	}
+
+	return &Dispatcher{
+		log:       log.With(slog.String("component", "webhooks")),
+		storage:   storage,
+		cfg:       cfg,
+		endpoints: endpoints,
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Run polls the outbox until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.log.Info("webhook dispatcher started", slog.Int("endpoints", len(d.endpoints)))
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.log.Info("webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			d.tick(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) tick(ctx context.Context) {
+	// события без подписчиков тоже отмечаются, иначе outbox будет перечитываться вечно
+	if _, err := d.storage.FanOutEvents(ctx, d.cfg.BatchSize, d.route); err != nil {
+		d.log.Error("failed to fan out events", slog.String("err", err.Error()))
+	}
+
+	// пока запросы идут, доставку не должен взять другой экземпляр
+	lease := d.cfg.Timeout*time.Duration(d.cfg.BatchSize) + d.cfg.PollInterval
+
+	deliveries, err := d.storage.ClaimDeliveries(ctx, d.cfg.BatchSize, lease)
+	if err != nil {
+		d.log.Error("failed to claim deliveries", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.deliver(ctx, delivery)
+	}
+}
+
+// route returns the endpoints subscribed to the event type.
+func (d *Dispatcher) route(eventType string) []string {
+	var urls []string
+	for url, e := range d.endpoints {
+		if len(e.events) == 0 || slices.Contains(e.events, eventType) {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.Delivery) {
+	log := d.log.With(
+		slog.Int64("delivery_id", delivery.ID),
+		slog.Int64("event_id", delivery.Event.ID),
+		slog.String("endpoint", delivery.Endpoint),
+		slog.Int("attempt", delivery.Attempts),
+	)
+
+	err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.storage.MarkDelivered(ctx, delivery.ID); err != nil {
+			log.Error("failed to mark delivery as delivered", slog.String("err", err.Error()))
+		}
+		metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookDelivered).Inc()
+
+		return
+	}
+
+	dead := delivery.Attempts >= d.cfg.MaxAttempts
+	next := time.Now().Add(backoff(delivery.Attempts, d.cfg.RetryBaseDelay, d.cfg.RetryMaxDelay))
+
+	if dead {
+		log.Warn("webhook delivery is dead", slog.String("err", err.Error()))
+		metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookDead).Inc()
+	} else {
+		log.Info("webhook delivery failed, will retry", slog.Time("next_attempt_at", next), slog.String("err", err.Error()))
+		metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookRetry).Inc()
+	}
+
+	if err := d.storage.MarkFailed(ctx, delivery.ID, err.Error(), next, dead); err != nil {
+		log.Error("failed to record delivery failure", slog.String("err", err.Error()))
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery models.Delivery) error {
+	e, ok := d.endpoints[delivery.Endpoint]
+	if !ok {
+		return fmt.Errorf("endpoint %s is not configured anymore", delivery.Endpoint)
+	}
+
+	body, err := json.Marshal(webhook.Event{
+		ID:         delivery.Event.ID,
+		Type:       delivery.Event.Type,
+		Realm:      delivery.Event.Realm,
+		UserID:     delivery.Event.UserID,
+		Data:       delivery.Event.Data,
+		OccurredAt: delivery.Event.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.HeaderID, strconv.FormatInt(delivery.Event.ID, 10))
+	req.Header.Set(webhook.HeaderEvent, delivery.Event.Type)
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(e.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the given failed attempt: base, 2*base, 4*base... up to maxDelay.
+func backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
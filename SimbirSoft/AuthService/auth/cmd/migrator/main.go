@@ -2,33 +2,87 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
 )
 
+const usage = `Usage: migrator [flags] <command> [args]
+
+Commands:
+  up [N]       apply all or N pending migrations (default command)
+  down [N]     roll back N migrations, all of them with -all
+  goto V       migrate up or down to version V
+  up-to V      apply pending migrations up to version V, never rolls back
+  version      print the current version
+  force V      set version V without running migrations, clears the dirty flag
+  status       list applied and pending migrations
+  create NAME  create the next numbered up/down files
+
+Flags:
+`
+
 func main() {
-	var storagePath, migrationsPath, migrationsTable string
+	var configPath, storagePath, migrationsPath, migrationsTable string
+	var dryRun, all bool
 
-	flag.StringVar(&storagePath, "storage-path", "", "path to storage")
-	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
-	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "name of migrations table")
+	flag.StringVar(&configPath, "config", os.Getenv("CONFIG_PATH"), "path to the server config file, storage_path is used as DSN")
+	flag.StringVar(&storagePath, "storage-path", "", "DSN, overrides the config file")
+	flag.StringVar(&migrationsPath, "migrations-path", "./migrations", "path to migrations")
+	flag.StringVar(&migrationsTable, "migrations-table", postgres.DefaultMigrationsTable, "name of migrations table")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the SQL of up, down and goto instead of running it")
+	flag.BoolVar(&all, "all", false, "allow down without N to roll back every migration")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	cmd, args := "up", flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	// create не требует подключения к базе
+	if cmd == "create" {
+		if len(args) != 1 {
+			log.Fatal("create: migration name is required")
+		}
+
+		up, down, err := createMigration(migrationsPath, args[0])
+		if err != nil {
+			log.Fatalf("create: %v", err)
+		}
+
+		fmt.Println(up)
+		fmt.Println(down)
+		return
+	}
+
 	if storagePath == "" {
-		log.Fatal("storage-path is required")
+		if configPath == "" {
+			log.Fatal("either --config (CONFIG_PATH) or --storage-path is required")
+		}
+		storagePath = config.MustLoadByPath(configPath).StoragePath
 	}
-	if migrationsPath == "" {
-		log.Fatal("migrations-path is required")
+
+	db, err := openDB(storagePath)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
 	}
+	defer db.Close()
 
 	// Создаем экземпляр драйвера для подключения к PostgreSQL
-	driver, err := postgres.WithInstance(openDB(storagePath), &postgres.Config{})
+	driver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: migrationsTable})
 	if err != nil {
 		log.Fatalf("failed to create database instance: %v", err)
 	}
@@ -41,24 +95,122 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to create migrator: %v", err)
 	}
+	m.Log = logger{}
 
-	// Применяем миграции
-	if err := m.Up(); err != nil {
-		if err == migrate.ErrNoChange {
-			fmt.Println("no migrations to apply")
-			return
+	r := runner{m: m, migrationsPath: migrationsPath, dryRun: dryRun}
+
+	switch cmd {
+	case "up":
+		n, err := optionalCount(args)
+		if err != nil {
+			log.Fatalf("up: %v", err)
+		}
+		err = r.up(n)
+		report("up", err)
+	case "down":
+		n, err := optionalCount(args)
+		if err != nil {
+			log.Fatalf("down: %v", err)
+		}
+		if n == 0 && !all {
+			log.Fatal("down: pass N or -all to roll back every migration")
 		}
-		log.Fatalf("failed to apply migrations: %v", err)
+		err = r.down(n)
+		report("down", err)
+	case "goto":
+		v, err := requiredVersion(args)
+		if err != nil {
+			log.Fatalf("goto: %v", err)
+		}
+		err = r.goTo(v)
+		report("goto", err)
+	case "up-to":
+		v, err := requiredVersion(args)
+		if err != nil {
+			log.Fatalf("up-to: %v", err)
+		}
+		err = r.upTo(v)
+		report("up-to", err)
+	case "version":
+		err = r.version()
+		report("version", err)
+	case "force":
+		if len(args) != 1 {
+			log.Fatal("force: version is required")
+		}
+		// -1 означает "ни одна миграция не применена"
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < -1 {
+			log.Fatalf("force: invalid version %q", args[0])
+		}
+		err = m.Force(v)
+		report("force", err)
+	case "status":
+		err = r.status()
+		report("status", err)
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
+}
 
-	fmt.Println("migrations applied successfully")
+func report(cmd string, err error) {
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no migrations to apply")
+		return
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", cmd, err)
+	}
+}
+
+func optionalCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid number of migrations %q", args[0])
+	}
+
+	return n, nil
+}
+
+func requiredVersion(args []string) (uint, error) {
+	if len(args) != 1 {
+		return 0, errors.New("version is required")
+	}
+
+	v, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", args[0])
+	}
+
+	return uint(v), nil
 }
 
 // openDB открывает соединение с базой данных
-func openDB(dsn string) *sql.DB {
+func openDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return db
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type logger struct{}
+
+func (logger) Printf(format string, v ...any) {
+	fmt.Printf(format, v...)
+}
+
+func (logger) Verbose() bool {
+	return false
 }
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// migrationFiles - пара файлов одной версии
+type migrationFiles struct {
+	version    uint
+	identifier string
+	up         string
+	down       string
+}
+
+type runner struct {
+	m              *migrate.Migrate
+	migrationsPath string
+	dryRun         bool
+}
+
+func (r runner) up(n int) error {
+	if !r.dryRun {
+		if n == 0 {
+			return r.m.Up()
+		}
+		return r.m.Steps(n)
+	}
+
+	current, ok, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	files, err := readMigrations(r.migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	var plan []string
+	for _, f := range files {
+		if ok && f.version <= current {
+			continue
+		}
+		if n > 0 && len(plan) == n {
+			break
+		}
+		plan = append(plan, f.up)
+	}
+
+	return r.print(plan)
+}
+
+func (r runner) down(n int) error {
+	if !r.dryRun {
+		if n == 0 {
+			return r.m.Down()
+		}
+		return r.m.Steps(-n)
+	}
+
+	current, ok, err := r.current()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return migrate.ErrNoChange
+	}
+
+	files, err := readMigrations(r.migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	var plan []string
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		if f.version > current {
+			continue
+		}
+		if n > 0 && len(plan) == n {
+			break
+		}
+		plan = append(plan, f.down)
+	}
+
+	return r.print(plan)
+}
+
+func (r runner) goTo(version uint) error {
+	if !r.dryRun {
+		return r.m.Migrate(version)
+	}
+
+	current, ok, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	files, err := readMigrations(r.migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(files, func(f migrationFiles) bool { return f.version == version }) {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	var plan []string
+	switch {
+	case !ok || version > current:
+		for _, f := range files {
+			if (!ok || f.version > current) && f.version <= version {
+				plan = append(plan, f.up)
+			}
+		}
+	case version < current:
+		for i := len(files) - 1; i >= 0; i-- {
+			f := files[i]
+			if f.version > version && f.version <= current {
+				plan = append(plan, f.down)
+			}
+		}
+	}
+
+	return r.print(plan)
+}
+
+// upTo is goTo for deployments that may already be past the version: it only migrates up.
+func (r runner) upTo(version uint) error {
+	current, ok, err := r.current()
+	if err != nil {
+		return err
+	}
+	if ok && current >= version {
+		return migrate.ErrNoChange
+	}
+
+	return r.goTo(version)
+}
+
+func (r runner) version() error {
+	version, dirty, err := r.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("no migrations applied")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Printf("%d (dirty)\n", version)
+		return nil
+	}
+
+	fmt.Println(version)
+	return nil
+}
+
+func (r runner) status() error {
+	version, dirty, err := r.m.Version()
+	applied := err == nil
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return err
+	}
+
+	files, err := readMigrations(r.migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+	for _, f := range files {
+		state := "pending"
+		switch {
+		case applied && f.version == version && dirty:
+			state = "dirty"
+		case applied && f.version <= version:
+			state = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", f.version, f.identifier, state)
+	}
+
+	return w.Flush()
+}
+
+// current returns the applied version, ok is false if nothing is applied yet.
+// A dirty database is an error, the same way migrate itself refuses to run.
+func (r runner) current() (uint, bool, error) {
+	version, dirty, err := r.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if dirty {
+		return 0, false, migrate.ErrDirty{Version: int(version)}
+	}
+
+	return version, true, nil
+}
+
+func (r runner) print(files []string) error {
+	if len(files) == 0 {
+		return migrate.ErrNoChange
+	}
+
+	for _, name := range files {
+		if name == "" {
+			return errors.New("migration file is missing")
+		}
+
+		sql, err := os.ReadFile(filepath.Join(r.migrationsPath, name))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("-- %s\n%s\n", name, strings.TrimRight(string(sql), "\r\n"))
+	}
+
+	return nil
+}
+
+// readMigrations returns migrations sorted by version.
+func readMigrations(dir string) ([]migrationFiles, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*migrationFiles)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		m, err := source.Parse(e.Name())
+		if err != nil {
+			continue
+		}
+
+		f, ok := byVersion[m.Version]
+		if !ok {
+			f = &migrationFiles{version: m.Version, identifier: m.Identifier}
+			byVersion[m.Version] = f
+		}
+
+		switch m.Direction {
+		case source.Up:
+			f.up = e.Name()
+		case source.Down:
+			f.down = e.Name()
+		}
+	}
+
+	files := make([]migrationFiles, 0, len(byVersion))
+	for _, f := range byVersion {
+		files = append(files, *f)
+	}
+	slices.SortFunc(files, func(a, b migrationFiles) int { return int(a.version) - int(b.version) })
+
+	return files, nil
+}
+
+// createMigration creates empty up/down files with the next version number.
+func createMigration(dir, name string) (string, string, error) {
+	if !migrationName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid name %q, use lowercase letters, digits and underscores", name)
+	}
+
+	files, err := readMigrations(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	next := uint(1)
+	if len(files) > 0 {
+		next = files[len(files)-1].version + 1
+	}
+
+	up := filepath.Join(dir, fmt.Sprintf("%d_%s.up.sql", next, name))
+	down := filepath.Join(dir, fmt.Sprintf("%d_%s.down.sql", next, name))
+
+	for _, path := range []string{up, down} {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		f.Close()
+	}
+
+	return up, down, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/keyring"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+// Размер секрета HS256 в байтах, как в cmd/secrets
+const secretSize = 32
+
+const usage = `Usage: realms [flags] <command> [command flags]
+
+Commands:
+  create [policy flags] NAME   create a realm and its first signing secret
+  update [policy flags] NAME   change the policy, only the given flags are applied
+  list                         print realms and their policies
+  scopes NAME                  print the scopes Login may grant in the realm
+  add-scope [-admin-only] NAME SCOPE
+                               allow Login to grant the scope, with -admin-only
+                               only to admins (userctl grant-admin)
+  remove-scope NAME SCOPE      stop granting the scope, issued tokens keep it
+
+Policy flags:
+  -token-ttl DURATION          token lifetime, 0 means token_ttl of the config
+  -password-min-length N       minimal password length (default 5)
+  -password-require-digit      passwords must contain a digit
+  -password-require-upper      passwords must contain an uppercase letter
+
+The master key for the signing secret is taken from MASTER_KEY or secrets.master_key_file of the config.
+
+Flags:
+`
+
+func main() {
+	var configPath, storagePath string
+
+	flag.StringVar(&configPath, "config", os.Getenv("CONFIG_PATH"), "path to the server config file")
+	flag.StringVar(&storagePath, "storage-path", "", "DSN, overrides the config file")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	if configPath == "" {
+		log.Fatal("--config (CONFIG_PATH) is required")
+	}
+	cfg := config.MustLoadByPath(configPath)
+	if storagePath == "" {
+		storagePath = cfg.StoragePath
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	masterKey, err := keyring.LoadForEnv(logger, cfg.Secrets, cfg.Env)
+	if err != nil {
+		log.Fatalf("failed to load master key: %v", err)
+	}
+
+	storage, err := postgresql.New(storagePath, masterKey)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	switch cmd {
+	case "create":
+		realm := models.Realm{Password: models.PasswordPolicy{MinLength: 5}}
+
+		fs := policyFlags("create", &realm)
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			log.Fatal("create: realm name is required")
+		}
+		realm.Name = fs.Arg(0)
+
+		id, err := storage.SaveRealm(ctx, realm)
+		if err != nil {
+			log.Fatalf("create: %v", err)
+		}
+
+		// без активного секрета в realm нельзя выдать ни одного токена
+		secret := make([]byte, secretSize)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("create: %v", err)
+		}
+		if _, err := storage.SaveSecret(ctx, id, secret, true); err != nil {
+			log.Fatalf("create: realm %d created, but its signing secret is not: %v; run secrets --realm %s generate", id, err, realm.Name)
+		}
+
+		fmt.Printf("realm %s created with id %d\n", realm.Name, id)
+	case "update":
+		if len(args) == 0 {
+			log.Fatal("update: realm name is required")
+		}
+		name := args[len(args)-1]
+
+		realm, err := storage.Realm(ctx, name)
+		if err != nil {
+			log.Fatalf("update: %v", err)
+		}
+
+		fs := policyFlags("update", &realm)
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			log.Fatal("update: realm name must be the last argument")
+		}
+
+		if err := storage.UpdateRealm(ctx, realm); err != nil {
+			log.Fatalf("update: %v", err)
+		}
+
+		fmt.Printf("realm %s updated\n", realm.Name)
+	case "list":
+		realms, err := storage.Realms(ctx)
+		if err != nil {
+			log.Fatalf("list: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTOKEN TTL\tMIN LENGTH\tDIGIT\tUPPER\tCREATED AT")
+		for _, r := range realms {
+			ttl := "default"
+			if r.TokenTTL > 0 {
+				ttl = r.TokenTTL.String()
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%t\t%t\t%s\n", r.ID, r.Name, ttl, r.Password.MinLength,
+				r.Password.RequireDigit, r.Password.RequireUpper, r.CreatedAt.Format(time.RFC3339))
+		}
+		w.Flush()
+	case "scopes":
+		if len(args) != 1 {
+			log.Fatal("scopes: realm name is required")
+		}
+
+		realm, err := storage.Realm(ctx, args[0])
+		if err != nil {
+			log.Fatalf("scopes: %v", err)
+		}
+
+		scopes, err := storage.Scopes(ctx, realm.ID)
+		if err != nil {
+			log.Fatalf("scopes: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SCOPE\tADMIN ONLY")
+		for _, s := range scopes {
+			fmt.Fprintf(w, "%s\t%t\n", s.Name, s.AdminOnly)
+		}
+		w.Flush()
+	case "add-scope":
+		var scope models.Scope
+
+		fs := flag.NewFlagSet("add-scope", flag.ExitOnError)
+		fs.BoolVar(&scope.AdminOnly, "admin-only", false, "grant the scope only to admins of the realm")
+		fs.Parse(args)
+		if fs.NArg() != 2 {
+			log.Fatal("add-scope: realm name and scope are required")
+		}
+		scope.Name = fs.Arg(1)
+
+		// scope передается в токене через пробел
+		if scope.Name == "" || strings.ContainsFunc(scope.Name, unicode.IsSpace) {
+			log.Fatalf("add-scope: invalid scope %q", scope.Name)
+		}
+
+		realm, err := storage.Realm(ctx, fs.Arg(0))
+		if err != nil {
+			log.Fatalf("add-scope: %v", err)
+		}
+
+		if err := storage.SaveScope(ctx, realm.ID, scope); err != nil {
+			log.Fatalf("add-scope: %v", err)
+		}
+
+		fmt.Printf("scope %s added to realm %s\n", scope.Name, realm.Name)
+	case "remove-scope":
+		if len(args) != 2 {
+			log.Fatal("remove-scope: realm name and scope are required")
+		}
+
+		realm, err := storage.Realm(ctx, args[0])
+		if err != nil {
+			log.Fatalf("remove-scope: %v", err)
+		}
+
+		if err := storage.DeleteScope(ctx, realm.ID, args[1]); err != nil {
+			log.Fatalf("remove-scope: %v", err)
+		}
+
+		fmt.Printf("scope %s removed from realm %s\n", args[1], realm.Name)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// policyFlags binds the policy flags to the realm, the current values are the defaults,
+// so update changes only what is given.
+func policyFlags(name string, realm *models.Realm) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.DurationVar(&realm.TokenTTL, "token-ttl", realm.TokenTTL, "token lifetime, 0 means token_ttl of the config")
+	fs.IntVar(&realm.Password.MinLength, "password-min-length", realm.Password.MinLength, "minimal password length")
+	fs.BoolVar(&realm.Password.RequireDigit, "password-require-digit", realm.Password.RequireDigit, "passwords must contain a digit")
+	fs.BoolVar(&realm.Password.RequireUpper, "password-require-upper", realm.Password.RequireUpper, "passwords must contain an uppercase letter")
+
+	return fs
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/keyring"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+// Размер секрета HS256 в байтах
+const secretSize = 32
+
+const usage = `Usage: secrets [flags] <command> [command flags]
+
+Commands:
+  generate [-if-empty]   add a signing secret, it becomes active only if there is no active one
+  rotate                 add a signing secret and make it active, older secrets still verify issued tokens
+  list                   print secrets metadata, secrets are never printed
+  re-encrypt             re-encrypt all secrets of all realms under a new master key:
+                         -new-master-key-file FILE or NEW_MASTER_KEY
+  encrypt-existing       encrypt the secrets left in plaintext by migration 3, run it before migration 11
+  new-master-key         print a new base64 master key
+
+Secrets belong to a realm, --realm defaults to default_realm of the config.
+The master key is taken from MASTER_KEY or secrets.master_key_file of the config.
+
+Flags:
+`
+
+func main() {
+	var configPath, storagePath, realmName string
+
+	flag.StringVar(&configPath, "config", os.Getenv("CONFIG_PATH"), "path to the server config file")
+	flag.StringVar(&storagePath, "storage-path", "", "DSN, overrides the config file")
+	flag.StringVar(&realmName, "realm", "", "realm of the secrets, default_realm of the config if empty")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	// new-master-key не требует ни конфига, ни базы
+	if cmd == "new-master-key" {
+		key, err := keyring.GenerateKey()
+		if err != nil {
+			log.Fatalf("new-master-key: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	if configPath == "" {
+		log.Fatal("--config (CONFIG_PATH) is required")
+	}
+	cfg := config.MustLoadByPath(configPath)
+	if storagePath == "" {
+		storagePath = cfg.StoragePath
+	}
+	if realmName == "" {
+		realmName = cfg.DefaultRealm
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	masterKey, err := keyring.LoadForEnv(logger, cfg.Secrets, cfg.Env)
+	if err != nil {
+		log.Fatalf("failed to load master key: %v", err)
+	}
+
+	storage, err := postgresql.New(storagePath, masterKey)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	realm, err := storage.Realm(ctx, realmName)
+	if err != nil {
+		log.Fatalf("realm %q: %v", realmName, err)
+	}
+
+	switch cmd {
+	case "generate":
+		fs := flag.NewFlagSet("generate", flag.ExitOnError)
+		ifEmpty := fs.Bool("if-empty", false, "do nothing if an active secret already exists")
+		fs.Parse(args)
+
+		if *ifEmpty {
+			if _, err := storage.ActiveSecret(ctx, realm.ID); err == nil {
+				fmt.Println("active secret already exists")
+				return
+			}
+		}
+
+		id, err := saveNewSecret(ctx, storage, realm.ID, false)
+		if err != nil {
+			log.Fatalf("generate: %v", err)
+		}
+		fmt.Printf("secret %d created\n", id)
+	case "rotate":
+		id, err := saveNewSecret(ctx, storage, realm.ID, true)
+		if err != nil {
+			log.Fatalf("rotate: %v", err)
+		}
+		fmt.Printf("secret %d created and activated\n", id)
+	case "list":
+		secrets, err := storage.Secrets(ctx, realm.ID)
+		if err != nil {
+			log.Fatalf("list: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tACTIVE\tMASTER KEY\tCREATED AT")
+		for _, s := range secrets {
+			fmt.Fprintf(w, "%d\t%t\t%s\t%s\n", s.ID, s.Active, s.KeyID, s.CreatedAt.Format(time.RFC3339))
+		}
+		w.Flush()
+	case "re-encrypt":
+		fs := flag.NewFlagSet("re-encrypt", flag.ExitOnError)
+		newKeyFile := fs.String("new-master-key-file", "", "file with the new base64 master key")
+		fs.Parse(args)
+
+		newKey, err := keyring.Load(config.SecretsConfig{
+			MasterKey:     os.Getenv("NEW_MASTER_KEY"),
+			MasterKeyFile: *newKeyFile,
+		})
+		if err != nil {
+			log.Fatalf("re-encrypt: failed to load the new master key: %v", err)
+		}
+
+		n, err := storage.RewrapSecrets(ctx, newKey)
+		if err != nil {
+			log.Fatalf("re-encrypt: %v", err)
+		}
+		fmt.Printf("%d secrets re-encrypted with master key %s, switch the server to the new key now\n", n, newKey.ID())
+	case "encrypt-existing":
+		n, err := storage.EncryptPlaintextSecrets(ctx)
+		if err != nil {
+			log.Fatalf("encrypt-existing: %v", err)
+		}
+		fmt.Printf("%d plaintext secrets encrypted with master key %s\n", n, masterKey.ID())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func saveNewSecret(ctx context.Context, storage *postgresql.Storage, realmID int64, activate bool) (int64, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return 0, err
+	}
+
+	return storage.SaveSecret(ctx, realmID, secret, activate)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Префиксы bcrypt-хэшей, которые принимаются как есть
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+type importOptions struct {
+	input      string
+	format     string
+	batchSize  int
+	checkpoint string
+	errorsPath string
+}
+
+type importStats struct {
+	imported int
+	exists   int
+	rejected int
+}
+
+type userRecord struct {
+	Email        string `json:"email"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// rowError rejects a single record, the import goes on.
+type rowError struct {
+	line int
+	err  error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+type recordReader interface {
+	// Next returns io.EOF after the last record and *rowError for a malformed one.
+	Next() (rec userRecord, line int, err error)
+}
+
+// checkpoint is the number of input records covered by committed batches.
+type checkpoint struct {
+	Input   string `json:"input"`
+	Records int    `json:"records"`
+}
+
+type pendingUser struct {
+	line int
+	user models.User
+}
+
+func runImport(ctx context.Context, st *postgresql.Storage, realm models.Realm, opts importOptions) (importStats, error) {
+	var stats importStats
+
+	if opts.batchSize <= 0 {
+		return stats, errors.New("batch size must be positive")
+	}
+
+	reader, closeInput, err := openInput(opts.input, opts.format)
+	if err != nil {
+		return stats, err
+	}
+	defer closeInput()
+
+	report := os.Stderr
+	if opts.errorsPath != "" {
+		f, err := os.OpenFile(opts.errorsPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return stats, err
+		}
+		defer f.Close()
+		report = f
+	}
+
+	reject := func(line int, email string, err error) {
+		stats.rejected++
+		fmt.Fprintf(report, "line %d\t%s\t%v\n", line, email, err)
+	}
+
+	var cp checkpoint
+	if opts.checkpoint != "" {
+		cp, err = loadCheckpoint(opts.checkpoint, opts.input)
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	// пропускаем записи, уже закоммиченные в прошлый запуск
+	processed := 0
+	for processed < cp.Records {
+		_, _, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		}
+		var rowErr *rowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return stats, err
+		}
+		processed++
+	}
+
+	batch := make([]pendingUser, 0, opts.batchSize)
+
+	flush := func() error {
+		if len(batch) > 0 {
+			users := make([]models.User, len(batch))
+			for i, p := range batch {
+				users[i] = p.user
+			}
+
+			results, err := st.ImportUsers(ctx, realm.ID, users)
+			if err != nil {
+				return err
+			}
+
+			for i, res := range results {
+				switch {
+				case res == nil:
+					stats.imported++
+				case errors.Is(res, storage.ErrUserExists):
+					stats.exists++
+					fmt.Fprintf(report, "line %d\t%s\t%v\n", batch[i].line, batch[i].user.Email, res)
+				default:
+					reject(batch[i].line, batch[i].user.Email, res)
+				}
+			}
+			batch = batch[:0]
+		}
+
+		if opts.checkpoint == "" {
+			return nil
+		}
+
+		return saveCheckpoint(opts.checkpoint, checkpoint{Input: cp.Input, Records: processed})
+	}
+
+	for {
+		rec, line, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			processed++
+			reject(rowErr.line, "", rowErr.err)
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		processed++
+
+		user, err := toUser(rec, realm.Password)
+		if err != nil {
+			reject(line, rec.Email, err)
+			continue
+		}
+
+		batch = append(batch, pendingUser{line: line, user: user})
+		if len(batch) < opts.batchSize {
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return stats, err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return stats, fmt.Errorf("interrupted after %d records: %w", processed, err)
+		}
+	}
+
+	return stats, flush()
+}
+
+// toUser validates the record and hashes a plaintext password that satisfies the policy.
+func toUser(rec userRecord, policy models.PasswordPolicy) (models.User, error) {
+	email := strings.TrimSpace(rec.Email)
+	if email == "" {
+		return models.User{}, errors.New("email is required")
+	}
+	if !strings.Contains(email, "@") {
+		return models.User{}, errors.New("incorrect email")
+	}
+
+	switch {
+	case rec.Password != "" && rec.PasswordHash != "":
+		return models.User{}, errors.New("both password and password_hash are set")
+	case rec.PasswordHash != "":
+		if !hasBcryptPrefix(rec.PasswordHash) {
+			return models.User{}, errors.New("unsupported password hash format, bcrypt is expected")
+		}
+		if _, err := bcrypt.Cost([]byte(rec.PasswordHash)); err != nil {
+			return models.User{}, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+
+		return models.User{Email: email, PassHash: []byte(rec.PasswordHash)}, nil
+	case rec.Password != "":
+		// та же политика, что и при регистрации через API
+		if err := policy.Check(rec.Password); err != nil {
+			return models.User{}, err
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(rec.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		return models.User{Email: email, PassHash: hash}, nil
+	default:
+		return models.User{}, errors.New("password or password_hash is required")
+	}
+}
+
+func hasBcryptPrefix(hash string) bool {
+	for _, p := range bcryptPrefixes {
+		if strings.HasPrefix(hash, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func openInput(path, format string) (recordReader, func() error, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = formatCSV
+		case ".jsonl", ".ndjson":
+			format = formatJSONL
+		default:
+			return nil, nil, fmt.Errorf("can't detect format of %q, set -format", path)
+		}
+	}
+
+	var in io.ReadCloser = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = f
+	}
+
+	switch format {
+	case formatCSV:
+		r, err := newCSVReader(in)
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		return r, in.Close, nil
+	case formatJSONL:
+		return newJSONLReader(in), in.Close, nil
+	default:
+		in.Close()
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// newCSVReader reads the header, columns are matched by name.
+func newCSVReader(in io.Reader) (*csvReader, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New(`csv header has no "email" column`)
+	}
+
+	return &csvReader{r: r, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (userRecord, int, error) {
+	fields, err := c.r.Read()
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return userRecord{}, parseErr.Line, &rowError{line: parseErr.Line, err: parseErr.Err}
+	}
+	if err != nil {
+		return userRecord{}, 0, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+
+	get := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	return userRecord{
+		Email:        get("email"),
+		Password:     get("password"),
+		PasswordHash: get("password_hash"),
+	}, line, nil
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLReader(in io.Reader) *jsonlReader {
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &jsonlReader{s: s}
+}
+
+func (j *jsonlReader) Next() (userRecord, int, error) {
+	for j.s.Scan() {
+		j.line++
+
+		text := strings.TrimSpace(j.s.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec userRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return userRecord{}, j.line, &rowError{line: j.line, err: err}
+		}
+
+		return rec, j.line, nil
+	}
+
+	if err := j.s.Err(); err != nil {
+		return userRecord{}, j.line, err
+	}
+
+	return userRecord{}, j.line, io.EOF
+}
+
+// loadCheckpoint returns an empty checkpoint if the file doesn't exist yet.
+// A checkpoint of another input file is an error, so progress is never applied to the wrong file.
+func loadCheckpoint(path, input string) (checkpoint, error) {
+	abs, err := filepath.Abs(input)
+	if err != nil {
+		return checkpoint{}, err
+	}
+	if input == "-" {
+		abs = "-"
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint{Input: abs}, nil
+	}
+	if err != nil {
+		return checkpoint{}, err
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return checkpoint{}, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if cp.Input != abs {
+		return checkpoint{}, fmt.Errorf("checkpoint %s belongs to %s, remove it to start over", path, cp.Input)
+	}
+
+	return cp, nil
+}
+
+// saveCheckpoint replaces the file atomically, an interrupted write never leaves a broken checkpoint.
+func saveCheckpoint(path string, cp checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestToUser(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret1"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	// пароль этого хэша не проходит политику, но хэш проверить нечем
+	weakHash, err := bcrypt.GenerateFromPassword([]byte("abc"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	policy := models.PasswordPolicy{MinLength: 5, RequireDigit: true}
+
+	tests := []struct {
+		name    string
+		rec     userRecord
+		wantErr string
+		// wantHash is the stored hash when it must be kept as is
+		wantHash string
+	}{
+		{
+			name: "password is hashed",
+			rec:  userRecord{Email: "a@example.com", Password: "secret1"},
+		},
+		{
+			name:     "bcrypt hash is kept",
+			rec:      userRecord{Email: "a@example.com", PasswordHash: string(hash)},
+			wantHash: string(hash),
+		},
+		{
+			name:     "2y hash is kept",
+			rec:      userRecord{Email: "a@example.com", PasswordHash: "$2y$" + string(hash[4:])},
+			wantHash: "$2y$" + string(hash[4:]),
+		},
+		{
+			name:    "argon2 hash",
+			rec:     userRecord{Email: "a@example.com", PasswordHash: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA"},
+			wantErr: "unsupported password hash format",
+		},
+		{
+			name:    "plain md5 hash",
+			rec:     userRecord{Email: "a@example.com", PasswordHash: "5ebe2294ecd0e0f08eab7690d2a6ee69"},
+			wantErr: "unsupported password hash format",
+		},
+		{
+			name:    "truncated bcrypt hash",
+			rec:     userRecord{Email: "a@example.com", PasswordHash: "$2a$10$short"},
+			wantErr: "invalid bcrypt hash",
+		},
+		{
+			name:    "both password and hash",
+			rec:     userRecord{Email: "a@example.com", Password: "secret1", PasswordHash: string(hash)},
+			wantErr: "both password and password_hash are set",
+		},
+		{
+			name:    "neither password nor hash",
+			rec:     userRecord{Email: "a@example.com"},
+			wantErr: "password or password_hash is required",
+		},
+		{
+			name:    "password violates the policy",
+			rec:     userRecord{Email: "a@example.com", Password: "secret"},
+			wantErr: "password should contain a digit",
+		},
+		{
+			name:     "hash skips the policy",
+			rec:      userRecord{Email: "a@example.com", PasswordHash: string(weakHash)},
+			wantHash: string(weakHash),
+		},
+		{
+			name:    "empty email",
+			rec:     userRecord{Email: "  ", Password: "secret1"},
+			wantErr: "email is required",
+		},
+		{
+			name:    "email without @",
+			rec:     userRecord{Email: "example.com", Password: "secret1"},
+			wantErr: "incorrect email",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := toUser(tt.rec, policy)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimSpace(tt.rec.Email), user.Email)
+
+			if tt.wantHash != "" {
+				assert.Equal(t, tt.wantHash, string(user.PassHash))
+				return
+			}
+			assert.NoError(t, bcrypt.CompareHashAndPassword(user.PassHash, []byte(tt.rec.Password)))
+		})
+	}
+}
+
+func TestToUser_TrimsEmail(t *testing.T) {
+	user, err := toUser(userRecord{Email: " a@example.com ", Password: "secret1"}, models.PasswordPolicy{})
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", user.Email)
+}
+
+// readAll returns the records and the lines of row errors in input order.
+func readAll(t *testing.T, r recordReader) (records []userRecord, lines []int, rowErrLines []int) {
+	t.Helper()
+
+	for {
+		rec, line, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records, lines, rowErrLines
+		}
+
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			rowErrLines = append(rowErrLines, rowErr.line)
+			continue
+		}
+		require.NoError(t, err)
+
+		records = append(records, rec)
+		lines = append(lines, line)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		want        []userRecord
+		wantLines   []int
+		wantRowErrs []int
+	}{
+		{
+			name:      "mixed password and hash rows",
+			input:     "email,password,password_hash\na@example.com,secret1,\nb@example.com,,$2a$10$hash\n",
+			want:      []userRecord{{Email: "a@example.com", Password: "secret1"}, {Email: "b@example.com", PasswordHash: "$2a$10$hash"}},
+			wantLines: []int{2, 3},
+		},
+		{
+			name:      "columns are matched by name",
+			input:     "Password_Hash, EMAIL\n$2a$10$hash,a@example.com\n",
+			want:      []userRecord{{Email: "a@example.com", PasswordHash: "$2a$10$hash"}},
+			wantLines: []int{2},
+		},
+		{
+			name:      "missing optional column",
+			input:     "email,password\na@example.com,secret1\n",
+			want:      []userRecord{{Email: "a@example.com", Password: "secret1"}},
+			wantLines: []int{2},
+		},
+		{
+			name:      "short row",
+			input:     "email,password,password_hash\na@example.com\n",
+			want:      []userRecord{{Email: "a@example.com"}},
+			wantLines: []int{2},
+		},
+		{
+			name:        "malformed row is skipped",
+			input:       "email,password\na@example.com,secret1\nb@example.com,\"broken\n",
+			want:        []userRecord{{Email: "a@example.com", Password: "secret1"}},
+			wantLines:   []int{2},
+			wantRowErrs: []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newCSVReader(strings.NewReader(tt.input))
+			require.NoError(t, err)
+
+			records, lines, rowErrs := readAll(t, r)
+			assert.Equal(t, tt.want, records)
+			assert.Equal(t, tt.wantLines, lines)
+			assert.Equal(t, tt.wantRowErrs, rowErrs)
+		})
+	}
+}
+
+func TestCSVReader_Header(t *testing.T) {
+	_, err := newCSVReader(strings.NewReader("mail,password\na@example.com,secret1\n"))
+	assert.ErrorContains(t, err, `no "email" column`)
+
+	_, err = newCSVReader(strings.NewReader(""))
+	assert.ErrorContains(t, err, "failed to read csv header")
+}
+
+func TestJSONLReader(t *testing.T) {
+	input := `{"email":"a@example.com","password":"secret1"}
+
+{"email":"b@example.com","password_hash":"$2a$10$hash"}
+{"email":
+   {"email":"c@example.com","password":"secret2"}
+`
+
+	records, lines, rowErrs := readAll(t, newJSONLReader(strings.NewReader(input)))
+
+	assert.Equal(t, []userRecord{
+		{Email: "a@example.com", Password: "secret1"},
+		{Email: "b@example.com", PasswordHash: "$2a$10$hash"},
+		{Email: "c@example.com", Password: "secret2"},
+	}, records)
+	assert.Equal(t, []int{1, 3, 5}, lines)
+	assert.Equal(t, []int{4}, rowErrs)
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "users.csv")
+	other := filepath.Join(dir, "other.csv")
+
+	tests := []struct {
+		name    string
+		content string // "" means no checkpoint file
+		input   string
+		want    checkpoint
+		wantErr string
+	}{
+		{
+			name:  "no checkpoint yet",
+			input: input,
+			want:  checkpoint{Input: input},
+		},
+		{
+			name:    "checkpoint of the input",
+			content: `{"input":"` + input + `","records":42}`,
+			input:   input,
+			want:    checkpoint{Input: input, Records: 42},
+		},
+		{
+			name:    "checkpoint of another input",
+			content: `{"input":"` + other + `","records":42}`,
+			input:   input,
+			wantErr: "belongs to " + other,
+		},
+		{
+			name:    "broken checkpoint",
+			content: `{"input":`,
+			input:   input,
+			wantErr: "invalid checkpoint",
+		},
+		{
+			name:    "stdin",
+			content: `{"input":"-","records":7}`,
+			input:   "-",
+			want:    checkpoint{Input: "-", Records: 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "users.checkpoint")
+			if tt.content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+			}
+
+			cp, err := loadCheckpoint(path, tt.input)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cp)
+		})
+	}
+}
+
+func TestLoadCheckpoint_RelativeInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.checkpoint")
+
+	abs, err := filepath.Abs("users.csv")
+	require.NoError(t, err)
+
+	require.NoError(t, saveCheckpoint(path, checkpoint{Input: abs, Records: 3}))
+
+	cp, err := loadCheckpoint(path, "users.csv")
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint{Input: abs, Records: 3}, cp)
+
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
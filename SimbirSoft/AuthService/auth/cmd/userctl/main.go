@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/cmd/internal/storage/postgresql"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// Realm, созданный миграцией 6_realms, если не задан ни --realm, ни конфиг
+const defaultRealm = "default"
+
+const usage = `Usage: userctl [flags] <command> [command flags]
+
+Commands:
+  import [-format csv|jsonl] [-batch N] [-checkpoint FILE] [-errors FILE] FILE
+      import users, each record has "email" and either "password" (plaintext,
+      checked against the realm password policy and hashed with bcrypt) or
+      "password_hash" (bcrypt: $2a$, $2b$ or $2y$).
+      FILE "-" reads stdin. With -checkpoint the import resumes after the last
+      committed batch.
+  export [-format csv|jsonl] [-with-hashes] [-out FILE]
+      export users, password hashes only with -with-hashes
+  grant-admin EMAIL
+      allow the user to impersonate other users
+  revoke-admin EMAIL
+      take the admin role away, takes effect immediately
+  change-email EMAIL NEW_EMAIL
+      change the email of the user
+  disable EMAIL
+      forbid the user to log in, issued tokens stay valid until they expire
+  enable EMAIL
+      allow a disabled user to log in again
+  delete EMAIL
+      delete the user
+
+import, change-email, disable, enable and delete emit user events for webhooks.
+
+Flags:
+`
+
+func main() {
+	var configPath, storagePath, realmName string
+
+	flag.StringVar(&configPath, "config", os.Getenv("CONFIG_PATH"), "path to the server config file, storage_path is used as DSN")
+	flag.StringVar(&storagePath, "storage-path", "", "DSN, overrides the config file")
+	flag.StringVar(&realmName, "realm", "", "realm of the users, default_realm of the config or \"default\" if empty")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	if configPath != "" {
+		cfg := config.MustLoadByPath(configPath)
+		if storagePath == "" {
+			storagePath = cfg.StoragePath
+		}
+		if realmName == "" {
+			realmName = cfg.DefaultRealm
+		}
+	}
+	if storagePath == "" {
+		log.Fatal("either --config (CONFIG_PATH) or --storage-path is required")
+	}
+	if realmName == "" {
+		realmName = defaultRealm
+	}
+
+	// Секреты подписи userctl не нужны, поэтому хранилище без мастер-ключа
+	storage, err := postgresql.New(storagePath, nil)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Close()
+
+	// Ctrl+C прерывает после текущего батча, checkpoint остается консистентным
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	realm, err := storage.Realm(ctx, realmName)
+	if err != nil {
+		log.Fatalf("realm %q: %v", realmName, err)
+	}
+
+	switch cmd {
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		opts := importOptions{}
+		fs.StringVar(&opts.format, "format", "", "csv or jsonl, detected by the file extension if empty")
+		fs.IntVar(&opts.batchSize, "batch", 500, "users per transaction")
+		fs.StringVar(&opts.checkpoint, "checkpoint", "", "file to store progress in, enables resuming")
+		fs.StringVar(&opts.errorsPath, "errors", "", "file for rejected records, stderr if empty")
+		fs.Parse(args)
+
+		if fs.NArg() != 1 {
+			log.Fatal("import: input file is required")
+		}
+		opts.input = fs.Arg(0)
+
+		stats, err := runImport(ctx, storage, realm, opts)
+		fmt.Printf("imported: %d, already exist: %d, rejected: %d\n", stats.imported, stats.exists, stats.rejected)
+		if err != nil {
+			log.Fatalf("import: %v", err)
+		}
+		if stats.rejected > 0 || stats.exists > 0 {
+			os.Exit(1)
+		}
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		opts := exportOptions{}
+		fs.StringVar(&opts.format, "format", formatJSONL, "csv or jsonl")
+		fs.BoolVar(&opts.withHashes, "with-hashes", false, "include bcrypt password hashes")
+		fs.StringVar(&opts.output, "out", "-", "output file, stdout if \"-\"")
+		fs.Parse(args)
+
+		n, err := runExport(ctx, storage, realm.ID, opts)
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "exported: %d\n", n)
+	case "grant-admin", "revoke-admin":
+		if len(args) != 1 {
+			log.Fatalf("%s: email is required", cmd)
+		}
+
+		if err := storage.SetAdmin(ctx, realm.ID, args[0], cmd == "grant-admin"); err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		fmt.Printf("%s: done for %s\n", cmd, args[0])
+	case "change-email":
+		if len(args) != 2 {
+			log.Fatal("change-email: email and new email are required")
+		}
+
+		if err := storage.ChangeEmail(ctx, realm.ID, args[0], args[1]); err != nil {
+			log.Fatalf("change-email: %v", err)
+		}
+		fmt.Printf("change-email: %s is now %s\n", args[0], args[1])
+	case "disable", "enable":
+		if len(args) != 1 {
+			log.Fatalf("%s: email is required", cmd)
+		}
+
+		if err := storage.SetDisabled(ctx, realm.ID, args[0], cmd == "disable"); err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		fmt.Printf("%s: done for %s\n", cmd, args[0])
+	case "delete":
+		if len(args) != 1 {
+			log.Fatal("delete: email is required")
+		}
+
+		if err := storage.DeleteUser(ctx, realm.ID, args[0]); err != nil {
+			log.Fatalf("delete: %v", err)
+		}
+		fmt.Printf("delete: %s deleted\n", args[0])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
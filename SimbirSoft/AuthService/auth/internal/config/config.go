@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
@@ -9,15 +10,120 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-default:"1h"`
+	Env              string          `yaml:"env" env-default:"local"`
+	StoragePath      string          `yaml:"storage_path" env-required:"true"`
+	DefaultRealm     string          `yaml:"default_realm" env-default:"default"`
+	GRPC             GRPCConfig      `yaml:"grpc"`
+	TokenTTL         time.Duration   `yaml:"token_ttl" env-default:"1h"`
+	ImpersonationTTL time.Duration   `yaml:"impersonation_ttl" env-default:"15m"`
+	ExchangeTTL      time.Duration   `yaml:"exchange_ttl" env-default:"5m"`
+	Tracing          TracingConfig   `yaml:"tracing"`
+	Metrics          MetricsConfig   `yaml:"metrics"`
+	Secrets          SecretsConfig   `yaml:"secrets"`
+	Mailer           MailerConfig    `yaml:"mailer"`
+	MagicLink        MagicLinkConfig `yaml:"magic_link"`
+	Webhooks         WebhooksConfig  `yaml:"webhooks"`
+}
+
+type MetricsConfig struct {
+	Address string `yaml:"address" env:"METRICS_ADDRESS" env-default:"0.0.0.0:8082"`
+}
+
+// SecretsConfig locates the master key that encrypts signing secrets.
+// The key is base64 encoded 32 bytes, MASTER_KEY takes precedence over the file.
+// Only in the local env a missing key falls back to a built-in development key.
+type SecretsConfig struct {
+	MasterKey     string `yaml:"-" json:"-" env:"MASTER_KEY"`
+	MasterKeyFile string `yaml:"master_key_file" env:"MASTER_KEY_FILE"`
+}
+
+// String keeps the master key out of logs.
+func (c SecretsConfig) String() string {
+	key := ""
+	if c.MasterKey != "" {
+		key = "[REDACTED]"
+	}
+
+	return fmt.Sprintf("{MasterKey:%s MasterKeyFile:%s}", key, c.MasterKeyFile)
+}
+
+// MailerConfig selects how emails are delivered: "file" writes them to OutboxDir, "smtp" sends them.
+type MailerConfig struct {
+	Kind         string `yaml:"kind" env:"MAILER_KIND" env-default:"file"`
+	From         string `yaml:"from" env-default:"auth@localhost"`
+	OutboxDir    string `yaml:"outbox_dir" env-default:"outbox"`
+	SMTPAddress  string `yaml:"smtp_address" env:"SMTP_ADDRESS"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"-" json:"-" env:"SMTP_PASSWORD"`
+}
+
+// String keeps the SMTP password out of logs.
+func (c MailerConfig) String() string {
+	password := ""
+	if c.SMTPPassword != "" {
+		password = "[REDACTED]"
+	}
+
+	return fmt.Sprintf("{Kind:%s From:%s OutboxDir:%s SMTPAddress:%s SMTPUsername:%s SMTPPassword:%s}",
+		c.Kind, c.From, c.OutboxDir, c.SMTPAddress, c.SMTPUsername, password)
+}
+
+// MagicLinkConfig: "{token}" in URL is replaced with the one-time token.
+type MagicLinkConfig struct {
+	TTL time.Duration `yaml:"ttl" env-default:"10m"`
+	URL string        `yaml:"url" env-default:"http://localhost:8080/magic-link?token={token}"`
+}
+
+// WebhooksConfig: events from the outbox are sent to every endpoint subscribed to them.
+// A delivery is retried with exponential backoff from RetryBaseDelay up to RetryMaxDelay
+// and becomes dead after MaxAttempts.
+type WebhooksConfig struct {
+	Endpoints      []WebhookEndpoint `yaml:"endpoints"`
+	PollInterval   time.Duration     `yaml:"poll_interval" env-default:"1s"`
+	BatchSize      int               `yaml:"batch_size" env-default:"100"`
+	Timeout        time.Duration     `yaml:"timeout" env-default:"10s"`
+	MaxAttempts    int               `yaml:"max_attempts" env-default:"10"`
+	RetryBaseDelay time.Duration     `yaml:"retry_base_delay" env-default:"10s"`
+	RetryMaxDelay  time.Duration     `yaml:"retry_max_delay" env-default:"1h"`
+}
+
+// WebhookEndpoint: the HMAC secret is read from the SecretEnv environment variable,
+// so it stays out of the config file and logs. Empty Events means all events.
+type WebhookEndpoint struct {
+	URL       string   `yaml:"url"`
+	SecretEnv string   `yaml:"secret_env"`
+	Events    []string `yaml:"events"`
 }
 
 type GRPCConfig struct {
 	Port    int           `yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
+	TLS     TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig configures the transport security of the gRPC server.
+type TLSConfig struct {
+	Enabled           bool          `yaml:"enabled" env:"GRPC_TLS_ENABLED"`
+	CertFile          string        `yaml:"cert_file" env:"GRPC_TLS_CERT_FILE"`
+	KeyFile           string        `yaml:"key_file" env:"GRPC_TLS_KEY_FILE"`
+	CAFile            string        `yaml:"ca_file" env:"GRPC_TLS_CA_FILE"` // CA used to verify client certificates
+	RequireClientCert bool          `yaml:"require_client_cert"`
+	ReloadInterval    time.Duration `yaml:"reload_interval" env-default:"30s"`
+	// ValidateTokenAllowedSubjects restricts ValidateToken, Introspect and TokenExchange to peers
+	// whose client certificate subject (full DN or CN) is in the list. Empty means no restriction.
+	ValidateTokenAllowedSubjects []string `yaml:"validate_token_allowed_subjects"`
+}
+
+// TracingConfig describes where spans are exported.
+// Exporter is one of "otlp", "stdout" or "file".
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" env:"TRACING_ENABLED" env-default:"false"`
+	ServiceName string  `yaml:"service_name" env-default:"auth"`
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"stdout"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env-default:"true"`
+	FilePath    string  `yaml:"file_path" env-default:"traces.json"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
 }
 
 func MustLoad() *Config {
@@ -0,0 +1,18 @@
+-- Scopes, которые можно запросить при Login в realm. admin_only: только администраторам (users.is_admin),
+-- без этого списка любой пользователь выдавал бы себе любые разрешения
+CREATE TABLE IF NOT EXISTS scopes
+(
+    realm_id   INT     NOT NULL REFERENCES realms (id) ON DELETE CASCADE,
+    name       TEXT    NOT NULL,
+    admin_only BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (realm_id, name)
+);
+
+-- Scopes bank_service в realm по умолчанию: курсы валют и блокировки счетов - только для сотрудников банка
+INSERT INTO scopes (realm_id, name, admin_only)
+VALUES (1, 'accounts:read', FALSE),
+       (1, 'accounts:close', FALSE),
+       (1, 'transfers:write', FALSE),
+       (1, 'fx:write', TRUE),
+       (1, 'accounts:lock', TRUE)
+ON CONFLICT DO NOTHING;
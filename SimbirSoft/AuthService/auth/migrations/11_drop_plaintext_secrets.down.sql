@@ -0,0 +1,9 @@
+ALTER TABLE secrets
+    ALTER COLUMN ciphertext DROP NOT NULL,
+    ALTER COLUMN wrapped_key DROP NOT NULL,
+    ALTER COLUMN key_id DROP NOT NULL;
+
+ALTER TABLE secrets ADD COLUMN secret TEXT UNIQUE;
+
+ALTER TABLE secrets ADD CONSTRAINT secrets_sealed_check
+    CHECK ((secret IS NULL) = (ciphertext IS NOT NULL AND wrapped_key IS NOT NULL AND key_id IS NOT NULL));
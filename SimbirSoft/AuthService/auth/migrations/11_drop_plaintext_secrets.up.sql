@@ -0,0 +1,17 @@
+-- Открытые секреты, оставшиеся после 3_encrypted_secrets, должны быть зашифрованы до удаления колонки:
+-- `migrator up-to 10`, затем `secrets encrypt-existing` (так делает `make migrate`)
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM secrets WHERE secret IS NOT NULL) THEN
+        RAISE EXCEPTION 'plaintext secrets left: run `secrets encrypt-existing` before this migration';
+    END IF;
+END
+$$;
+
+ALTER TABLE secrets DROP CONSTRAINT secrets_sealed_check;
+ALTER TABLE secrets DROP COLUMN secret;
+
+ALTER TABLE secrets
+    ALTER COLUMN ciphertext SET NOT NULL,
+    ALTER COLUMN wrapped_key SET NOT NULL,
+    ALTER COLUMN key_id SET NOT NULL;
@@ -0,0 +1,14 @@
+-- Зашифрованные секреты в старой схеме хранить негде
+DELETE FROM secrets WHERE secret IS NULL;
+
+DROP INDEX IF EXISTS idx_secrets_active;
+
+ALTER TABLE secrets
+    DROP CONSTRAINT secrets_sealed_check,
+    DROP COLUMN ciphertext,
+    DROP COLUMN wrapped_key,
+    DROP COLUMN key_id,
+    DROP COLUMN active,
+    DROP COLUMN created_at;
+
+ALTER TABLE secrets ALTER COLUMN secret SET NOT NULL;
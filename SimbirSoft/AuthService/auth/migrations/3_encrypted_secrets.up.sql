@@ -0,0 +1,26 @@
+-- Секреты хранятся зашифрованными (см. cmd/internal/keyring). Открытые значения,
+-- в том числе 'test-secret' из 1_init, остаются в secret, пока их не зашифрует
+-- `secrets encrypt-existing`, колонка удаляется миграцией 11.
+ALTER TABLE secrets ALTER COLUMN secret DROP NOT NULL;
+
+ALTER TABLE secrets
+    ADD COLUMN ciphertext  bytea,
+    ADD COLUMN wrapped_key bytea,
+    ADD COLUMN key_id      TEXT,
+    ADD COLUMN active      BOOLEAN     NOT NULL DEFAULT FALSE,
+    ADD COLUMN created_at  TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Секрет хранится либо открытым, либо зашифрованным
+ALTER TABLE secrets ADD CONSTRAINT secrets_sealed_check
+    CHECK ((secret IS NULL) = (ciphertext IS NOT NULL AND wrapped_key IS NOT NULL AND key_id IS NOT NULL));
+
+-- Существующий секрет продолжает подписывать токены. 'test-secret' известен всем,
+-- поэтому остается только для проверки выданных токенов: новый секрет создает `make secrets-init`.
+UPDATE secrets SET active = TRUE
+WHERE id = (SELECT min(id) FROM secrets WHERE secret <> 'test-secret');
+
+-- 1_init вставляет секрет с явным id
+SELECT setval('secrets_id_seq', (SELECT max(id) FROM secrets));
+
+-- Токены подписываются только одним активным секретом
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_active ON secrets (active) WHERE active;
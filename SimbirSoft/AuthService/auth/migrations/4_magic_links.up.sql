@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS magic_links
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash  bytea       NOT NULL UNIQUE, -- sha256 токена из письма, сам токен не хранится
+    expires_at  TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INT,
+    event      TEXT        NOT NULL,
+    method     TEXT        NOT NULL DEFAULT '',
+    details    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id);
@@ -0,0 +1,13 @@
+-- Пользователи и секреты других realm удаляются, иначе email перестанет быть уникальным
+DELETE FROM users WHERE realm_id <> 1;
+DELETE FROM secrets WHERE realm_id <> 1;
+
+DROP INDEX IF EXISTS idx_secrets_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_active ON secrets (active) WHERE active;
+ALTER TABLE secrets DROP COLUMN realm_id;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_realm_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN realm_id;
+
+DROP TABLE IF EXISTS realms;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS realms
+(
+    id                     SERIAL PRIMARY KEY,
+    name                   TEXT        NOT NULL UNIQUE,
+    token_ttl_seconds      INT,                            -- NULL: token_ttl из конфига
+    password_min_length    INT         NOT NULL DEFAULT 5,
+    password_require_digit BOOLEAN     NOT NULL DEFAULT FALSE,
+    password_require_upper BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Существующие пользователи и секреты попадают в realm по умолчанию
+INSERT INTO realms (id, name) VALUES (1, 'default') ON CONFLICT DO NOTHING;
+SELECT setval('realms_id_seq', (SELECT max(id) FROM realms));
+
+ALTER TABLE users ADD COLUMN realm_id INT NOT NULL DEFAULT 1 REFERENCES realms (id);
+ALTER TABLE users ALTER COLUMN realm_id DROP DEFAULT;
+
+-- email уникален только внутри realm
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_realm_email_key UNIQUE (realm_id, email);
+
+ALTER TABLE secrets ADD COLUMN realm_id INT NOT NULL DEFAULT 1 REFERENCES realms (id);
+ALTER TABLE secrets ALTER COLUMN realm_id DROP DEFAULT;
+
+-- Один активный секрет на realm
+DROP INDEX IF EXISTS idx_secrets_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_active ON secrets (realm_id) WHERE active;
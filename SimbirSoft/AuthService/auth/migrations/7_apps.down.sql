@@ -0,0 +1,9 @@
+ALTER TABLE magic_links DROP COLUMN IF EXISTS app_id;
+
+DELETE FROM secrets WHERE app_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_secrets_app_active;
+DROP INDEX IF EXISTS idx_secrets_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_active ON secrets (realm_id) WHERE active;
+ALTER TABLE secrets DROP COLUMN IF EXISTS app_id;
+
+DROP TABLE IF EXISTS apps;
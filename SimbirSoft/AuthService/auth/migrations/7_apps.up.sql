@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS apps
+(
+    id                SERIAL PRIMARY KEY,
+    realm_id          INT         NOT NULL REFERENCES realms (id),
+    name              TEXT        NOT NULL,
+    redirect_origins  TEXT[]      NOT NULL DEFAULT '{}', -- scheme://host[:port], куда можно вернуть пользователя
+    token_ttl_seconds INT,                               -- NULL: TTL realm
+    enabled           BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (realm_id, name)
+);
+
+-- Секрет подписи приложения хранится в secrets, зашифрованным так же, как секреты realm
+ALTER TABLE secrets ADD COLUMN app_id INT REFERENCES apps (id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_secrets_active;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_active ON secrets (realm_id) WHERE active AND app_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_app_active ON secrets (app_id) WHERE active AND app_id IS NOT NULL;
+
+-- Приложение, для которого будет выдан токен по ссылке
+ALTER TABLE magic_links ADD COLUMN app_id INT REFERENCES apps (id) ON DELETE CASCADE;
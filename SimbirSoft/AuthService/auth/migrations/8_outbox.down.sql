@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS outbox;
+
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
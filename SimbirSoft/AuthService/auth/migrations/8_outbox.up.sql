@@ -0,0 +1,29 @@
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Доменные события пишутся в той же транзакции, что и изменение пользователя
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id            BIGSERIAL PRIMARY KEY,
+    realm_id      INT         NOT NULL REFERENCES realms (id),
+    event_type    TEXT        NOT NULL,
+    user_id       INT, -- без FK: событие user.deleted переживает пользователя
+    data          JSONB       NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    dispatched_at TIMESTAMPTZ  -- когда по событию созданы доставки
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_undispatched ON outbox (id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              BIGSERIAL PRIMARY KEY,
+    event_id        BIGINT      NOT NULL REFERENCES outbox (id) ON DELETE CASCADE,
+    endpoint        TEXT        NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT,
+    delivered_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (event_id, endpoint)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
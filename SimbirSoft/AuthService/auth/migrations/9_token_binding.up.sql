@@ -0,0 +1,3 @@
+-- Привязка токенов приложения к клиенту: подсеть IP, User-Agent или ключ клиента (jkt, как в DPoP)
+ALTER TABLE apps ADD COLUMN binding_mode TEXT NOT NULL DEFAULT 'none'
+    CHECK (binding_mode IN ('none', 'ip', 'user_agent', 'ip_user_agent', 'key'));
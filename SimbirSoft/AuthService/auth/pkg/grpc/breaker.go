@@ -0,0 +1,62 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a consecutive-failures circuit breaker.
+//
+// After threshold transient failures in a row it opens and rejects calls for
+// cooldown, then lets a single probe through (half-open). A successful probe
+// closes it again, a failed one reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if time.Since(b.openedAt) < b.cooldown || b.probing {
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	const (
+		threshold = 3
+		cooldown  = time.Minute
+	)
+
+	tests := []struct {
+		name string
+		// run drives the breaker, the returned value is what allow reports afterwards
+		run  func(b *breaker) bool
+		want bool
+	}{
+		{
+			name: "closed below threshold",
+			run: func(b *breaker) bool {
+				b.failure()
+				b.failure()
+				return b.allow()
+			},
+			want: true,
+		},
+		{
+			name: "opens at threshold",
+			run: func(b *breaker) bool {
+				failN(b, threshold)
+				return b.allow()
+			},
+			want: false,
+		},
+		{
+			name: "success resets the failure count",
+			run: func(b *breaker) bool {
+				failN(b, threshold-1)
+				b.success()
+				failN(b, threshold-1)
+				return b.allow()
+			},
+			want: true,
+		},
+		{
+			name: "half-open after cooldown lets a probe through",
+			run: func(b *breaker) bool {
+				failN(b, threshold)
+				b.openedAt = time.Now().Add(-cooldown)
+				return b.allow()
+			},
+			want: true,
+		},
+		{
+			name: "half-open lets only one probe through",
+			run: func(b *breaker) bool {
+				failN(b, threshold)
+				b.openedAt = time.Now().Add(-cooldown)
+				b.allow()
+				return b.allow()
+			},
+			want: false,
+		},
+		{
+			name: "successful probe closes",
+			run: func(b *breaker) bool {
+				failN(b, threshold)
+				b.openedAt = time.Now().Add(-cooldown)
+				b.allow()
+				b.success()
+				b.allow()
+				return b.allow()
+			},
+			want: true,
+		},
+		{
+			name: "failed probe reopens",
+			run: func(b *breaker) bool {
+				failN(b, threshold)
+				b.openedAt = time.Now().Add(-cooldown)
+				b.allow()
+				b.failure()
+				return b.allow()
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.run(newBreaker(threshold, cooldown)))
+		})
+	}
+}
+
+func failN(b *breaker, n int) {
+	for range n {
+		b.failure()
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache keeps the most recently used validation results, each until its own expiry.
+type lruCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key       string
+	identity  Identity
+	expiresAt time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache) get(key string) (Identity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return Identity{}, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return Identity{}, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return entry.identity, true
+}
+
+func (c *lruCache) add(key string, identity Identity, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.identity = identity
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, identity: identity, expiresAt: expiresAt})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		size int
+		fill func(c *lruCache)
+		// key -> whether it must still be cached
+		want map[string]bool
+	}{
+		{
+			name: "evicts the least recently added",
+			size: 2,
+			fill: func(c *lruCache) {
+				c.add("a", Identity{UserID: 1}, future)
+				c.add("b", Identity{UserID: 2}, future)
+				c.add("c", Identity{UserID: 3}, future)
+			},
+			want: map[string]bool{"a": false, "b": true, "c": true},
+		},
+		{
+			name: "get marks an entry as recently used",
+			size: 2,
+			fill: func(c *lruCache) {
+				c.add("a", Identity{UserID: 1}, future)
+				c.add("b", Identity{UserID: 2}, future)
+				c.get("a")
+				c.add("c", Identity{UserID: 3}, future)
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "re-adding a key does not grow the cache",
+			size: 2,
+			fill: func(c *lruCache) {
+				c.add("a", Identity{UserID: 1}, future)
+				c.add("b", Identity{UserID: 2}, future)
+				c.add("a", Identity{UserID: 1}, future)
+				c.add("c", Identity{UserID: 3}, future)
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "expired entries are not returned",
+			size: 2,
+			fill: func(c *lruCache) {
+				c.add("a", Identity{UserID: 1}, time.Now().Add(-time.Second))
+				c.add("b", Identity{UserID: 2}, future)
+			},
+			want: map[string]bool{"a": false, "b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLRUCache(tt.size)
+			tt.fill(c)
+
+			for key, cached := range tt.want {
+				_, ok := c.get(key)
+				assert.Equal(t, cached, ok, key)
+			}
+			assert.LessOrEqual(t, c.order.Len(), tt.size)
+			assert.Len(t, c.items, c.order.Len())
+		})
+	}
+}
+
+func TestLRUCache_ExpiredEntryIsDropped(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a", Identity{UserID: 1}, time.Now().Add(-time.Second))
+
+	_, ok := c.get("a")
+	require.False(t, ok)
+
+	assert.Zero(t, c.order.Len())
+	assert.Empty(t, c.items)
+}
+
+func TestCacheExpiry(t *testing.T) {
+	const cacheTTL = time.Minute
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		// want is the expected expiry relative to now, ok whether the result may be cached at all
+		want time.Duration
+		ok   bool
+	}{
+		{
+			name:   "capped at the token expiry",
+			claims: jwt.MapClaims{"exp": time.Now().Add(10 * time.Second).Unix()},
+			want:   10 * time.Second,
+			ok:     true,
+		},
+		{
+			name:   "capped at the cache ttl",
+			claims: jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()},
+			want:   cacheTTL,
+			ok:     true,
+		},
+		{
+			name:   "expired token is not cached",
+			claims: jwt.MapClaims{"exp": time.Now().Add(-time.Second).Unix()},
+			ok:     false,
+		},
+		{
+			name:   "token without exp is not cached",
+			claims: jwt.MapClaims{"uid": 1},
+			ok:     false,
+		},
+	}
+
+	c := &Client{cfg: withDefaults(Config{CacheTTL: cacheTTL})}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString([]byte("test-secret"))
+			require.NoError(t, err)
+
+			expiresAt, ok := c.cacheExpiry(token)
+			require.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+
+			assert.WithinDuration(t, time.Now().Add(tt.want), expiresAt, time.Second)
+		})
+	}
+
+	_, ok := c.cacheExpiry("not a token")
+	assert.False(t, ok)
+}
@@ -1,22 +1,383 @@
+// Package client is the SDK downstream services use to talk to the auth service.
+//
+// Client wraps the generated gRPC stub with per-call timeouts, retries with
+// jitter, a circuit breaker and an LRU cache of token validation results.
+// UnaryServerInterceptor plugs token validation into a downstream gRPC server.
 package client
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnavailable  = errors.New("auth service is unavailable")
 )
 
-type ClientGRPC struct {
+// Значения по умолчанию для незаданных полей Config
+const (
+	defaultTimeout          = 2 * time.Second
+	defaultRetries          = 3
+	defaultRetryBaseDelay   = 50 * time.Millisecond
+	defaultRetryMaxDelay    = time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+	defaultCacheTTL         = time.Minute
+	defaultProofMaxAge      = time.Minute
+)
+
+type Config struct {
+	Address string
+	// Realm tokens must be issued in, empty means the default realm of the auth service.
+	Realm string
+	// AppID of the service in the realm, only tokens issued for this app are accepted.
+	// 0 accepts tokens issued without an app.
+	AppID int64
+	// Audience is the name of the service, only tokens issued for it are accepted.
+	// Empty accepts tokens of any audience of the realm.
+	Audience string
+	// TLS is nil for a plaintext connection.
+	TLS *tls.Config
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// Retries is the number of additional attempts after a transient failure,
+	// a negative value disables retries.
+	Retries        int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerThreshold consecutive transient failures open the breaker for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// CacheSize is the number of cached validation results, 0 disables the cache.
+	CacheSize int
+	// CacheTTL caps how long a result is cached; it never outlives the token itself.
+	CacheTTL time.Duration
+	// ProofMaxAge is how old a DPoP proof of the caller may be, see VerifyProof.
+	ProofMaxAge time.Duration
+}
+
+// Identity is the result of a successful token validation.
+type Identity struct {
+	UserID int64
+	// ActorID is the admin acting as the user with an impersonation token, 0 otherwise.
+	ActorID int64
+	// Scopes granted to the token, empty if it is not limited to a scope.
+	Scopes []string
+}
+
+// ExchangedToken is a narrower token issued by Exchange.
+type ExchangedToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Scopes    []string
+}
+
+// ClientContext is the caller presenting the token. Auth compares it with the client
+// the token was bound to if the app binds tokens.
+type ClientContext struct {
+	IP            string
+	UserAgent     string
+	KeyThumbprint string // thumbprint of the key of a verified proof, see VerifyProof
+}
+
+// Impersonated reports whether an admin acts as the user.
+func (i Identity) Impersonated() bool {
+	return i.ActorID != 0
+}
+
+// HasScope reports whether the token is granted the scope.
+func (i Identity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// Client is the resilient auth client. It is safe for concurrent use.
+type Client struct {
 	api.AuthClient
+
+	conn    *grpc.ClientConn
+	cfg     Config
+	breaker *breaker
+	cache   *lruCache
+}
+
+func New(cfg Config) (*Client, error) {
+	const op = "client.New"
+
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("%s: address is required", op)
+	}
+
+	cfg = withDefaults(cfg)
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS != nil {
+		creds = credentials.NewTLS(cfg.TLS)
+	}
+
+	conn, err := grpc.NewClient(cfg.Address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()), // пробрасываем trace context в auth
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	c := &Client{
+		AuthClient: api.NewAuthClient(conn),
+		conn:       conn,
+		cfg:        cfg,
+		breaker:    newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+
+	if cfg.CacheSize > 0 {
+		c.cache = newLRUCache(cfg.CacheSize)
+	}
+
+	return c, nil
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Validate checks the token with the auth service.
+//
+// Returns ErrInvalidToken if auth rejected the token and ErrUnavailable if
+// auth could not be reached within the retry budget or the breaker is open.
+func (c *Client) Validate(ctx context.Context, token string) (Identity, error) {
+	return c.ValidateClient(ctx, token, ClientContext{})
+}
+
+// ValidateClient is Validate for tokens of apps which bind tokens to the client:
+// the token must be presented by the client it was bound to. The token must also be
+// granted all the scopes, a token without scope is rejected if any are required.
+func (c *Client) ValidateClient(ctx context.Context, token string, client ClientContext, scopes ...string) (Identity, error) {
+	const op = "client.Validate"
+
+	if token == "" {
+		return Identity{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	key := cacheKey(token, client, scopes)
+	if c.cache != nil {
+		if identity, ok := c.cache.get(key); ok {
+			return identity, nil
+		}
+	}
+
+	var resp *api.ValidateTokenResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+			Token: token,
+			Realm: c.cfg.Realm,
+			AppId: c.cfg.AppID,
+			Client: &api.ClientContext{
+				Ip:            client.IP,
+				UserAgent:     client.UserAgent,
+				KeyThumbprint: client.KeyThumbprint,
+			},
+			Audience: c.cfg.Audience,
+			Scopes:   scopes,
+		})
+		return err
+	})
+	if err != nil {
+		return Identity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	identity := Identity{UserID: resp.GetId(), ActorID: resp.GetActorId(), Scopes: strings.Fields(resp.GetScope())}
+
+	if c.cache != nil {
+		if expiresAt, ok := c.cacheExpiry(token); ok {
+			c.cache.add(key, identity, expiresAt)
+		}
+	}
+
+	return identity, nil
 }
 
-func NewClientGRPC(address string) (*ClientGRPC, error) {
-	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// Exchange trades the token of the caller for a short-lived token of the same user for calls
+// to the audience services with the scope (RFC 8693). Both must be a part of what the token
+// was issued for, otherwise ErrInvalidToken. client is the caller of the token, as for ValidateClient.
+func (c *Client) Exchange(ctx context.Context, token string, client ClientContext, audience []string, scope ...string) (ExchangedToken, error) {
+	const op = "client.Exchange"
+
+	var resp *api.TokenExchangeResponse
+	err := c.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.AuthClient.TokenExchange(ctx, &api.TokenExchangeRequest{
+			SubjectToken: token,
+			Audience:     audience,
+			Scope:        strings.Join(scope, " "),
+			Realm:        c.cfg.Realm,
+			Client: &api.ClientContext{
+				Ip:            client.IP,
+				UserAgent:     client.UserAgent,
+				KeyThumbprint: client.KeyThumbprint,
+			},
+		})
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return ExchangedToken{}, fmt.Errorf("%s: %w", op, err)
 	}
-	client := api.NewAuthClient(conn)
-	return &ClientGRPC{
-		client,
+
+	return ExchangedToken{
+		Token:     resp.GetAccessToken(),
+		ExpiresAt: time.Now().Add(time.Duration(resp.GetExpiresIn()) * time.Second),
+		Scopes:    strings.Fields(resp.GetScope()),
 	}, nil
 }
+
+// call runs fn with a per-attempt timeout, retrying transient failures with
+// full jitter backoff while the circuit breaker allows it.
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	var lastErr error
+
+	for attempt := 0; attempt <= c.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(ErrUnavailable, ctx.Err())
+			case <-time.After(c.backoff(attempt)):
+			}
+		}
+
+		if !c.breaker.allow() {
+			return ErrUnavailable
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		err := fn(attemptCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			c.breaker.success()
+			return nil
+		case isTransient(err):
+			c.breaker.failure()
+			lastErr = err
+		default:
+			// Auth answered, so it is healthy even though it refused the token
+			c.breaker.success()
+			if isRejected(err) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return errors.Join(ErrUnavailable, lastErr)
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.cfg.RetryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.cfg.RetryMaxDelay {
+		delay = c.cfg.RetryMaxDelay
+	}
+
+	return rand.N(delay) + 1
+}
+
+// cacheExpiry returns when a cached result for the token must be dropped.
+// The signature is not checked here: the token has just been validated by auth.
+func (c *Client) cacheExpiry(token string) (time.Time, bool) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return time.Time{}, false
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, false
+	}
+
+	expiresAt := time.Now().Add(c.cfg.CacheTTL)
+	if exp.Time.Before(expiresAt) {
+		expiresAt = exp.Time
+	}
+
+	return expiresAt, time.Now().Before(expiresAt)
+}
+
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+
+	return false
+}
+
+func isRejected(err error) bool {
+	switch status.Code(err) {
+	case codes.PermissionDenied, codes.Unauthenticated, codes.InvalidArgument:
+		return true
+	}
+
+	return false
+}
+
+// cacheKey covers the client and the scopes too: a bound token is valid only for its own client,
+// a result for some scopes says nothing about others.
+func cacheKey(token string, client ClientContext, scopes []string) string {
+	sum := sha256.Sum256([]byte(token + "\n" + client.IP + "\n" + client.UserAgent + "\n" + client.KeyThumbprint +
+		"\n" + strings.Join(scopes, " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+func withDefaults(cfg Config) Config {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	} else if cfg.Retries == 0 {
+		cfg.Retries = defaultRetries
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if cfg.RetryMaxDelay <= 0 {
+		cfg.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = defaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = defaultBreakerCooldown
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	if cfg.ProofMaxAge <= 0 {
+		cfg.ProofMaxAge = defaultProofMaxAge
+	}
+
+	return cfg
+}
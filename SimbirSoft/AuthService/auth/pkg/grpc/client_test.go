@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCall_Retries(t *testing.T) {
+	const retries = 3
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "success",
+			errs:         []error{nil},
+			wantAttempts: 1,
+		},
+		{
+			name:         "transient failure is retried",
+			errs:         []error{status.Error(codes.Unavailable, ""), status.Error(codes.DeadlineExceeded, ""), nil},
+			wantAttempts: 3,
+		},
+		{
+			name:         "retry budget exhausted",
+			errs:         []error{status.Error(codes.Unavailable, "")},
+			wantAttempts: retries + 1,
+			wantErr:      ErrUnavailable,
+		},
+		{
+			name:         "unauthenticated is not retried",
+			errs:         []error{status.Error(codes.Unauthenticated, "")},
+			wantAttempts: 1,
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         "permission denied is not retried",
+			errs:         []error{status.Error(codes.PermissionDenied, "")},
+			wantAttempts: 1,
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         "invalid argument is not retried",
+			errs:         []error{status.Error(codes.InvalidArgument, "")},
+			wantAttempts: 1,
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         "internal is not retried",
+			errs:         []error{status.Error(codes.Internal, "")},
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(retries)
+
+			attempts := 0
+			err := c.call(context.Background(), func(context.Context) error {
+				err := tt.errs[min(attempts, len(tt.errs)-1)]
+				attempts++
+				return err
+			})
+
+			assert.Equal(t, tt.wantAttempts, attempts)
+
+			last := tt.errs[len(tt.errs)-1]
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case last != nil:
+				assert.Equal(t, status.Code(last), status.Code(err))
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCall_OpenBreakerRejectsWithoutCalling(t *testing.T) {
+	c := newTestClient(0)
+	failN(c.breaker, c.cfg.BreakerThreshold)
+
+	called := false
+	err := c.call(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.False(t, called)
+}
+
+func TestCall_RejectionKeepsBreakerClosed(t *testing.T) {
+	const threshold = 2
+
+	c := newTestClient(0)
+	c.breaker = newBreaker(threshold, time.Minute)
+
+	for range threshold * 2 {
+		err := c.call(context.Background(), func(context.Context) error {
+			return status.Error(codes.Unauthenticated, "")
+		})
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	}
+
+	assert.True(t, c.breaker.allow())
+}
+
+func TestBackoff(t *testing.T) {
+	c := newTestClient(0)
+	c.cfg.RetryBaseDelay = 10 * time.Millisecond
+	c.cfg.RetryMaxDelay = 40 * time.Millisecond
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay := c.backoff(attempt)
+		assert.Positive(t, delay)
+		assert.LessOrEqual(t, delay, c.cfg.RetryMaxDelay)
+	}
+}
+
+func newTestClient(retries int) *Client {
+	if retries == 0 {
+		retries = -1 // 0 means the default for Config
+	}
+
+	cfg := withDefaults(Config{
+		Retries:          retries,
+		RetryBaseDelay:   time.Microsecond,
+		RetryMaxDelay:    time.Microsecond,
+		BreakerThreshold: 100,
+	})
+
+	return &Client{cfg: cfg, breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Proofs of possession of the client key in the style of DPoP (RFC 9449), adapted to gRPC:
+// the client sends a JWT in the "dpop" metadata of every call, signed with its P-256 key
+// (ES256) and carrying the public key in the jwk header. htm is always "POST" and htu is the
+// full method name of the call, so a proof can't be reused for another method.
+const (
+	ProofMetadataKey = "dpop"
+
+	proofType   = "dpop+jwt"
+	proofMethod = "POST"
+	// Размер координаты P-256 в байтах
+	p256CoordSize = 32
+)
+
+var ErrInvalidProof = errors.New("invalid dpop proof")
+
+type proofClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+}
+
+// NewProof signs a proof for a call of fullMethod, e.g. "/bank.Bank/Transfer".
+func NewProof(key *ecdsa.PrivateKey, fullMethod string) (string, error) {
+	jwk, err := publicJWK(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, proofClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       hex.EncodeToString(jti),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		HTM: proofMethod,
+		HTU: fullMethod,
+	})
+	token.Header["typ"] = proofType
+	token.Header["jwk"] = jwk
+
+	return token.SignedString(key)
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the public key, base64url.
+// It is the key_thumbprint the client passes to Login.
+func Thumbprint(pub *ecdsa.PublicKey) (string, error) {
+	jwk, err := publicJWK(pub)
+	if err != nil {
+		return "", err
+	}
+
+	return jwkThumbprint(jwk), nil
+}
+
+// VerifyProof checks the proof for a call of fullMethod and returns the thumbprint of its key.
+// Proofs issued more than maxAge ago or ahead are rejected; proofs are not remembered,
+// so within maxAge a proof can be replayed for the same method.
+func VerifyProof(proof string, fullMethod string, maxAge time.Duration) (string, error) {
+	var jwk map[string]string
+
+	claims := &proofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, errors.New("typ must be " + proofType)
+		}
+
+		raw, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("no jwk header")
+		}
+		jwk = make(map[string]string, len(raw))
+		for k, v := range raw {
+			if s, ok := v.(string); ok {
+				jwk[k] = s
+			}
+		}
+
+		return parseJWK(jwk)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	if claims.HTM != proofMethod || claims.HTU != fullMethod {
+		return "", fmt.Errorf("%w: issued for %s %s", ErrInvalidProof, claims.HTM, claims.HTU)
+	}
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: jti and iat are required", ErrInvalidProof)
+	}
+	if age := time.Since(claims.IssuedAt.Time); age > maxAge || age < -maxAge {
+		return "", fmt.Errorf("%w: iat is out of range", ErrInvalidProof)
+	}
+
+	return jwkThumbprint(jwk), nil
+}
+
+func publicJWK(pub *ecdsa.PublicKey) (map[string]string, error) {
+	if pub.Curve != elliptic.P256() {
+		return nil, errors.New("only P-256 keys are supported")
+	}
+
+	// координаты в JWK дополняются нулями до полного размера (RFC 7518, 6.2.1.2)
+	x := make([]byte, p256CoordSize)
+	y := make([]byte, p256CoordSize)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+
+	return map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}, nil
+}
+
+func parseJWK(jwk map[string]string) (*ecdsa.PublicKey, error) {
+	if jwk["kty"] != "EC" || jwk["crv"] != "P-256" {
+		return nil, errors.New("only EC P-256 jwk is supported")
+	}
+
+	x, errX := base64.RawURLEncoding.DecodeString(jwk["x"])
+	y, errY := base64.RawURLEncoding.DecodeString(jwk["y"])
+	if errX != nil || errY != nil || len(x) != p256CoordSize || len(y) != p256CoordSize {
+		return nil, errors.New("malformed jwk coordinates")
+	}
+
+	// ecdh проверяет, что точка лежит на кривой
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, fmt.Errorf("jwk: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// jwkThumbprint hashes the required members of an EC key in lexicographic order (RFC 7638).
+func jwkThumbprint(jwk map[string]string) string {
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk["crv"], jwk["kty"], jwk["x"], jwk["y"])
+	sum := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity stored by UnaryServerInterceptor.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// ContextWithIdentity stores the identity in the context, mostly useful in tests.
+func ContextWithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+type InterceptorOption func(*interceptorOptions)
+
+type interceptorOptions struct {
+	skip            map[string]bool
+	denyImpersonate map[string]bool
+	scopes          map[string][]string
+	forwardedFor    bool
+}
+
+// WithSkipMethods disables validation for the given full method names,
+// e.g. "/bank.Bank/AccountLock".
+func WithSkipMethods(methods ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		for _, m := range methods {
+			o.skip[m] = true
+		}
+	}
+}
+
+// WithDenyImpersonation rejects impersonation tokens for the given full method
+// names with PermissionDenied, e.g. for operations that move money.
+func WithDenyImpersonation(methods ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		for _, m := range methods {
+			o.denyImpersonate[m] = true
+		}
+	}
+}
+
+// WithRequiredScopes lets only tokens granted all the scopes call the full method,
+// e.g. "/bank.Bank/Transfer". Tokens without scope are rejected with PermissionDenied.
+func WithRequiredScopes(method string, scopes ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.scopes[method] = append(o.scopes[method], scopes...)
+	}
+}
+
+// WithForwardedFor takes the client IP for bound tokens from the first address of the
+// "x-forwarded-for" metadata instead of the peer address. Use it only behind a proxy
+// which sets the header, otherwise the caller chooses its own address.
+func WithForwardedFor() InterceptorOption {
+	return func(o *interceptorOptions) {
+		o.forwardedFor = true
+	}
+}
+
+// UnaryServerInterceptor validates the caller's token before the handler runs
+// and stores the resulting Identity in the handler's context.
+//
+// The token is taken from the "authorization" metadata ("Bearer <token>") or,
+// if absent, from a request field exposed as GetJwt() or GetToken(). The caller
+// is described to auth by ClientFromRequest, so tokens bound to another client are rejected.
+func (c *Client) UnaryServerInterceptor(opts ...InterceptorOption) grpc.UnaryServerInterceptor {
+	o := newInterceptorOptions(opts)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if o.skip[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ctx, err := c.authorize(ctx, o, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls. The token is
+// validated when the handler receives the first message, so it may come in a field of
+// that message too; until then the stream context carries no Identity.
+func (c *Client) StreamServerInterceptor(opts ...InterceptorOption) grpc.StreamServerInterceptor {
+	o := newInterceptorOptions(opts)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if o.skip[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			ctx:          ss.Context(),
+			authorize: func(ctx context.Context, req any) (context.Context, error) {
+				return c.authorize(ctx, o, info.FullMethod, req)
+			},
+		})
+	}
+}
+
+func newInterceptorOptions(opts []InterceptorOption) *interceptorOptions {
+	o := &interceptorOptions{skip: map[string]bool{}, denyImpersonate: map[string]bool{}, scopes: map[string][]string{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// authorize validates the token of the call and returns the context with its Identity.
+// Errors are gRPC statuses ready to be returned to the caller.
+func (c *Client) authorize(ctx context.Context, o *interceptorOptions, fullMethod string, req any) (context.Context, error) {
+	client, err := c.ClientFromRequest(ctx, fullMethod, o.forwardedFor)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, "invalid dpop proof")
+	}
+
+	identity, err := c.ValidateClient(ctx, TokenFromRequest(ctx, req), client, o.scopes[fullMethod]...)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, status.Error(codes.PermissionDenied, "invalid token")
+		}
+		return nil, status.Error(codes.Unavailable, "auth service is unavailable")
+	}
+
+	if identity.Impersonated() && o.denyImpersonate[fullMethod] {
+		return nil, status.Error(codes.PermissionDenied, "not allowed under impersonation")
+	}
+
+	return ContextWithIdentity(ctx, identity), nil
+}
+
+// authorizedStream authorizes the call on the first received message.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx        context.Context
+	authorize  func(ctx context.Context, req any) (context.Context, error)
+	authorized bool
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.authorized {
+		return nil
+	}
+
+	ctx, err := s.authorize(s.ctx, m)
+	if err != nil {
+		return err
+	}
+	s.ctx, s.authorized = ctx, true
+
+	return nil
+}
+
+// TokenFromRequest extracts the caller's token, see UnaryServerInterceptor.
+func TokenFromRequest(ctx context.Context, req any) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			if token, ok := strings.CutPrefix(v, "Bearer "); ok && token != "" {
+				return token
+			}
+		}
+	}
+
+	switch r := req.(type) {
+	case interface{ GetJwt() string }:
+		return r.GetJwt()
+	case interface{ GetToken() string }:
+		return r.GetToken()
+	}
+
+	return ""
+}
+
+// ClientFromRequest describes the caller of fullMethod: its peer address (or the first address
+// of "x-forwarded-for" with forwardedFor), the "user-agent" metadata and, if the call carries
+// a proof in the "dpop" metadata, the thumbprint of the proven key. An invalid proof is an error.
+func (c *Client) ClientFromRequest(ctx context.Context, fullMethod string, forwardedFor bool) (ClientContext, error) {
+	var client ClientContext
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if v := md.Get("x-forwarded-for"); forwardedFor && len(v) > 0 {
+		first, _, _ := strings.Cut(v[0], ",")
+		client.IP = strings.TrimSpace(first)
+	} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+	}
+
+	if v := md.Get("user-agent"); len(v) > 0 {
+		client.UserAgent = v[0]
+	}
+
+	if v := md.Get(ProofMetadataKey); len(v) > 0 {
+		jkt, err := VerifyProof(v[0], fullMethod, c.cfg.ProofMaxAge)
+		if err != nil {
+			return ClientContext{}, err
+		}
+		client.KeyThumbprint = jkt
+	}
+
+	return client, nil
+}
@@ -0,0 +1,70 @@
+// Package webhook describes the webhooks the auth service sends and lets receivers verify them.
+//
+// Every request is a POST with a JSON Event body. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where timestamp is the
+// value of the X-Webhook-Timestamp header in unix seconds. Deliveries are at least once,
+// receivers deduplicate by the X-Webhook-Id header (the event ID).
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	ErrBadSignature = errors.New("webhook signature mismatch")
+	ErrStale        = errors.New("webhook timestamp is out of tolerance")
+)
+
+// Event is the body of a webhook request.
+type Event struct {
+	ID         int64             `json:"id"`
+	Type       string            `json:"type"` // user.registered, user.email_changed, user.disabled, user.enabled, user.deleted
+	Realm      string            `json:"realm"`
+	UserID     int64             `json:"user_id"`
+	Data       map[string]string `json:"data"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// Sign returns the value of the X-Webhook-Signature header.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received request with the already read body.
+// Requests older or newer than tolerance are rejected to limit replays.
+func Verify(secret []byte, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+
+	if d := time.Since(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+		return ErrStale
+	}
+
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApps_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	const appTTL = 5 * time.Minute
+
+	respCreate, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{
+		Token:           adminToken,
+		Name:            "app-" + gofakeit.Lexify("????????"),
+		RedirectOrigins: []string{"https://bank.example.com"},
+		TokenTtlSeconds: int64(appTTL / time.Second),
+	})
+	require.NoError(t, err)
+	app := respCreate.GetApp()
+	require.NotZero(t, app.GetId())
+	assert.True(t, app.GetEnabled())
+
+	respList, err := st.AuthClient.ListApps(ctx, &api.ListAppsRequest{Token: adminToken})
+	require.NoError(t, err)
+	var ids []int64
+	for _, a := range respList.GetApps() {
+		ids = append(ids, a.GetId())
+	}
+	assert.Contains(t, ids, app.GetId())
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err = st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	loginTime := time.Now()
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: app.GetId()})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: app.GetId()})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, strconv.FormatInt(app.GetId(), 10), respIntrospect.GetClientId())
+
+	const deltaSeconds = 1
+
+	// TTL приложения важнее TTL realm
+	assert.InDelta(t, loginTime.Add(appTTL).Unix(), respIntrospect.GetExp(), deltaSeconds)
+}
+
+func TestApps_TokenBoundToApp(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	createApp := func() int64 {
+		resp, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{
+			Token: adminToken,
+			Name:  "app-" + gofakeit.Lexify("????????"),
+		})
+		require.NoError(t, err)
+
+		return resp.GetApp().GetId()
+	}
+	appID, otherAppID := createApp(), createApp()
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	// токен приложения не принимают ни другое приложение, ни проверка без приложения
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: otherAppID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// и наоборот: токен без приложения приложению не подходит
+	respLogin, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respLogin.GetToken(), AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// отключение приложения сразу инвалидирует его токены
+	_, err = st.AuthClient.UpdateApp(ctx, &api.UpdateAppRequest{Token: adminToken, AppId: appID, Enabled: false})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestApps_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	userToken, _ := registerAndLogin(ctx, t, st, gofakeit.Email())
+
+	name := "app-" + gofakeit.Lexify("????????")
+	_, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{Token: adminToken, Name: name})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		appName string
+		origins []string
+		code    codes.Code
+	}{
+		{
+			name:    "Not an admin",
+			token:   userToken,
+			appName: "app-" + gofakeit.Lexify("????????"),
+			code:    codes.PermissionDenied,
+		},
+		{
+			name:    "Duplicate name",
+			token:   adminToken,
+			appName: name,
+			code:    codes.AlreadyExists,
+		},
+		{
+			name:    "Empty name",
+			token:   adminToken,
+			appName: "",
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "Origin with path",
+			token:   adminToken,
+			appName: "app-" + gofakeit.Lexify("????????"),
+			origins: []string{"https://bank.example.com/callback"},
+			code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{
+				Token:           tt.token,
+				Name:            tt.appName,
+				RedirectOrigins: tt.origins,
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	_, err = st.AuthClient.UpdateApp(ctx, &api.UpdateAppRequest{Token: adminToken, AppId: 1 << 40, Enabled: true})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
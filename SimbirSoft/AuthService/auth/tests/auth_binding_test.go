@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	client "gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/grpc"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBinding_ClientContext(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name    string
+		binding string
+		login   *api.ClientContext
+		same    *api.ClientContext // другой запрос того же клиента
+		other   *api.ClientContext
+	}{
+		{
+			name:    "IP subnet",
+			binding: "ip",
+			login:   &api.ClientContext{Ip: "192.0.2.10"},
+			same:    &api.ClientContext{Ip: "192.0.2.77:51000"},
+			other:   &api.ClientContext{Ip: "198.51.100.10"},
+		},
+		{
+			name:    "User agent",
+			binding: "user_agent",
+			login:   &api.ClientContext{UserAgent: "bank-app/1.0"},
+			same:    &api.ClientContext{UserAgent: "bank-app/1.0", Ip: "198.51.100.10"},
+			other:   &api.ClientContext{UserAgent: "curl/8.0"},
+		},
+		{
+			name:    "IP and user agent",
+			binding: "ip_user_agent",
+			login:   &api.ClientContext{Ip: "2001:db8::1", UserAgent: "bank-app/1.0"},
+			same:    &api.ClientContext{Ip: "2001:db8::2", UserAgent: "bank-app/1.0"},
+			other:   &api.ClientContext{Ip: "2001:db8:1::1", UserAgent: "bank-app/1.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appID := createBindingApp(ctx, t, st, tt.binding)
+			email, pass := registerUser(ctx, t, st)
+
+			respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: appID, Client: tt.login})
+			require.NoError(t, err)
+			token := respLogin.GetToken()
+
+			_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: appID, Client: tt.same})
+			require.NoError(t, err)
+
+			_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: appID, Client: tt.other})
+			require.Error(t, err)
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+			// без контекста клиента привязанный токен не принимается
+			_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: appID})
+			require.Error(t, err)
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
+func TestBinding_Key(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	appID := createBindingApp(ctx, t, st, "key")
+	email, pass := registerUser(ctx, t, st)
+
+	newThumbprint := func() string {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		jkt, err := client.Thumbprint(&key.PublicKey)
+		require.NoError(t, err)
+
+		return jkt
+	}
+	jkt, otherJKT := newThumbprint(), newThumbprint()
+
+	// ключ обязателен
+	_, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    email,
+		Password: pass,
+		AppId:    appID,
+		Client:   &api.ClientContext{KeyThumbprint: jkt},
+	})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:  token,
+		AppId:  appID,
+		Client: &api.ClientContext{KeyThumbprint: jkt},
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:  token,
+		AppId:  appID,
+		Client: &api.ClientContext{KeyThumbprint: otherJKT},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestBinding_ModeChangeInvalidatesTokens(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	respCreate, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{
+		Token: adminToken,
+		Name:  "app-" + gofakeit.Lexify("????????"),
+	})
+	require.NoError(t, err)
+	appID := respCreate.GetApp().GetId()
+	assert.Equal(t, "none", respCreate.GetApp().GetBinding())
+
+	email, pass := registerUser(ctx, t, st)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	respUpdate, err := st.AuthClient.UpdateApp(ctx, &api.UpdateAppRequest{
+		Token:   adminToken,
+		AppId:   appID,
+		Enabled: true,
+		Binding: "user_agent",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user_agent", respUpdate.GetApp().GetBinding())
+
+	// токен выдан без привязки, а приложение теперь ее требует
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:  respLogin.GetToken(),
+		AppId:  appID,
+		Client: &api.ClientContext{UserAgent: "bank-app/1.0"},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.UpdateApp(ctx, &api.UpdateAppRequest{
+		Token:   adminToken,
+		AppId:   appID,
+		Enabled: true,
+		Binding: "cookie",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func createBindingApp(ctx context.Context, t *testing.T, st *suite.Suite, binding string) int64 {
+	t.Helper()
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	resp, err := st.AuthClient.CreateApp(ctx, &api.CreateAppRequest{
+		Token:   adminToken,
+		Name:    "app-" + gofakeit.Lexify("????????"),
+		Binding: binding,
+	})
+	require.NoError(t, err)
+	require.Equal(t, binding, resp.GetApp().GetBinding())
+
+	return resp.GetApp().GetId()
+}
+
+func registerUser(ctx context.Context, t *testing.T, st *suite.Suite) (string, string) {
+	t.Helper()
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	return email, pass
+}
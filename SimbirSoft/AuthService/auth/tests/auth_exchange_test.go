@@ -0,0 +1,402 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestScope_ValidateFailsClosed(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email, pass := registerUser(ctx, t, st)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    email,
+		Password: pass,
+		Audience: []string{"bank"},
+		Scope:    "accounts:read transfers:write",
+	})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:    token,
+		Audience: "bank",
+		Scopes:   []string{"accounts:read"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "accounts:read transfers:write", respValidate.GetScope())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: token})
+	require.NoError(t, err)
+	assert.Equal(t, "accounts:read transfers:write", respIntrospect.GetScope())
+	assert.Contains(t, respIntrospect.GetAud(), "bank")
+
+	// токен без scope не проходит ни одну проверку scope
+	respUnscoped, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		scopes   []string
+	}{
+		{
+			name:     "Other audience",
+			token:    token,
+			audience: "ledger",
+		},
+		{
+			name:     "Realm as audience",
+			token:    token,
+			audience: st.Cfg.DefaultRealm,
+		},
+		{
+			name:   "Scope not granted",
+			token:  token,
+			scopes: []string{"accounts:read", "accounts:close"},
+		},
+		{
+			name:   "Token without scope",
+			token:  respUnscoped.GetToken(),
+			scopes: []string{"accounts:read"},
+		},
+		{
+			name:     "Token without audience",
+			token:    respUnscoped.GetToken(),
+			audience: "bank",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+				Token:    tt.token,
+				Audience: tt.audience,
+				Scopes:   tt.scopes,
+			})
+			require.Error(t, err)
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+	}
+}
+
+func TestScope_LoginGrantsOnlyRealmScopes(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// fx:write в realm по умолчанию выдается только администраторам (миграция 10_scopes)
+	email, pass := registerUser(ctx, t, st)
+
+	tests := []struct {
+		name  string
+		scope string
+		code  codes.Code
+	}{
+		{
+			name:  "Admin only scope",
+			scope: "accounts:read fx:write",
+			code:  codes.PermissionDenied,
+		},
+		{
+			name:  "Unknown scope",
+			scope: "accounts:read accounts:everything",
+			code:  codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Scope: tt.scope})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	st.GrantAdmin(ctx, email)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Scope: "accounts:read fx:write"})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, Scopes: []string{"fx:write"}})
+	require.NoError(t, err)
+	assert.Equal(t, "accounts:read fx:write", respValidate.GetScope())
+
+	// без роли администратора scope администратора пропадает сразу, а не когда истечет токен
+	st.Userctl(ctx, "revoke-admin", email)
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, Scopes: []string{"fx:write"}})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respValidate, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, Scopes: []string{"accounts:read"}})
+	require.NoError(t, err)
+	assert.Equal(t, "accounts:read", respValidate.GetScope())
+}
+
+func TestScope_ManagedPerRealm(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	realm := "test-" + gofakeit.Lexify("??????????")
+	st.CreateRealm(ctx, realm)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass, Realm: realm})
+	require.NoError(t, err)
+
+	// в новом realm нет ни одного scope
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Realm: realm, Scope: "accounts:read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	st.Realms(ctx, "add-scope", realm, "accounts:read")
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Realm: realm, Scope: "accounts:read"})
+	require.NoError(t, err)
+
+	st.Realms(ctx, "add-scope", "-admin-only", realm, "accounts:read")
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Realm: realm, Scope: "accounts:read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	st.Realms(ctx, "remove-scope", realm, "accounts:read")
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Realm: realm, Scope: "accounts:read"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTokenExchange_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email, pass := registerUser(ctx, t, st)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    email,
+		Password: pass,
+		Audience: []string{"bank", "ledger"},
+		Scope:    "accounts:read transfers:write",
+	})
+	require.NoError(t, err)
+
+	exchangeTime := time.Now()
+
+	respExchange, err := st.AuthClient.TokenExchange(ctx, &api.TokenExchangeRequest{
+		SubjectToken: respLogin.GetToken(),
+		Audience:     []string{"ledger"},
+		Scope:        "transfers:write",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "urn:ietf:params:oauth:token-type:access_token", respExchange.GetIssuedTokenType())
+	assert.Equal(t, "Bearer", respExchange.GetTokenType())
+	assert.Equal(t, "transfers:write", respExchange.GetScope())
+
+	const deltaSeconds = 1
+	assert.InDelta(t, st.Cfg.ExchangeTTL.Seconds(), respExchange.GetExpiresIn(), deltaSeconds)
+
+	exchanged := respExchange.GetAccessToken()
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: exchanged})
+	require.NoError(t, err)
+	assert.InDelta(t, exchangeTime.Add(st.Cfg.ExchangeTTL).Unix(), respIntrospect.GetExp(), deltaSeconds)
+	assert.NotContains(t, respIntrospect.GetAud(), "bank")
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:    exchanged,
+		Audience: "ledger",
+		Scopes:   []string{"transfers:write"},
+	})
+	require.NoError(t, err)
+
+	respSubject, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, respSubject.GetId(), respValidate.GetId())
+
+	// новый токен уже, чем исходный
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: exchanged, Audience: "bank"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:    exchanged,
+		Audience: "ledger",
+		Scopes:   []string{"accounts:read"},
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestTokenExchange_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email, pass := registerUser(ctx, t, st)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    email,
+		Password: pass,
+		Audience: []string{"bank", "ledger"},
+		Scope:    "accounts:read transfers:write",
+	})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	respExchange, err := st.AuthClient.TokenExchange(ctx, &api.TokenExchangeRequest{
+		SubjectToken: token,
+		Audience:     []string{"ledger"},
+		Scope:        "transfers:write",
+	})
+	require.NoError(t, err)
+
+	respUnscoped, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		audience  []string
+		scope     string
+		code      codes.Code
+	}{
+		{
+			name:     "Wider scope",
+			token:    token,
+			audience: []string{"ledger"},
+			scope:    "transfers:write accounts:close",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Audience of another service",
+			token:    token,
+			audience: []string{"cards"},
+			scope:    "transfers:write",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Realm as audience",
+			token:    token,
+			audience: []string{st.Cfg.DefaultRealm},
+			scope:    "transfers:write",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Unscoped subject token",
+			token:    respUnscoped.GetToken(),
+			audience: []string{"ledger"},
+			scope:    "transfers:write",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Exchanged token back to a wider audience",
+			token:    respExchange.GetAccessToken(),
+			audience: []string{"bank"},
+			scope:    "transfers:write",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Invalid subject token",
+			token:    "not-a-token",
+			audience: []string{"ledger"},
+			scope:    "transfers:write",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:  "No audience",
+			token: token,
+			scope: "transfers:write",
+			code:  codes.InvalidArgument,
+		},
+		{
+			name:     "No scope",
+			token:    token,
+			audience: []string{"ledger"},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:      "Unsupported token type",
+			token:     token,
+			tokenType: "urn:ietf:params:oauth:token-type:refresh_token",
+			audience:  []string{"ledger"},
+			scope:     "transfers:write",
+			code:      codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.TokenExchange(ctx, &api.TokenExchangeRequest{
+				SubjectToken:     tt.token,
+				SubjectTokenType: tt.tokenType,
+				Audience:         tt.audience,
+				Scope:            tt.scope,
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestTokenExchange_KeepsApp(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	appID := createBindingApp(ctx, t, st, "user_agent")
+	otherAppID := createBindingApp(ctx, t, st, "none")
+	email, pass := registerUser(ctx, t, st)
+	client := &api.ClientContext{UserAgent: "bank-app/1.0"}
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    email,
+		Password: pass,
+		AppId:    appID,
+		Client:   client,
+		Audience: []string{"bank", "ledger"},
+		Scope:    "accounts:read transfers:write",
+	})
+	require.NoError(t, err)
+
+	respExchange, err := st.AuthClient.TokenExchange(ctx, &api.TokenExchangeRequest{
+		SubjectToken: respLogin.GetToken(),
+		Audience:     []string{"ledger"},
+		Scope:        "transfers:write",
+		Client:       client,
+	})
+	require.NoError(t, err)
+	exchanged := respExchange.GetAccessToken()
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: exchanged})
+	require.NoError(t, err)
+	assert.Equal(t, strconv.FormatInt(appID, 10), respIntrospect.GetClientId())
+
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{
+		Token:    exchanged,
+		AppId:    appID,
+		Client:   client,
+		Audience: "ledger",
+		Scopes:   []string{"transfers:write"},
+	})
+	require.NoError(t, err)
+
+	// обмен не отвязывает токен ни от приложения, ни от клиента
+	for _, req := range []*api.ValidateTokenRequest{
+		{Token: exchanged, Audience: "ledger"},
+		{Token: exchanged, AppId: otherAppID, Audience: "ledger"},
+		{Token: exchanged, AppId: appID, Client: &api.ClientContext{UserAgent: "curl/8.0"}, Audience: "ledger"},
+	} {
+		_, err = st.AuthClient.ValidateToken(ctx, req)
+		require.Error(t, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+}
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestImpersonate_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, adminID := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	targetEmail := gofakeit.Email()
+	_, targetID := registerAndLogin(ctx, t, st, targetEmail)
+
+	issueTime := time.Now()
+
+	respImpersonate, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "ticket 42: customer can't see the transfer",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, respImpersonate.GetToken())
+
+	const deltaSeconds = 1
+
+	assert.InDelta(t, issueTime.Add(st.Cfg.ImpersonationTTL).Unix(), respImpersonate.GetExpiresAt(), deltaSeconds)
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respImpersonate.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, targetID, respValidate.GetId())
+	assert.Equal(t, adminID, respValidate.GetActorId())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: respImpersonate.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, targetEmail, respIntrospect.GetEmail())
+	assert.Equal(t, strconv.FormatInt(adminID, 10), respIntrospect.GetAct().GetSub())
+
+	// у обычного токена актора нет
+	respValidate, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: adminToken})
+	require.NoError(t, err)
+	assert.Zero(t, respValidate.GetActorId())
+}
+
+func TestImpersonate_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	userToken, userID := registerAndLogin(ctx, t, st, gofakeit.Email())
+
+	respImpersonate, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: userID,
+		Reason:       "support",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		targetID int64
+		reason   string
+		code     codes.Code
+	}{
+		{
+			name:     "Not an admin",
+			token:    userToken,
+			targetID: userID,
+			reason:   "support",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Impersonation token",
+			token:    respImpersonate.GetToken(),
+			targetID: userID,
+			reason:   "support",
+			code:     codes.PermissionDenied,
+		},
+		{
+			name:     "Invalid token",
+			token:    "invalid",
+			targetID: userID,
+			reason:   "support",
+			code:     codes.Unauthenticated,
+		},
+		{
+			name:     "Unknown target",
+			token:    adminToken,
+			targetID: 1 << 40,
+			reason:   "support",
+			code:     codes.NotFound,
+		},
+		{
+			name:     "Empty reason",
+			token:    adminToken,
+			targetID: userID,
+			reason:   "",
+			code:     codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+				Token:        tt.token,
+				TargetUserId: tt.targetID,
+				Reason:       tt.reason,
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestImpersonate_AppBound(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, adminID := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	_, targetID := registerAndLogin(ctx, t, st, gofakeit.Email())
+
+	appID := createBindingApp(ctx, t, st, "user_agent")
+	otherAppID := createBindingApp(ctx, t, st, "none")
+	client := &api.ClientContext{UserAgent: "support-console/1.0"}
+
+	// приложение привязывает токены, без контекста клиента токен не выдается
+	_, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "support",
+		AppId:        appID,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	respImpersonate, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "support",
+		AppId:        appID,
+		Client:       client,
+	})
+	require.NoError(t, err)
+	token := respImpersonate.GetToken()
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token, AppId: appID, Client: client})
+	require.NoError(t, err)
+	assert.Equal(t, targetID, respValidate.GetId())
+	assert.Equal(t, adminID, respValidate.GetActorId())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: token})
+	require.NoError(t, err)
+	assert.Equal(t, strconv.FormatInt(appID, 10), respIntrospect.GetClientId())
+
+	for _, req := range []*api.ValidateTokenRequest{
+		{Token: token},
+		{Token: token, AppId: otherAppID},
+		{Token: token, AppId: appID, Client: &api.ClientContext{UserAgent: "curl/8.0"}},
+	} {
+		_, err = st.AuthClient.ValidateToken(ctx, req)
+		require.Error(t, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+
+	_, err = st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "support",
+		AppId:        otherAppID + 1_000_000,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestImpersonate_DisabledTarget(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	targetEmail := gofakeit.Email()
+	_, targetID := registerAndLogin(ctx, t, st, targetEmail)
+
+	st.Userctl(ctx, "disable", targetEmail)
+
+	_, err := st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "support",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, err.Error(), "user is disabled")
+
+	st.Userctl(ctx, "enable", targetEmail)
+
+	_, err = st.AuthClient.Impersonate(ctx, &api.ImpersonateRequest{
+		Token:        adminToken,
+		TargetUserId: targetID,
+		Reason:       "support",
+	})
+	require.NoError(t, err)
+}
+
+// registerAndLogin returns the token and ID of a new user.
+func registerAndLogin(ctx context.Context, t *testing.T, st *suite.Suite, email string) (string, int64) {
+	t.Helper()
+
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+
+	return respLogin.GetToken(), respValidate.GetId()
+}
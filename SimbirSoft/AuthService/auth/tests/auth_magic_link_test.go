@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+)
+
+var magicLinkToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestMagicLink_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RequestMagicLink(ctx, &api.RequestMagicLinkRequest{Email: email})
+	require.NoError(t, err)
+
+	linkToken := readMagicLinkToken(t, st, email)
+
+	respConsume, err := st.AuthClient.ConsumeMagicLink(ctx, &api.ConsumeMagicLinkRequest{Token: linkToken})
+	require.NoError(t, err)
+	require.NotEmpty(t, respConsume.GetToken())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: respConsume.GetToken()})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, email, respIntrospect.GetEmail())
+
+	// ссылка одноразовая
+	_, err = st.AuthClient.ConsumeMagicLink(ctx, &api.ConsumeMagicLinkRequest{Token: linkToken})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "invalid or expired magic link")
+}
+
+func TestMagicLink_UnknownEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// ответ не должен выдавать, зарегистрирован ли email
+	_, err := st.AuthClient.RequestMagicLink(ctx, &api.RequestMagicLinkRequest{Email: gofakeit.Email()})
+	require.NoError(t, err)
+}
+
+func TestMagicLink_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name        string
+		token       string
+		expectedErr string
+	}{
+		{
+			name:        "Empty token",
+			token:       "",
+			expectedErr: "Token is missed",
+		},
+		{
+			name:        "Unknown token",
+			token:       "not-a-real-token",
+			expectedErr: "invalid or expired magic link",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ConsumeMagicLink(ctx, &api.ConsumeMagicLinkRequest{Token: tt.token})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+}
+
+// readMagicLinkToken достает токен из письма в outbox файлового mailer'а,
+// тесты запускаются из ./tests, поэтому относительный путь считается от корня сервиса
+func readMagicLinkToken(t *testing.T, st *suite.Suite, email string) string {
+	t.Helper()
+
+	dir := st.Cfg.Mailer.OutboxDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join("..", dir)
+	}
+
+	var files []string
+	require.Eventually(t, func() bool {
+		files, _ = filepath.Glob(filepath.Join(dir, "*-"+email+".eml"))
+		return len(files) > 0
+	}, 5*time.Second, 100*time.Millisecond, "no email for %s in %s", email, dir)
+
+	body, err := os.ReadFile(files[len(files)-1])
+	require.NoError(t, err)
+
+	match := magicLinkToken.FindStringSubmatch(string(body))
+	require.Len(t, match, 2)
+
+	return match[1]
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRealm_SeparateUsersAndTokens(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	realm := "test-" + gofakeit.Lexify("??????????")
+	st.CreateRealm(ctx, realm)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	// один и тот же email регистрируется в обоих realm
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+	_, err = st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass, Realm: realm})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass, Realm: realm})
+	require.NoError(t, err)
+
+	respValidate, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respLogin.GetToken(), Realm: realm})
+	require.NoError(t, err)
+	assert.NotZero(t, respValidate.GetId())
+
+	// realm из metadata работает так же, как поле запроса
+	mdCtx := metadata.AppendToOutgoingContext(ctx, "x-realm", realm)
+	_, err = st.AuthClient.ValidateToken(mdCtx, &api.ValidateTokenRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: respLogin.GetToken(), Realm: realm})
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, realm, respIntrospect.GetIss())
+	assert.Equal(t, []string{realm}, respIntrospect.GetAud())
+
+	// в realm по умолчанию токен чужой
+	_, err = st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: respLogin.GetToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respIntrospect, err = st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+}
+
+func TestRealm_PasswordPolicy(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	realm := "test-" + gofakeit.Lexify("??????????")
+	st.CreateRealm(ctx, realm, "-password-min-length=12", "-password-require-digit")
+
+	tests := []struct {
+		name        string
+		password    string
+		expectedErr string
+	}{
+		{
+			name:        "Too short",
+			password:    "short1",
+			expectedErr: "password should be at least 12 characters",
+		},
+		{
+			name:        "No digit",
+			password:    "long enough password",
+			expectedErr: "password should contain a digit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: gofakeit.Email(), Password: tt.password, Realm: realm})
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: gofakeit.Email(), Password: "long enough password 1", Realm: realm})
+	require.NoError(t, err)
+}
+
+func TestRealm_Unknown(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.Login(ctx, &api.LoginRequest{
+		Email:    gofakeit.Email(),
+		Password: randomFakePassword(),
+		Realm:    "no-such-realm-" + gofakeit.Lexify("??????????"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "unknown realm")
+}
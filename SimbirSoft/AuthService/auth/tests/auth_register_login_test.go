@@ -5,20 +5,13 @@ import (
 	"time"
 
 	"github.com/brianvoe/gofakeit"
-	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
 )
 
-const (
-	emptyAppID = 0
-	idSec      = 1
-	appSecret  = "test-secret"
-
-	passDefaultLen = 10
-)
+const passDefaultLen = 10
 
 func TestRegisterLogin_Login_HappyPath(t *testing.T) {
 	ctx, st := suite.New(t)
@@ -36,7 +29,6 @@ func TestRegisterLogin_Login_HappyPath(t *testing.T) {
 	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{
 		Email:    email,
 		Password: pass,
-		// IdSec:    idSec,
 	})
 	require.NoError(t, err)
 
@@ -45,21 +37,18 @@ func TestRegisterLogin_Login_HappyPath(t *testing.T) {
 
 	loginTime := time.Now()
 
-	tokenParsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(appSecret), nil
-	})
+	// секрет подписи хранится зашифрованным, поэтому claims проверяем через Introspect
+	claims, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: token})
 	require.NoError(t, err)
+	require.True(t, claims.GetActive())
 
-	claims, ok := tokenParsed.Claims.(jwt.MapClaims)
-	require.True(t, ok)
-
-	assert.Equal(t, email, claims["email"].(string))
+	assert.Equal(t, email, claims.GetEmail())
 	//
 
 	const deltaSeconds = 1
 
 	// check if exp of token is in correct range, ttl get from st.Cfg.TokenTTL
-	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), claims["exp"].(float64), deltaSeconds)
+	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), claims.GetExp(), deltaSeconds)
 }
 
 func TestRegisterLogin_DuplicatedRegistration(t *testing.T) {
@@ -133,51 +122,46 @@ func TestLogin_FailCases(t *testing.T) {
 		name        string
 		email       string
 		password    string
-		idSec       int32
+		appID       int64
 		expectedErr string
 	}{
 		{
 			name:        "Login with Empty Password",
 			email:       gofakeit.Email(),
 			password:    "",
-			idSec:       1,
 			expectedErr: "password is required",
 		},
 		{
 			name:        "Login with Empty Email",
 			email:       "",
 			password:    randomFakePassword(),
-			idSec:       1,
 			expectedErr: "email is required",
 		},
 		{
 			name:        "Login with Both Empty Email and Password",
 			email:       "",
 			password:    "",
-			idSec:       1,
 			expectedErr: "email is required",
 		},
 		{
 			name:        "Login with Non-Matching Password",
 			email:       gofakeit.Email(),
 			password:    randomFakePassword(),
-			idSec:       1,
 			expectedErr: "Wrong email or password",
 		},
 		{
 			name:        "Login without @",
 			email:       "test.pek",
 			password:    randomFakePassword(),
-			idSec:       1,
 			expectedErr: "incorrect email",
 		},
-		// {
-		// 	name:        "Login with password less than 4 letters",
-		// 	email:       gofakeit.Email(),
-		// 	password:    randomFakePassword(),
-		// 	idSec:       1,
-		// 	expectedErr: "password should be bigger than 4 letters",
-		// },
+		{
+			name:        "Login with unknown app",
+			email:       gofakeit.Email(),
+			password:    randomFakePassword(),
+			appID:       1 << 40,
+			expectedErr: "unknown app",
+		},
 	}
 
 	for _, tt := range tests {
@@ -191,6 +175,7 @@ func TestLogin_FailCases(t *testing.T) {
 			_, err = st.AuthClient.Login(ctx, &api.LoginRequest{
 				Email:    tt.email,
 				Password: tt.password,
+				AppId:    tt.appID,
 			})
 			require.Error(t, err)
 			require.Contains(t, err.Error(), tt.expectedErr)
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/tests/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhookDeliveries_Admin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	respList, err := st.AuthClient.ListWebhookDeliveries(ctx, &api.ListWebhookDeliveriesRequest{
+		Token:  adminToken,
+		Status: "dead",
+		Limit:  10,
+	})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(respList.GetDeliveries()), 10)
+	for _, d := range respList.GetDeliveries() {
+		assert.Equal(t, "dead", d.GetStatus())
+	}
+
+	_, err = st.AuthClient.ReplayWebhookDelivery(ctx, &api.ReplayWebhookDeliveryRequest{
+		Token:      adminToken,
+		DeliveryId: 1 << 40,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestWebhookDeliveries_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminEmail := gofakeit.Email()
+	adminToken, _ := registerAndLogin(ctx, t, st, adminEmail)
+	st.GrantAdmin(ctx, adminEmail)
+
+	userToken, _ := registerAndLogin(ctx, t, st, gofakeit.Email())
+
+	tests := []struct {
+		name   string
+		token  string
+		status string
+		code   codes.Code
+	}{
+		{
+			name:  "Not an admin",
+			token: userToken,
+			code:  codes.PermissionDenied,
+		},
+		{
+			name:  "Empty token",
+			token: "",
+			code:  codes.InvalidArgument,
+		},
+		{
+			name:   "Unknown status",
+			token:  adminToken,
+			status: "failed",
+			code:   codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ListWebhookDeliveries(ctx, &api.ListWebhookDeliveriesRequest{
+				Token:  tt.token,
+				Status: tt.status,
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestDisabledUser_CantLogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	st.Userctl(ctx, "disable", email)
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	st.Userctl(ctx, "enable", email)
+
+	_, err = st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+}
+
+func TestDisabledUser_TokensInactive(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &api.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &api.LoginRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	requireActive := func(active bool) {
+		t.Helper()
+
+		_, err := st.AuthClient.ValidateToken(ctx, &api.ValidateTokenRequest{Token: token})
+		if active {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		}
+
+		respIntrospect, err := st.AuthClient.Introspect(ctx, &api.IntrospectRequest{Token: token})
+		require.NoError(t, err)
+		assert.Equal(t, active, respIntrospect.GetActive())
+	}
+
+	// уже выданный токен перестает приниматься сразу после disable
+	st.Userctl(ctx, "disable", email)
+	requireActive(false)
+
+	st.Userctl(ctx, "enable", email)
+	requireActive(true)
+
+	st.Userctl(ctx, "delete", email)
+	requireActive(false)
+}
@@ -2,11 +2,14 @@ package suite
 
 import (
 	"context"
+	"database/sql"
 	"net"
 	"os"
+	"os/exec"
 	"strconv"
 	"testing"
 
+	_ "github.com/lib/pq"
 	api "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
 	"gitlab.simbirsoft/verify/m.zemtsov/auth/internal/config"
 	"google.golang.org/grpc"
@@ -50,6 +53,56 @@ func New(t *testing.T) (context.Context, *Suite) {
 	}
 }
 
+// GrantAdmin gives the user the admin role directly in the database,
+// the gRPC API has no way to do it.
+func (s *Suite) GrantAdmin(ctx context.Context, email string) {
+	s.Helper()
+
+	db, err := sql.Open("postgres", s.Cfg.StoragePath)
+	if err != nil {
+		s.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET is_admin = TRUE WHERE email = $1", email); err != nil {
+		s.Fatalf("failed to grant admin: %v", err)
+	}
+}
+
+// CreateRealm creates a realm with its signing secret through cmd/realms,
+// policy are the realm policy flags, e.g. "-password-min-length=10".
+func (s *Suite) CreateRealm(ctx context.Context, name string, policy ...string) {
+	s.Helper()
+
+	args := append([]string{"run", "../cmd/realms", "--config", configPath(), "create"}, policy...)
+	out, err := exec.CommandContext(ctx, "go", append(args, name)...).CombinedOutput()
+	if err != nil {
+		s.Fatalf("failed to create realm %s: %v: %s", name, err, out)
+	}
+}
+
+// Realms runs cmd/realms, e.g. Realms(ctx, "add-scope", realm, "accounts:read").
+func (s *Suite) Realms(ctx context.Context, args ...string) {
+	s.Helper()
+
+	args = append([]string{"run", "../cmd/realms", "--config", configPath()}, args...)
+	out, err := exec.CommandContext(ctx, "go", args...).CombinedOutput()
+	if err != nil {
+		s.Fatalf("realms %v failed: %v: %s", args, err, out)
+	}
+}
+
+// Userctl runs cmd/userctl in the default realm, e.g. Userctl(ctx, "disable", email).
+func (s *Suite) Userctl(ctx context.Context, args ...string) {
+	s.Helper()
+
+	args = append([]string{"run", "../cmd/userctl", "--config", configPath()}, args...)
+	out, err := exec.CommandContext(ctx, "go", args...).CombinedOutput()
+	if err != nil {
+		s.Fatalf("userctl %v failed: %v: %s", args, err, out)
+	}
+}
+
 func configPath() string {
 	const key = "CONFIG_PATH"
 
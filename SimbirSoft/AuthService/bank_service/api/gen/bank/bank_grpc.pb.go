@@ -27,6 +27,12 @@ type BankClient interface {
 	AccountWithdraw(ctx context.Context, in *AccountWithdrawRequest, opts ...grpc.CallOption) (*AccountWithdrawResponse, error)
 	AccountTransfer(ctx context.Context, in *AccountTransferRequest, opts ...grpc.CallOption) (*AccountTransferResponse, error)
 	AccountLock(ctx context.Context, in *AccountLockRequest, opts ...grpc.CallOption) (*AccountLockResponse, error)
+	AccountUnlock(ctx context.Context, in *AccountUnlockRequest, opts ...grpc.CallOption) (*AccountUnlockResponse, error)
+	GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*GetAccountResponse, error)
+	ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error)
+	ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error)
+	GenerateStatement(ctx context.Context, in *GenerateStatementRequest, opts ...grpc.CallOption) (Bank_GenerateStatementClient, error)
+	SetFxRate(ctx context.Context, in *SetFxRateRequest, opts ...grpc.CallOption) (*SetFxRateResponse, error)
 }
 
 type bankClient struct {
@@ -82,6 +88,83 @@ func (c *bankClient) AccountLock(ctx context.Context, in *AccountLockRequest, op
 	return out, nil
 }
 
+func (c *bankClient) AccountUnlock(ctx context.Context, in *AccountUnlockRequest, opts ...grpc.CallOption) (*AccountUnlockResponse, error) {
+	out := new(AccountUnlockResponse)
+	err := c.cc.Invoke(ctx, "/bank.Bank/AccountUnlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bankClient) GetAccount(ctx context.Context, in *GetAccountRequest, opts ...grpc.CallOption) (*GetAccountResponse, error) {
+	out := new(GetAccountResponse)
+	err := c.cc.Invoke(ctx, "/bank.Bank/GetAccount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bankClient) ListAccounts(ctx context.Context, in *ListAccountsRequest, opts ...grpc.CallOption) (*ListAccountsResponse, error) {
+	out := new(ListAccountsResponse)
+	err := c.cc.Invoke(ctx, "/bank.Bank/ListAccounts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bankClient) ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error) {
+	out := new(ListTransactionsResponse)
+	err := c.cc.Invoke(ctx, "/bank.Bank/ListTransactions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bankClient) GenerateStatement(ctx context.Context, in *GenerateStatementRequest, opts ...grpc.CallOption) (Bank_GenerateStatementClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Bank_ServiceDesc.Streams[0], "/bank.Bank/GenerateStatement", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &bankGenerateStatementClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Bank_GenerateStatementClient interface {
+	Recv() (*StatementChunk, error)
+	grpc.ClientStream
+}
+
+type bankGenerateStatementClient struct {
+	grpc.ClientStream
+}
+
+func (x *bankGenerateStatementClient) Recv() (*StatementChunk, error) {
+	m := new(StatementChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *bankClient) SetFxRate(ctx context.Context, in *SetFxRateRequest, opts ...grpc.CallOption) (*SetFxRateResponse, error) {
+	out := new(SetFxRateResponse)
+	err := c.cc.Invoke(ctx, "/bank.Bank/SetFxRate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BankServer is the server API for Bank service.
 // All implementations must embed UnimplementedBankServer
 // for forward compatibility
@@ -91,6 +174,12 @@ type BankServer interface {
 	AccountWithdraw(context.Context, *AccountWithdrawRequest) (*AccountWithdrawResponse, error)
 	AccountTransfer(context.Context, *AccountTransferRequest) (*AccountTransferResponse, error)
 	AccountLock(context.Context, *AccountLockRequest) (*AccountLockResponse, error)
+	AccountUnlock(context.Context, *AccountUnlockRequest) (*AccountUnlockResponse, error)
+	GetAccount(context.Context, *GetAccountRequest) (*GetAccountResponse, error)
+	ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error)
+	ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error)
+	GenerateStatement(*GenerateStatementRequest, Bank_GenerateStatementServer) error
+	SetFxRate(context.Context, *SetFxRateRequest) (*SetFxRateResponse, error)
 	mustEmbedUnimplementedBankServer()
 }
 
@@ -113,6 +202,24 @@ func (UnimplementedBankServer) AccountTransfer(context.Context, *AccountTransfer
 func (UnimplementedBankServer) AccountLock(context.Context, *AccountLockRequest) (*AccountLockResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AccountLock not implemented")
 }
+func (UnimplementedBankServer) AccountUnlock(context.Context, *AccountUnlockRequest) (*AccountUnlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AccountUnlock not implemented")
+}
+func (UnimplementedBankServer) GetAccount(context.Context, *GetAccountRequest) (*GetAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAccount not implemented")
+}
+func (UnimplementedBankServer) ListAccounts(context.Context, *ListAccountsRequest) (*ListAccountsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAccounts not implemented")
+}
+func (UnimplementedBankServer) ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransactions not implemented")
+}
+func (UnimplementedBankServer) GenerateStatement(*GenerateStatementRequest, Bank_GenerateStatementServer) error {
+	return status.Errorf(codes.Unimplemented, "method GenerateStatement not implemented")
+}
+func (UnimplementedBankServer) SetFxRate(context.Context, *SetFxRateRequest) (*SetFxRateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFxRate not implemented")
+}
 func (UnimplementedBankServer) mustEmbedUnimplementedBankServer() {}
 
 // UnsafeBankServer may be embedded to opt out of forward compatibility for this service.
@@ -216,6 +323,117 @@ func _Bank_AccountLock_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Bank_AccountUnlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AccountUnlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BankServer).AccountUnlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bank.Bank/AccountUnlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BankServer).AccountUnlock(ctx, req.(*AccountUnlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bank_GetAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BankServer).GetAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bank.Bank/GetAccount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BankServer).GetAccount(ctx, req.(*GetAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bank_ListAccounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAccountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BankServer).ListAccounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bank.Bank/ListAccounts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BankServer).ListAccounts(ctx, req.(*ListAccountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bank_ListTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BankServer).ListTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bank.Bank/ListTransactions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BankServer).ListTransactions(ctx, req.(*ListTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bank_GenerateStatement_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GenerateStatementRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BankServer).GenerateStatement(m, &bankGenerateStatementServer{stream})
+}
+
+type Bank_GenerateStatementServer interface {
+	Send(*StatementChunk) error
+	grpc.ServerStream
+}
+
+type bankGenerateStatementServer struct {
+	grpc.ServerStream
+}
+
+func (x *bankGenerateStatementServer) Send(m *StatementChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Bank_SetFxRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFxRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BankServer).SetFxRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bank.Bank/SetFxRate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BankServer).SetFxRate(ctx, req.(*SetFxRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Bank_ServiceDesc is the grpc.ServiceDesc for Bank service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -243,7 +461,33 @@ var Bank_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "AccountLock",
 			Handler:    _Bank_AccountLock_Handler,
 		},
+		{
+			MethodName: "AccountUnlock",
+			Handler:    _Bank_AccountUnlock_Handler,
+		},
+		{
+			MethodName: "GetAccount",
+			Handler:    _Bank_GetAccount_Handler,
+		},
+		{
+			MethodName: "ListAccounts",
+			Handler:    _Bank_ListAccounts_Handler,
+		},
+		{
+			MethodName: "ListTransactions",
+			Handler:    _Bank_ListTransactions_Handler,
+		},
+		{
+			MethodName: "SetFxRate",
+			Handler:    _Bank_SetFxRate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GenerateStatement",
+			Handler:       _Bank_GenerateStatement_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "bank.proto",
 }
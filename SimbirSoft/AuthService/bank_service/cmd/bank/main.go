@@ -3,7 +3,10 @@ package main
 import (
 	"bank_service/internal/app"
 	"bank_service/internal/config"
+	"bank_service/internal/metrics"
+	"bank_service/internal/tracing"
 	"bank_service/pkg/logger/sl"
+	"context"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -20,7 +23,14 @@ func main() {
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	log.Info("starting application", slog.Any("config", cfg))
-	application, err := app.New(log, cfg.MyGRPC.Network, cfg.MyGRPC.Address, cfg.Storage.Driver, cfg.Storage.Info, cfg.Storage.URL, cfg.MigrationPath)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	application, err := app.New(log, cfg)
 	if err != nil {
 		log.Error("failed to init app", sl.Err(err))
 		os.Exit(1)
@@ -28,11 +38,26 @@ func main() {
 
 	go application.GRPCServer.MustRun()
 
+	go func() {
+		log.Info("serving metrics", slog.String("address", cfg.Metrics.Address))
+		if err := metrics.Listen(cfg.Metrics.Address); err != nil {
+			log.Error("metrics server stopped", sl.Err(err))
+		}
+	}()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
 	application.GRPCServer.Stop()
+
+	if err := application.Auth.Close(); err != nil {
+		log.Error("failed to close auth client", sl.Err(err))
+	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error("failed to flush traces", sl.Err(err))
+	}
 	log.Info("application stopped")
 }
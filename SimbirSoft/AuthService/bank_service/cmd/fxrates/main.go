@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bank_service/internal/config"
+	"bank_service/internal/domain/models"
+	"bank_service/internal/fx"
+	"bank_service/internal/storage/postgres"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `Usage: fxrates [flags] FILE
+
+Loads fx rates into the bank database. FILE is CSV with the columns base, quote
+and rate, e.g. "USD,RUB,92.4571": how many units of quote are given for one unit
+of base. The first line may be the header "base,quote,rate". FILE "-" reads stdin.
+
+Every line is checked before anything is written, then all the rates are set in
+one transaction: either the whole file is loaded or nothing is.
+
+Flags:
+`
+
+func main() {
+	var configPath string
+
+	flag.StringVar(&configPath, "config", envOr("CONFIG_PATH", "config/default.yaml"), "path to the server config file, storage.info is used to connect (CONFIG_PATH)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rates, err := readRates(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("fxrates: %v", err)
+	}
+
+	cfg := config.MustLoadPath(configPath)
+
+	storage, err := postgres.New(cfg.Storage.Driver, cfg.Storage.Info, cfg.Storage.Isolation, cfg.Storage.TxRetries)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer storage.Stop()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := storage.SetFxRates(ctx, rates); err != nil {
+		log.Fatalf("fxrates: %v", err)
+	}
+	fmt.Printf("loaded: %d\n", len(rates))
+}
+
+// readRates reads and checks the whole file, the line of the first bad record is reported
+func readRates(path string) ([]models.FxRate, error) {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	var rates []models.FxRate
+	seen := make(map[[2]string]int)
+
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "base") {
+			continue
+		}
+
+		rate := models.FxRate{
+			Base:  strings.ToUpper(strings.TrimSpace(record[0])),
+			Quote: strings.ToUpper(strings.TrimSpace(record[1])),
+			Rate:  strings.TrimSpace(record[2]),
+		}
+
+		if !fx.ValidCurrency(rate.Base) || !fx.ValidCurrency(rate.Quote) {
+			return nil, fmt.Errorf("line %d: base and quote must be ISO 4217 codes", line)
+		}
+		if rate.Base == rate.Quote {
+			return nil, fmt.Errorf("line %d: base and quote must differ", line)
+		}
+		if _, err := fx.ParseRate(rate.Rate); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		pair := [2]string{rate.Base, rate.Quote}
+		if prev, ok := seen[pair]; ok {
+			return nil, fmt.Errorf("line %d: %s/%s is already set on line %d", line, rate.Base, rate.Quote, prev)
+		}
+		seen[pair] = line
+
+		rates = append(rates, rate)
+	}
+
+	if len(rates) == 0 {
+		return nil, errors.New("no rates in the file")
+	}
+
+	return rates, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
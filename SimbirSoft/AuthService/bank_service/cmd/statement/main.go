@@ -0,0 +1,182 @@
+package main
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/internal/statement"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const dateLayout = "2006-01-02"
+
+const usage = `Usage: statement -account ID -from DATE [-to DATE] [flags]
+
+Downloads the statement of the account for [from, to) from bank_service.
+DATE is YYYY-MM-DD (UTC midnight) or RFC 3339. The file is written only if the
+statement reconciles: opening balance plus entries equals closing balance.
+
+Flags:
+`
+
+func main() {
+	var (
+		addr, jwt, caFile, serverName string
+		format, from, to, out         string
+		accountID                     int64
+		timeout                       time.Duration
+	)
+
+	flag.StringVar(&addr, "addr", envOr("BANK_ADDRESS", "localhost:8001"), "address of bank_service (BANK_ADDRESS)")
+	flag.StringVar(&jwt, "jwt", os.Getenv("BANK_JWT"), "token of the account owner issued by auth (BANK_JWT)")
+	flag.StringVar(&caFile, "ca", "", "CA certificate of bank_service, enables TLS")
+	flag.StringVar(&serverName, "server-name", "", "host name to verify the certificate against, the host of -addr if empty")
+	flag.Int64Var(&accountID, "account", 0, "account ID")
+	flag.StringVar(&from, "from", "", "start of the period, inclusive")
+	flag.StringVar(&to, "to", "", "end of the period, exclusive, now if empty")
+	flag.StringVar(&format, "format", statement.FormatCSV, "csv, ofx or camt053")
+	flag.StringVar(&out, "out", "", "output file, \"-\" for stdout, statement-ACCOUNT-FROM-TO.EXT if empty")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "timeout of the whole download")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if accountID <= 0 || from == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if jwt == "" {
+		log.Fatal("either -jwt or BANK_JWT is required")
+	}
+
+	fromTime, err := parseTime(from)
+	if err != nil {
+		log.Fatalf("-from: %v", err)
+	}
+
+	req := &bank_v1.GenerateStatementRequest{Jwt: jwt, AccountId: accountID, From: fromTime.Unix(), Format: format}
+	if to != "" {
+		toTime, err := parseTime(to)
+		if err != nil {
+			log.Fatalf("-to: %v", err)
+		}
+		req.To = toTime.Unix()
+	}
+
+	if out == "" {
+		out = fmt.Sprintf("statement-%d-%s-%s%s", accountID, fromTime.UTC().Format(dateLayout), toLabel(req.To), statement.Extension(format))
+	}
+
+	creds := insecure.NewCredentials()
+	if caFile != "" {
+		creds, err = credentials.NewClientTLSFromFile(caFile, serverName)
+		if err != nil {
+			log.Fatalf("failed to load CA: %v", err)
+		}
+	}
+
+	cc, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %v", addr, err)
+	}
+	defer cc.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	n, err := download(ctx, bank_v1.NewBankClient(cc), req, out)
+	if err != nil {
+		log.Fatalf("statement: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "statement: %d bytes written to %s\n", n, out)
+}
+
+// download writes the statement to a temporary file next to out and renames it only after
+// the stream ended without an error, so an unreconciled statement never looks complete
+func download(ctx context.Context, client bank_v1.BankClient, req *bank_v1.GenerateStatementRequest, out string) (int64, error) {
+	stream, err := client.GenerateStatement(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+
+	if out == "-" {
+		return receive(stream, os.Stdout)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := receive(stream, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(tmp.Name(), out)
+}
+
+func receive(stream bank_v1.Bank_GenerateStatementClient, w io.Writer) (int64, error) {
+	var n int64
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		written, err := w.Write(chunk.GetData())
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func toLabel(to int64) string {
+	if to == 0 {
+		return "now"
+	}
+
+	return time.Unix(to, 0).UTC().Format(dateLayout)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
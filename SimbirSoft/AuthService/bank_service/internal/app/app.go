@@ -2,32 +2,80 @@ package app
 
 import (
 	grpcapp "bank_service/internal/app/grpc"
+	"bank_service/internal/config"
+	"bank_service/internal/fx"
 	"bank_service/internal/service/bank"
 	"bank_service/internal/storage/postgres"
+	"fmt"
 	"log/slog"
+
+	authclient "gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/grpc"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/tlsconfig"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	Auth       *authclient.Client
 }
 
-func New(log *slog.Logger, grpcNetwork, grpcAddress, storageDriver, storageInfo, storageURL, migrationPath string) (*App, error) {
+func New(log *slog.Logger, cfg *config.Config) (*App, error) {
 
-	storage, err := postgres.New(storageDriver, storageInfo)
+	storage, err := postgres.New(cfg.Storage.Driver, cfg.Storage.Info, cfg.Storage.Isolation, cfg.Storage.TxRetries)
 	if err != nil {
 		return nil, err
 	}
 
-	err = storage.MigrationUp(storageURL, migrationPath)
+	err = storage.MigrationUp(cfg.Storage.URL, cfg.MigrationPath)
 	if err != nil {
 		return nil, err
 	}
 
-	bank := bank.New(log, storage)
+	if !fx.ValidCurrency(cfg.FX.DefaultCurrency) {
+		return nil, fmt.Errorf("default currency %q is not an ISO 4217 code", cfg.FX.DefaultCurrency)
+	}
+
+	rounding, err := fx.ParseRounding(cfg.FX.Rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	bank := bank.New(log, storage, cfg.FX.DefaultCurrency, rounding, cfg.Idempotency.TTL)
+
+	authCfg := authclient.Config{
+		Address:          cfg.Auth.Address,
+		Realm:            cfg.Auth.Realm,
+		AppID:            cfg.Auth.AppID,
+		Audience:         cfg.Auth.Audience,
+		Timeout:          cfg.Auth.Timeout,
+		Retries:          cfg.Auth.Retries,
+		RetryBaseDelay:   cfg.Auth.RetryBaseDelay,
+		RetryMaxDelay:    cfg.Auth.RetryMaxDelay,
+		BreakerThreshold: cfg.Auth.BreakerThreshold,
+		BreakerCooldown:  cfg.Auth.BreakerCooldown,
+		CacheSize:        cfg.Auth.CacheSize,
+		CacheTTL:         cfg.Auth.CacheTTL,
+	}
+	if cfg.Auth.TLS.Enabled {
+		reloader, err := tlsconfig.NewReloader(log, cfg.Auth.TLS.CertFile, cfg.Auth.TLS.KeyFile, cfg.Auth.TLS.CAFile, cfg.Auth.TLS.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		authCfg.TLS = reloader.ClientConfig(cfg.Auth.TLS.ServerName)
+	}
 
-	grpcApp := grpcapp.New(log, bank, grpcNetwork, grpcAddress)
+	auth, err := authclient.New(authCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcApp, err := grpcapp.New(log, bank, cfg.MyGRPC, auth, cfg.FX.AdminScope, cfg.Locks.AdminScope)
+	if err != nil {
+		return nil, err
+	}
 
 	return &App{
 		GRPCServer: grpcApp,
+		Auth:       auth,
 	}, nil
 }
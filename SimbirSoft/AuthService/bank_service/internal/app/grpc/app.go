@@ -1,6 +1,7 @@
 package grpcapp
 
 import (
+	"bank_service/internal/config"
 	"fmt"
 	"log"
 	"log/slog"
@@ -8,27 +9,84 @@ import (
 
 	server "bank_service/internal/server/grpc"
 
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	authclient "gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/grpc"
+	"gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/tlsconfig"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+const setFxRateMethod = "/bank.Bank/SetFxRate"
+
+// Операции, которые нельзя выполнять, когда сотрудник поддержки действует от имени клиента
+var moneyOutMethods = []string{
+	"/bank.Bank/AccountWithdraw",
+	"/bank.Bank/AccountTransfer",
+}
+
 type App struct {
 	log        *slog.Logger
 	GRPCServer *grpc.Server
 	network    string
 	address    string
+	tls        *tlsconfig.Reloader
 }
 
-func New(log *slog.Logger, bank server.Bank, network string, address string) *App {
-	GRPCServer := grpc.NewServer()
+// Every RPC is authorized by auth. Withdrawals and transfers are refused for impersonation tokens,
+// SetFxRate requires fxAdminScope, tokens with lockAdminScope lock and unlock any account.
+func New(
+	log *slog.Logger,
+	bank server.Bank,
+	cfg config.GRPCConfig,
+	auth *authclient.Client,
+	fxAdminScope, lockAdminScope string,
+) (*App, error) {
+	const op = "grpcapp.New"
+
+	authOpts := []authclient.InterceptorOption{
+		authclient.WithDenyImpersonation(moneyOutMethods...),
+		authclient.WithRequiredScopes(setFxRateMethod, fxAdminScope),
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			grpc_prometheus.UnaryServerInterceptor,
+			auth.UnaryServerInterceptor(authOpts...),
+		),
+		// GenerateStatement streams the statement
+		grpc.ChainStreamInterceptor(
+			grpc_prometheus.StreamServerInterceptor,
+			auth.StreamServerInterceptor(authOpts...),
+		),
+	}
+
+	var reloader *tlsconfig.Reloader
+	if cfg.TLS.Enabled {
+		var err error
+		reloader, err = tlsconfig.NewReloader(log, cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CAFile, cfg.TLS.ReloadInterval)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
 
-	server.Register(GRPCServer, bank)
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(cfg.TLS.RequireClientCert))))
+	}
+
+	GRPCServer := grpc.NewServer(opts...)
+
+	server.Register(GRPCServer, bank, lockAdminScope)
+
+	grpc_prometheus.Register(GRPCServer)
+	grpc_prometheus.EnableHandlingTimeHistogram()
 
 	return &App{
 		log:        log,
 		GRPCServer: GRPCServer,
-		network:    network,
-		address:    address,
-	}
+		network:    cfg.Network,
+		address:    cfg.Address,
+		tls:        reloader,
+	}, nil
 }
 
 func (a *App) MustRun() {
@@ -67,4 +125,8 @@ func (a *App) Stop() {
 	a.log.Info("stopping gRPC server", slog.String("address", a.address))
 
 	a.GRPCServer.GracefulStop()
+
+	if a.tls != nil {
+		a.tls.Close()
+	}
 }
@@ -8,22 +8,98 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+// Isolation of the writes (account creation, top ups, withdrawals, transfers and fx rates) must be
+// "read_committed", "repeatable_read" or "serializable". TxRetries is how many times a write failed
+// on a serialization error or a deadlock is run again
 type Storage struct {
-	Driver string `yaml:"driver" env-required:"true"`
-	Info   string `yaml:"info" env-required:"true"`
-	URL    string `yaml:"url" env-required:"true`
+	Driver    string `yaml:"driver" env-required:"true"`
+	Info      string `yaml:"info" env-required:"true"`
+	URL       string `yaml:"url" env-required:"true"`
+	Isolation string `yaml:"isolation" env:"STORAGE_ISOLATION" env-default:"read_committed"`
+	TxRetries int    `yaml:"tx_retries" env:"STORAGE_TX_RETRIES" env-default:"3"`
 }
 
 type GRPCConfig struct {
 	Network string        `yaml:"network" env-required:"true"`
 	Address string        `yaml:"address" env-required:"true"`
 	Timeout time.Duration `yaml:"timeout" env-required:"true"`
+	TLS     TLS           `yaml:"tls"`
+}
+
+// Server side: CAFile verifies client certificates.
+// Client side: CAFile verifies the server, ServerName overrides the host name to check.
+type TLS struct {
+	Enabled           bool          `yaml:"enabled"`
+	CertFile          string        `yaml:"cert_file"`
+	KeyFile           string        `yaml:"key_file"`
+	CAFile            string        `yaml:"ca_file"`
+	RequireClientCert bool          `yaml:"require_client_cert"`
+	ServerName        string        `yaml:"server_name"`
+	ReloadInterval    time.Duration `yaml:"reload_interval" env-default:"30s"`
+}
+
+// Zero values fall back to the auth client defaults
+type AuthClient struct {
+	Address          string        `yaml:"address" env:"AUTH_ADDRESS" env-default:"auth:8080"`
+	Realm            string        `yaml:"realm" env:"AUTH_REALM"`
+	AppID            int64         `yaml:"app_id" env:"AUTH_APP_ID"`
+	Audience         string        `yaml:"audience" env:"AUTH_AUDIENCE"`
+	Timeout          time.Duration `yaml:"timeout"`
+	Retries          int           `yaml:"retries"`
+	RetryBaseDelay   time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay    time.Duration `yaml:"retry_max_delay"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+	CacheSize        int           `yaml:"cache_size"`
+	CacheTTL         time.Duration `yaml:"cache_ttl"`
+	TLS              TLS           `yaml:"tls"`
+}
+
+// Rounding of transfers between currencies must be "half_even", "half_up", "down" or "up".
+// Rates are set by the SetFxRate RPC for tokens with AdminScope or loaded by cmd/fxrates.
+// AdminScope must be an admin only scope of the realm in auth, which grants it only to its admins
+type FX struct {
+	DefaultCurrency string `yaml:"default_currency" env:"DEFAULT_CURRENCY" env-default:"RUB"`
+	Rounding        string `yaml:"rounding" env:"FX_ROUNDING" env-default:"half_even"`
+	AdminScope      string `yaml:"admin_scope" env-default:"fx:write"`
+}
+
+// Idempotency keys of top ups, withdrawals and transfers are kept for TTL, a retry after it runs again
+type Idempotency struct {
+	TTL time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" env-default:"24h"`
+}
+
+// Tokens with AdminScope lock and unlock any account for the bank, a lock placed so is lifted by them only.
+// AdminScope must be an admin only scope of the realm in auth, which grants it only to its admins
+type Locks struct {
+	AdminScope string `yaml:"admin_scope" env-default:"accounts:lock"`
+}
+
+type Metrics struct {
+	Address string `yaml:"address" env:"METRICS_ADDRESS" env-default:"0.0.0.0:8002"`
+}
+
+// Exporter must be "otlp", "stdout" or "file"
+type Tracing struct {
+	Enabled     bool    `yaml:"enabled" env:"TRACING_ENABLED" env-default:"false"`
+	ServiceName string  `yaml:"service_name" env-default:"bank_service"`
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"stdout"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env-default:"true"`
+	FilePath    string  `yaml:"file_path" env-default:"traces.json"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
 }
 
 type Config struct {
-	MigrationPath string     `yaml:"migration_path" env-required:"true"`
-	Storage       Storage    `yaml:"storage" env-required:"true"`
-	MyGRPC        GRPCConfig `yaml:"my_grpc" env-required:"true"`
+	MigrationPath string      `yaml:"migration_path" env-required:"true"`
+	Storage       Storage     `yaml:"storage" env-required:"true"`
+	MyGRPC        GRPCConfig  `yaml:"my_grpc" env-required:"true"`
+	Tracing       Tracing     `yaml:"tracing"`
+	Metrics       Metrics     `yaml:"metrics"`
+	Auth          AuthClient  `yaml:"auth"`
+	FX            FX          `yaml:"fx"`
+	Idempotency   Idempotency `yaml:"idempotency"`
+	Locks         Locks       `yaml:"locks"`
 }
 
 func MustLoad() *Config {
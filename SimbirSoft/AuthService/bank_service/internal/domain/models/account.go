@@ -1,8 +1,27 @@
 package models
 
+import (
+	"bank_service/internal/domain/models/money"
+	"time"
+)
+
 type Account struct {
-	ID       int64
-	Balance  int64
-	OwnerID  int64
-	IsLocked bool
+	ID        int64
+	Balance   int64  // in minor units of the currency
+	Currency  string // ISO 4217
+	OwnerID   int64
+	IsLocked  bool
+	Lock      *AccountLock // nil unless IsLocked
+	CreatedAt time.Time
+}
+
+func (a Account) Money() money.Money {
+	return money.New(a.Balance, a.Currency)
+}
+
+// Page of the accounts of an owner, NextAfterID is 0 on the last page
+type AccountsPage struct {
+	Accounts    []Account
+	Owner       Owner
+	NextAfterID int64
 }
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Lock types: a freeze stops any money on the account, a block stops it one way
+const (
+	LockFreeze      = "freeze"
+	LockDebitBlock  = "debit_block"  // no money out: withdrawals and outgoing transfers
+	LockCreditBlock = "credit_block" // no money in: top ups and incoming transfers
+)
+
+// Reason codes of the locks
+var LockReasons = []string{
+	"customer_request",
+	"lost_card",
+	"suspected_fraud",
+	"court_order",
+	"compliance",
+	"other",
+}
+
+// Lock of an account, at most one at a time
+type AccountLock struct {
+	Type     string
+	Reason   string
+	Note     string
+	LockedBy int64 // user who placed the lock, 0 for the locks placed before it was recorded
+	ByBank   bool  // placed by the bank staff, only the staff can lift it
+	LockedAt time.Time
+}
+
+func ValidLockType(lockType string) bool {
+	switch lockType {
+	case LockFreeze, LockDebitBlock, LockCreditBlock:
+		return true
+	}
+
+	return false
+}
+
+func ValidLockReason(reason string) bool {
+	for _, r := range LockReasons {
+		if r == reason {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Money can not leave a locked account unless it is only blocked for credits
+func (l *AccountLock) BlocksDebit() bool {
+	return l != nil && l.Type != LockCreditBlock
+}
+
+// Money can not come to a locked account unless it is only blocked for debits
+func (l *AccountLock) BlocksCredit() bool {
+	return l != nil && l.Type != LockDebitBlock
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Rate is how many units of Quote are given for one unit of Base, a decimal string
+type FxRate struct {
+	Base      string
+	Quote     string
+	Rate      string
+	UpdatedAt time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Key of a retried money-moving request. Fingerprint is the hash of the request,
+// a key stored more than TTL ago is expired and may be used again
+type IdempotencyKey struct {
+	UserID      int64
+	Key         string
+	Fingerprint string
+	TTL         time.Duration
+}
@@ -0,0 +1,119 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrOverflow         = errors.New("amount overflows")
+	ErrCurrencyMismatch = errors.New("currencies differ")
+)
+
+// Money is an amount in minor units of the currency, e.g. kopecks of RUB or cents of USD.
+// Arithmetic is checked: an overflow is an error instead of a wrapped amount
+type Money struct {
+	Amount   int64
+	Currency string // ISO 4217
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	sum, err := Add(m.Amount, o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	diff, err := Sub(m.Amount, o.Amount)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: diff, Currency: m.Currency}, nil
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// e.g. "1234.56 RUB"
+func (m Money) String() string {
+	return FormatMinor(m.Amount, m.Currency) + " " + m.Currency
+}
+
+// Add returns a + b or ErrOverflow
+func Add(a, b int64) (int64, error) {
+	if b > 0 && a > math.MaxInt64-b || b < 0 && a < math.MinInt64-b {
+		return 0, ErrOverflow
+	}
+
+	return a + b, nil
+}
+
+// Sub returns a - b or ErrOverflow
+func Sub(a, b int64) (int64, error) {
+	if b < 0 && a > math.MaxInt64+b || b > 0 && a < math.MinInt64+b {
+		return 0, ErrOverflow
+	}
+
+	return a - b, nil
+}
+
+// Minor units of the currencies without cents or with three digits of them (ISO 4217),
+// the others have two. XXX is no currency and has none
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0, "XXX": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Exponent returns the number of digits of the minor units of the currency
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+
+	return 2
+}
+
+// FormatMinor formats the amount in minor units as a decimal in major units, e.g. -12345 RUB is "-123.45"
+func FormatMinor(amount int64, currency string) string {
+	exp := Exponent(currency)
+
+	sign := ""
+	// Через uint64, чтобы не переполниться на MinInt64
+	abs := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		abs = -abs
+	}
+
+	digits := strconv.FormatUint(abs, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
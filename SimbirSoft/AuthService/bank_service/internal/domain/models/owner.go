@@ -2,6 +2,7 @@ package models
 
 type Owner struct {
 	ID          int64
+	UserID      int64 // user of auth the owner signs in as
 	FullName    string
 	Citizenship string
 }
@@ -8,11 +8,101 @@ const (
 	Transfer
 )
 
+// Names of the types in the API and in statements
+var TypeNames = map[int]string{
+	TopUp:    "TopUp",
+	Withdraw: "Withdraw",
+	Transfer: "Transfer",
+}
+
 type Transaction struct {
-	ID                     int
-	AccountID              int
-	ParticipatingAccountID int
+	ID                     int64
+	AccountID              int64
+	ParticipatingAccountID int64 // beneficiary of a transfer, 0 otherwise
 	TransactionType        int
-	Amount                 int
-	Date                   time.Time
+	Amount                 int64 // in minor units of the currency of AccountID
+	// Transfer between currencies: ParticipatingAmount is credited to the beneficiary in its currency,
+	// FxRate is the rate it was converted by. Both are empty otherwise
+	ParticipatingAmount int64
+	FxRate              string
+	Date                time.Time
+}
+
+// Returning the other account of a transfer as seen from accountID, 0 for top ups and withdrawals
+func (t Transaction) Counterparty(accountID int64) int64 {
+	if t.TransactionType != Transfer {
+		return 0
+	}
+	if t.AccountID == accountID {
+		return t.ParticipatingAccountID
+	}
+
+	return t.AccountID
+}
+
+// Returning the change of the balance of accountID made by the transaction.
+// A transfer to the same account changes nothing
+func (t Transaction) Net(accountID int64) int64 {
+	switch {
+	case t.TransactionType == TopUp:
+		return t.Amount
+	case t.TransactionType == Withdraw:
+		return -t.Amount
+	case t.AccountID == t.ParticipatingAccountID:
+		return 0
+	case t.AccountID == accountID:
+		return -t.Amount
+	}
+
+	return t.CreditedAmount()
+}
+
+// Returning the amount in the currency of accountID: the credited amount for the beneficiary of a transfer
+func (t Transaction) AmountFor(accountID int64) int64 {
+	if t.TransactionType == Transfer && t.AccountID != accountID {
+		return t.CreditedAmount()
+	}
+
+	return t.Amount
+}
+
+// Returning the amount credited to the beneficiary of a transfer
+func (t Transaction) CreditedAmount() int64 {
+	if t.FxRate != "" {
+		return t.ParticipatingAmount
+	}
+
+	return t.Amount
+}
+
+// Reports whether the money came to accountID
+func (t Transaction) Incoming(accountID int64) bool {
+	switch t.TransactionType {
+	case TopUp:
+		return true
+	case Transfer:
+		return t.ParticipatingAccountID == accountID && t.AccountID != accountID
+	}
+
+	return false
+}
+
+// Filter of the transaction history, zero fields don't filter
+type Filter struct {
+	Types     []int
+	From      time.Time // inclusive
+	To        time.Time // exclusive
+	MinAmount int64
+	MaxAmount int64
+	// Keyset cursor: only transactions older than the one with BeforeDate and BeforeID
+	BeforeDate time.Time
+	BeforeID   int64
+}
+
+// Page of the transaction history, newest first. NextDate and NextID are the cursor
+// of the next page, NextID is 0 on the last page
+type Page struct {
+	Transactions []Transaction
+	NextDate     time.Time
+	NextID       int64
 }
@@ -0,0 +1,125 @@
+// Package fx converts amounts between currencies with exact decimal rates.
+//
+// Rates are kept as decimal strings and parsed into big.Rat, so a conversion is
+// rounded only once, to whole minor units of the target currency, by the chosen mode.
+package fx
+
+import (
+	"bank_service/internal/domain/models/money"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+type Rounding string
+
+const (
+	RoundHalfEven Rounding = "half_even" // to the nearest, ties to even (banker's rounding)
+	RoundHalfUp   Rounding = "half_up"   // to the nearest, ties away from zero
+	RoundDown     Rounding = "down"      // toward zero
+	RoundUp       Rounding = "up"        // away from zero
+)
+
+var (
+	ErrUnknownRounding = errors.New("unknown rounding mode")
+	ErrInvalidRate     = errors.New("rate must be a positive decimal")
+	ErrOverflow        = errors.New("converted amount overflows")
+)
+
+var (
+	currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+	// numeric(24,12) of the storage
+	rateRe = regexp.MustCompile(`^[0-9]{1,12}(\.[0-9]{1,12})?$`)
+)
+
+// ValidCurrency reports whether the code looks like an ISO 4217 alphabetic code
+func ValidCurrency(code string) bool {
+	return currencyRe.MatchString(code)
+}
+
+func ParseRounding(s string) (Rounding, error) {
+	switch r := Rounding(s); r {
+	case RoundHalfEven, RoundHalfUp, RoundDown, RoundUp:
+		return r, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownRounding, s)
+}
+
+// ParseRate parses a positive decimal rate such as "92.4571" with up to 12 digits on each side
+// of the point, exponents and signs are not accepted
+func ParseRate(s string) (*big.Rat, error) {
+	if !rateRe.MatchString(s) {
+		return nil, ErrInvalidRate
+	}
+
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || rate.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	return rate, nil
+}
+
+// Convert returns amount in minor units of from converted to minor units of to, rounded by mode.
+// The rate is in major units: how many units of to are given for one unit of from, so the product
+// is scaled by the difference of the exponents, e.g. 10000 cents of USD at 150 are 15000 JPY
+func Convert(amount int64, from, to string, rate *big.Rat, mode Rounding) (int64, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), rate)
+
+	shift := money.Exponent(to) - money.Exponent(from)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(shift, -shift))), nil))
+	if shift < 0 {
+		scale.Inv(scale)
+	}
+	product.Mul(product, scale)
+
+	quo, rem := new(big.Int).QuoRem(product.Num(), product.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		// |rem| * 2 против знаменателя: меньше половины, ровно половина или больше
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(product.Denom())
+
+		away := false
+		switch mode {
+		case RoundUp:
+			away = true
+		case RoundDown:
+		case RoundHalfUp:
+			away = cmp >= 0
+		case RoundHalfEven:
+			away = cmp > 0 || cmp == 0 && quo.Bit(0) == 1
+		default:
+			return 0, fmt.Errorf("%w: %q", ErrUnknownRounding, mode)
+		}
+
+		if away {
+			quo.Add(quo, big.NewInt(int64(product.Sign())))
+		}
+	}
+
+	if !quo.IsInt64() {
+		return 0, ErrOverflow
+	}
+
+	return quo.Int64(), nil
+}
+
+// Inverse returns the rate of the opposite direction
+func Inverse(rate *big.Rat) *big.Rat {
+	return new(big.Rat).Inv(rate)
+}
+
+// Scale of the rates kept in the storage
+const rateScale = 12
+
+// FormatRate formats the rate as a decimal with up to 12 fractional digits, without trailing zeros
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(rateScale)
+	s = strings.TrimRight(s, "0")
+
+	return strings.TrimSuffix(s, ".")
+}
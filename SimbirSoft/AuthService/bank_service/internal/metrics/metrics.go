@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "bank"
+
+// Label values for transaction type
+const (
+	TypeTopUp    = "top_up"
+	TypeWithdraw = "withdraw"
+	TypeTransfer = "transfer"
+)
+
+// Label values for transaction status
+const (
+	StatusSuccess  = "success"
+	StatusRejected = "rejected" // business rule refused the operation
+	StatusFailed   = "failed"   // internal error
+)
+
+var (
+	Transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_total",
+		Help:      "Number of money-moving operations by type and status.",
+	}, []string{"type", "status"})
+
+	AmountMoved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amount_moved_total",
+		Help:      "Sum of successfully moved amounts in minor units by transaction type and currency, the write-off currency for transfers.",
+	}, []string{"type", "currency"})
+
+	LockedAccountRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "locked_account_rejections_total",
+		Help:      "Operations rejected because an account is locked.",
+	}, []string{"type"})
+
+	InsufficientFunds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insufficient_funds_total",
+		Help:      "Operations rejected because of insufficient funds.",
+	}, []string{"type"})
+)
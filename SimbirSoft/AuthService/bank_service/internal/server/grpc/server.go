@@ -1,101 +1,135 @@
 package server
 
 import (
-	auth_v1 "bank_service/api/gen/auth"
 	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/internal/domain/models"
+	"bank_service/internal/domain/models/transaction"
+	"bank_service/internal/fx"
 	"bank_service/internal/service/bank"
+	"bank_service/internal/statement"
 	"bank_service/internal/storage"
-	"bank_service/pkg/grpc/client"
 	"context"
+	"encoding/base64"
 	"errors"
-	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	authclient "gitlab.simbirsoft/verify/m.zemtsov/auth/pkg/grpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-const (
-	authGRPCAddress = "auth:8080"
-)
-
 type Bank interface {
-	// Returning created account ID, balance and error
-	CreateAccount(ctx context.Context, fullName, citizenship string, balance int64) (int64, int64, error)
-	// Returning updated account balance and error
-	AccountTopUp(ctx context.Context, accountID, amount int64) (int64, error)
-	// Returning updated account balance and error
-	AccountWithdraw(ctx context.Context, accountID, amount int64) (int64, error)
-	// Returning updated accounts balances and error
-	AccountTransfer(ctx context.Context, writeOfAccountID, beneficiaryAccountID, amount int64) (int64, int64, error)
-	AccountLock(ctx context.Context, accountID int64) error
+	// Returning created account, an empty currency means the default one
+	CreateAccount(ctx context.Context, userID int64, fullName, citizenship, currency string, balance int64) (models.Account, error)
+	// Returning updated account balance and error, a retry with the idempotency key returns the first balance
+	AccountTopUp(ctx context.Context, userID, accountID, amount int64, idempotencyKey string) (int64, error)
+	// Returning updated account balance and error, a retry with the idempotency key returns the first balance
+	AccountWithdraw(ctx context.Context, userID, accountID, amount int64, idempotencyKey string) (int64, error)
+	// Returning updated accounts balances and error, a retry with the idempotency key returns the first balances
+	AccountTransfer(ctx context.Context, userID, writeOfAccountID, beneficiaryAccountID, amount int64, idempotencyKey string) (int64, int64, error)
+	// Placing a lock on the account of the user, or on any account if byBank. An empty lock type means a freeze
+	AccountLock(ctx context.Context, userID int64, byBank bool, accountID int64, lockType, reason, note string) error
+	// Lifting the lock of the account of the user, or of any account if byBank
+	AccountUnlock(ctx context.Context, userID int64, byBank bool, accountID int64, note string) error
+	// Returning the account of the user and its owner
+	GetAccount(ctx context.Context, userID, accountID int64) (models.Account, models.Owner, error)
+	// Returning a page of the accounts of the user after afterID, isLocked nil means any
+	ListAccounts(ctx context.Context, userID, afterID int64, isLocked *bool, limit int) (models.AccountsPage, error)
+	// Returning a page of the transactions of the account of the user, newest first
+	ListTransactions(ctx context.Context, userID, accountID int64, filter transaction.Filter, limit int) (transaction.Page, error)
+	// Rendering the statement of the account of the user for [from, to)
+	GenerateStatement(ctx context.Context, userID, accountID int64, from, to time.Time, r statement.Renderer) error
+	SetFxRate(ctx context.Context, base, quote, rate string) error
 }
 
-type serverAPI struct {
-	bank_v1.UnimplementedBankServer
-	bank       Bank
-	cl_auth_v1 *client.ClientGRPC
+// Statements are sent in chunks of this size
+const statementChunkSize = 64 << 10
+
+// Longest period of a statement
+const maxStatementPeriod = 366 * 24 * time.Hour
+
+// Size of the idempotency_keys.key column
+const maxIdempotencyKeyLen = 255
+
+// Longest note of a lock or an unlock
+const maxLockNoteLen = 500
+
+// Transaction types in the API
+var transactionTypes = map[string]int{
+	"TopUp":    transaction.TopUp,
+	"Withdraw": transaction.Withdraw,
+	"Transfer": transaction.Transfer,
 }
 
-func Register(gRPC *grpc.Server, bank Bank) error {
-	cl, err := client.NewClientGRPC(authGRPCAddress)
-	if err != nil {
-		log.Fatalf("couldn't make grpc auth client: %w", err)
-		return err
-	}
+// Lock statuses ListAccounts filters by
+const (
+	lockStatusLocked = "locked"
+	lockStatusActive = "active"
+)
 
-	bank_v1.RegisterBankServer(gRPC, &serverAPI{bank: bank, cl_auth_v1: cl})
+type serverAPI struct {
+	bank_v1.UnimplementedBankServer
+	bank           Bank
+	lockAdminScope string
+}
 
-	return nil
+// Tokens are validated by the auth interceptor before the handlers are called,
+// see grpcapp.New. Tokens with lockAdminScope lock and unlock any account for the bank
+func Register(gRPC *grpc.Server, bank Bank, lockAdminScope string) {
+	bank_v1.RegisterBankServer(gRPC, &serverAPI{bank: bank, lockAdminScope: lockAdminScope})
 }
 
 func (s *serverAPI) CreateAccount(ctx context.Context, req *bank_v1.CreateAccountRequest) (*bank_v1.CreateAccountResponse, error) {
-	reqValidateToken := &auth_v1.ValidateTokenRequest{Token: req.Jwt}
-	_, err := s.cl_auth_v1.ValidateToken(ctx, reqValidateToken)
-	st, ok := status.FromError(err)
-	if !ok {
-		return nil, status.Error(codes.Internal, "couldn't proceed jwt validation by auth service")
-	}
+	err := validateCreateAccount(req)
 	if err != nil {
-		return nil, status.Error(st.Code(), st.Message())
+		return nil, err
 	}
 
-	err = validateCreateAccount(req)
+	userID, err := callerID(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	account_id, balance, err := s.bank.CreateAccount(ctx, req.FullName, req.Citizenship, req.Balance)
+	account, err := s.bank.CreateAccount(ctx, userID, req.FullName, req.Citizenship, req.Currency, req.Balance)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to create account")
 	}
 
-	return &bank_v1.CreateAccountResponse{AccountId: account_id, Balance: balance}, nil
+	return &bank_v1.CreateAccountResponse{AccountId: account.ID, Balance: account.Balance, Currency: account.Currency}, nil
 }
 
 func (s *serverAPI) AccountTopUp(ctx context.Context, req *bank_v1.AccountTopUpRequest) (*bank_v1.AccountTopUpResponse, error) {
-	reqValidateToken := &auth_v1.ValidateTokenRequest{Token: req.Jwt}
-	_, err := s.cl_auth_v1.ValidateToken(ctx, reqValidateToken)
-	st, ok := status.FromError(err)
-	if !ok {
-		return nil, status.Error(codes.Internal, "couldn't proceed jwt validation by auth service")
-	}
+	err := validateAccountTopUp(req)
 	if err != nil {
-		return nil, status.Error(st.Code(), st.Message())
+		return nil, err
 	}
 
-	err = validateAccountTopUp(req)
+	userID, err := callerID(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	balance, err := s.bank.AccountTopUp(ctx, req.AccountId, req.TopUpAmount)
+	balance, err := s.bank.AccountTopUp(ctx, userID, req.AccountId, req.TopUpAmount, req.IdempotencyKey)
+	if errors.Is(err, storage.ErrIdempotencyKeyMismatch) {
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key is used for another request")
+	}
 	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
 		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
 	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
 	if errors.Is(err, bank.ErrAccountLocked) {
 		return nil, status.Error(codes.FailedPrecondition, "account is locked")
 	}
+	if errors.Is(err, bank.ErrAmountOverflow) || errors.Is(err, storage.ErrAmountOverflow) {
+		return nil, status.Error(codes.InvalidArgument, "amount overflows the balance")
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to top up account")
 	}
@@ -104,25 +138,26 @@ func (s *serverAPI) AccountTopUp(ctx context.Context, req *bank_v1.AccountTopUpR
 }
 
 func (s *serverAPI) AccountWithdraw(ctx context.Context, req *bank_v1.AccountWithdrawRequest) (*bank_v1.AccountWithdrawResponse, error) {
-	reqValidateToken := &auth_v1.ValidateTokenRequest{Token: req.Jwt}
-	_, err := s.cl_auth_v1.ValidateToken(ctx, reqValidateToken)
-	st, ok := status.FromError(err)
-	if !ok {
-		return nil, status.Error(codes.Internal, "couldn't proceed jwt validation by auth service")
-	}
+	err := validateAccountWithdraw(req)
 	if err != nil {
-		return nil, status.Error(st.Code(), st.Message())
+		return nil, err
 	}
 
-	err = validateAccountWithdraw(req)
+	userID, err := callerID(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	balance, err := s.bank.AccountWithdraw(ctx, req.AccountId, req.WithdrawAmount)
+	balance, err := s.bank.AccountWithdraw(ctx, userID, req.AccountId, req.WithdrawAmount, req.IdempotencyKey)
+	if errors.Is(err, storage.ErrIdempotencyKeyMismatch) {
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key is used for another request")
+	}
 	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
 		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
 	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
 	if errors.Is(err, bank.ErrAccountLocked) {
 		return nil, status.Error(codes.FailedPrecondition, "account is locked")
 	}
@@ -137,31 +172,41 @@ func (s *serverAPI) AccountWithdraw(ctx context.Context, req *bank_v1.AccountWit
 }
 
 func (s *serverAPI) AccountTransfer(ctx context.Context, req *bank_v1.AccountTransferRequest) (*bank_v1.AccountTransferResponse, error) {
-	reqValidateToken := &auth_v1.ValidateTokenRequest{Token: req.Jwt}
-	_, err := s.cl_auth_v1.ValidateToken(ctx, reqValidateToken)
-	st, ok := status.FromError(err)
-	if !ok {
-		return nil, status.Error(codes.Internal, "couldn't proceed jwt validation by auth service")
-	}
+	err := validateAccountTransfer(req)
 	if err != nil {
-		return nil, status.Error(st.Code(), st.Message())
+		return nil, err
 	}
 
-	err = validateAccountTransfer(req)
+	userID, err := callerID(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	writeOffAccountBalance, beneficiaryAccountBalance, err := s.bank.AccountTransfer(ctx, req.WriteOffAccountId, req.BeneficiaryAccountId, req.TransferAmount)
+	writeOffAccountBalance, beneficiaryAccountBalance, err := s.bank.AccountTransfer(ctx, userID, req.WriteOffAccountId, req.BeneficiaryAccountId, req.TransferAmount, req.IdempotencyKey)
+	if errors.Is(err, storage.ErrIdempotencyKeyMismatch) {
+		return nil, status.Error(codes.FailedPrecondition, "idempotency key is used for another request")
+	}
 	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
 		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
 	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
 	if errors.Is(err, bank.ErrAccountLocked) {
 		return nil, status.Error(codes.FailedPrecondition, "account is locked")
 	}
 	if errors.Is(err, storage.ErrNotEnoughMoney) {
 		return nil, status.Error(codes.ResourceExhausted, "not enough money")
 	}
+	if errors.Is(err, bank.ErrNoFxRate) {
+		return nil, status.Error(codes.FailedPrecondition, "no fx rate for the currencies of the accounts")
+	}
+	if errors.Is(err, bank.ErrTransferTooSmall) {
+		return nil, status.Error(codes.InvalidArgument, "converted amount rounds to zero")
+	}
+	if errors.Is(err, bank.ErrAmountOverflow) || errors.Is(err, storage.ErrAmountOverflow) {
+		return nil, status.Error(codes.InvalidArgument, "amount overflows the balance")
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to transfer")
 	}
@@ -172,17 +217,23 @@ func (s *serverAPI) AccountTransfer(ctx context.Context, req *bank_v1.AccountTra
 }
 
 func (s *serverAPI) AccountLock(ctx context.Context, req *bank_v1.AccountLockRequest) (*bank_v1.AccountLockResponse, error) {
-	// Forgot to add jwt in request
-
 	err := validateAccounLock(req)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.bank.AccountLock(ctx, req.AccountId)
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.bank.AccountLock(ctx, userID, s.byBank(ctx), req.AccountId, req.LockType, req.ReasonCode, req.Note)
 	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
 		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
 	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
 	if errors.Is(err, bank.ErrAccountLocked) {
 		return nil, status.Error(codes.FailedPrecondition, "account is already locked")
 	}
@@ -193,6 +244,355 @@ func (s *serverAPI) AccountLock(ctx context.Context, req *bank_v1.AccountLockReq
 	return &bank_v1.AccountLockResponse{}, nil
 }
 
+func (s *serverAPI) AccountUnlock(ctx context.Context, req *bank_v1.AccountUnlockRequest) (*bank_v1.AccountUnlockResponse, error) {
+	err := validateAccountUnlock(req)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.bank.AccountUnlock(ctx, userID, s.byBank(ctx), req.AccountId, req.Note)
+	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
+		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
+	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
+	if errors.Is(err, bank.ErrLockedByBank) {
+		return nil, status.Error(codes.PermissionDenied, "account is locked by the bank")
+	}
+	if errors.Is(err, bank.ErrAccountNotLocked) {
+		return nil, status.Error(codes.FailedPrecondition, "account is not locked")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to unlock account")
+	}
+
+	return &bank_v1.AccountUnlockResponse{}, nil
+}
+
+// Returning the auth user the interceptor validated the token of
+func callerID(ctx context.Context) (int64, error) {
+	identity, ok := authclient.IdentityFromContext(ctx)
+	if !ok || identity.UserID <= 0 {
+		return 0, status.Error(codes.PermissionDenied, "invalid token")
+	}
+
+	return identity.UserID, nil
+}
+
+// Tokens granted the lock admin scope act for the bank staff. Auth grants the scope only to its admins
+// and takes it away from the identity once the user is no longer one, so it is not a scope a customer
+// can ask for. An admin acting as a customer acts as the customer
+func (s *serverAPI) byBank(ctx context.Context) bool {
+	identity, _ := authclient.IdentityFromContext(ctx)
+
+	return s.lockAdminScope != "" && !identity.Impersonated() && slices.Contains(identity.Scopes, s.lockAdminScope)
+}
+
+func (s *serverAPI) GetAccount(ctx context.Context, req *bank_v1.GetAccountRequest) (*bank_v1.GetAccountResponse, error) {
+	err := validateGetAccount(req)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	account, owner, err := s.bank.GetAccount(ctx, userID, req.AccountId)
+	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
+		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
+	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get account")
+	}
+
+	return &bank_v1.GetAccountResponse{Account: accountToProto(account, owner)}, nil
+}
+
+func (s *serverAPI) ListAccounts(ctx context.Context, req *bank_v1.ListAccountsRequest) (*bank_v1.ListAccountsResponse, error) {
+	err := validateListAccounts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var afterID int64
+	err = decodePageToken(req.PageToken, &afterID)
+	if err != nil || afterID < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var isLocked *bool
+	if req.LockStatus != "" {
+		locked := req.LockStatus == lockStatusLocked
+		isLocked = &locked
+	}
+
+	page, err := s.bank.ListAccounts(ctx, userID, afterID, isLocked, int(req.PageSize))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list accounts")
+	}
+
+	resp := &bank_v1.ListAccountsResponse{Accounts: make([]*bank_v1.Account, 0, len(page.Accounts))}
+	for _, account := range page.Accounts {
+		resp.Accounts = append(resp.Accounts, accountToProto(account, page.Owner))
+	}
+	if page.NextAfterID != 0 {
+		resp.NextPageToken = encodePageToken(page.NextAfterID)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) ListTransactions(ctx context.Context, req *bank_v1.ListTransactionsRequest) (*bank_v1.ListTransactionsResponse, error) {
+	err := validateListTransactions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := transaction.Filter{MinAmount: req.MinAmount, MaxAmount: req.MaxAmount}
+	for _, name := range req.Types {
+		filter.Types = append(filter.Types, transactionTypes[name])
+	}
+	if req.From != 0 {
+		filter.From = time.Unix(req.From, 0)
+	}
+	if req.To != 0 {
+		filter.To = time.Unix(req.To, 0)
+	}
+
+	var beforeDate int64
+	err = decodePageToken(req.PageToken, &beforeDate, &filter.BeforeID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	if req.PageToken != "" {
+		filter.BeforeDate = time.UnixMicro(beforeDate)
+	}
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.bank.ListTransactions(ctx, userID, req.AccountId, filter, int(req.PageSize))
+	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
+		return nil, status.Error(codes.InvalidArgument, "account id does not exist")
+	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return nil, status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list transactions")
+	}
+
+	resp := &bank_v1.ListTransactionsResponse{Transactions: make([]*bank_v1.Transaction, 0, len(page.Transactions))}
+	for _, t := range page.Transactions {
+		resp.Transactions = append(resp.Transactions, transactionToProto(t, req.AccountId))
+	}
+	if page.NextID != 0 {
+		resp.NextPageToken = encodePageToken(page.NextDate.UnixMicro(), page.NextID)
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) GenerateStatement(req *bank_v1.GenerateStatementRequest, stream bank_v1.Bank_GenerateStatementServer) error {
+	err := validateGenerateStatement(req)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+
+	userID, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	from, to := statementPeriod(req)
+
+	// The statement reconciles before anything is rendered, so no part of a statement
+	// that does not is ever sent. The rest is sent as it is rendered
+	w := &statementWriter{stream: stream}
+
+	r, err := statement.New(req.Format, w)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "format must be csv, ofx or camt053")
+	}
+
+	err = s.bank.GenerateStatement(ctx, userID, req.AccountId, from, to, r)
+	if errors.Is(err, bank.ErrAccountIDDoesNotExist) {
+		return status.Error(codes.InvalidArgument, "account id does not exist")
+	}
+	if errors.Is(err, bank.ErrNotAccountOwner) {
+		return status.Error(codes.PermissionDenied, "account belongs to another owner")
+	}
+	if errors.Is(err, bank.ErrStatementUnreconciled) {
+		return status.Error(codes.DataLoss, "statement does not reconcile")
+	}
+	if err == nil {
+		err = w.flush()
+	}
+	if w.err != nil {
+		return status.Error(codes.Internal, "failed to send statement")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "failed to generate statement")
+	}
+
+	return nil
+}
+
+// Sends the statement in chunks of statementChunkSize as it is written, the last one on flush
+type statementWriter struct {
+	stream bank_v1.Bank_GenerateStatementServer
+	buf    []byte
+	err    error
+}
+
+func (w *statementWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= statementChunkSize {
+		// A sent chunk is not reused, the stream may still hold it
+		chunk := w.buf[:statementChunkSize:statementChunkSize]
+		w.buf = slices.Clone(w.buf[statementChunkSize:])
+
+		w.send(chunk)
+		if w.err != nil {
+			return 0, w.err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (w *statementWriter) flush() error {
+	if w.err == nil && len(w.buf) > 0 {
+		w.send(w.buf)
+		w.buf = nil
+	}
+
+	return w.err
+}
+
+func (w *statementWriter) send(data []byte) {
+	w.err = w.stream.Send(&bank_v1.StatementChunk{Data: data})
+}
+
+func (s *serverAPI) SetFxRate(ctx context.Context, req *bank_v1.SetFxRateRequest) (*bank_v1.SetFxRateResponse, error) {
+	err := validateSetFxRate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.bank.SetFxRate(ctx, req.Base, req.Quote, req.Rate)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to set fx rate")
+	}
+
+	return &bank_v1.SetFxRateResponse{}, nil
+}
+
+func accountToProto(account models.Account, owner models.Owner) *bank_v1.Account {
+	resp := &bank_v1.Account{
+		Id:        account.ID,
+		Balance:   account.Balance,
+		IsLocked:  account.IsLocked,
+		CreatedAt: account.CreatedAt.Unix(),
+		Currency:  account.Currency,
+		Owner: &bank_v1.Owner{
+			Id:          owner.ID,
+			FullName:    owner.FullName,
+			Citizenship: owner.Citizenship,
+		},
+	}
+	if account.Lock != nil {
+		resp.Lock = &bank_v1.AccountLock{
+			LockType:   account.Lock.Type,
+			ReasonCode: account.Lock.Reason,
+			Note:       account.Lock.Note,
+			LockedBy:   account.Lock.LockedBy,
+			ByBank:     account.Lock.ByBank,
+			LockedAt:   account.Lock.LockedAt.Unix(),
+		}
+	}
+
+	return resp
+}
+
+func transactionToProto(t transaction.Transaction, accountID int64) *bank_v1.Transaction {
+	resp := &bank_v1.Transaction{
+		Id:                    t.ID,
+		Type:                  transaction.TypeNames[t.TransactionType],
+		Amount:                t.AmountFor(accountID),
+		CounterpartyAccountId: t.Counterparty(accountID),
+		Incoming:              t.Incoming(accountID),
+		Date:                  t.Date.Unix(),
+	}
+
+	if t.FxRate != "" {
+		resp.FxRate = t.FxRate
+		resp.CounterpartyAmount = t.AmountFor(t.Counterparty(accountID))
+	}
+
+	return resp
+}
+
+// Page tokens are opaque for clients: base64 of the keys of the last row of the page joined with dots
+func encodePageToken(keys ...int64) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, strconv.FormatInt(key, 10))
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ".")))
+}
+
+// Fills the keys from the page token, an empty token leaves them as is
+func decodePageToken(token string, keys ...*int64) error {
+	if token == "" {
+		return nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != len(keys) {
+		return errors.New("unexpected number of keys")
+	}
+
+	for i, part := range parts {
+		*keys[i], err = strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func validateCreateAccount(req *bank_v1.CreateAccountRequest) error {
 	if req.FullName == "" {
 		return status.Error(codes.InvalidArgument, "full name is required")
@@ -206,6 +606,10 @@ func validateCreateAccount(req *bank_v1.CreateAccountRequest) error {
 		return status.Error(codes.InvalidArgument, "incorrect balance")
 	}
 
+	if req.Currency != "" && !fx.ValidCurrency(req.Currency) {
+		return status.Error(codes.InvalidArgument, "currency must be an ISO 4217 code")
+	}
+
 	return nil
 }
 
@@ -218,6 +622,10 @@ func validateAccountTopUp(req *bank_v1.AccountTopUpRequest) error {
 		return status.Error(codes.InvalidArgument, "incorrect or empty amount")
 	}
 
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLen {
+		return status.Error(codes.InvalidArgument, "idempotency key is too long")
+	}
+
 	return nil
 }
 
@@ -230,6 +638,10 @@ func validateAccountWithdraw(req *bank_v1.AccountWithdrawRequest) error {
 		return status.Error(codes.InvalidArgument, "incorrect or empty amount")
 	}
 
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLen {
+		return status.Error(codes.InvalidArgument, "idempotency key is too long")
+	}
+
 	return nil
 }
 func validateAccountTransfer(req *bank_v1.AccountTransferRequest) error {
@@ -245,6 +657,10 @@ func validateAccountTransfer(req *bank_v1.AccountTransferRequest) error {
 		return status.Error(codes.InvalidArgument, "incorrect or empty amount")
 	}
 
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLen {
+		return status.Error(codes.InvalidArgument, "idempotency key is too long")
+	}
+
 	return nil
 }
 func validateAccounLock(req *bank_v1.AccountLockRequest) error {
@@ -252,5 +668,120 @@ func validateAccounLock(req *bank_v1.AccountLockRequest) error {
 		return status.Error(codes.InvalidArgument, "incorrect or empty account id")
 	}
 
+	if req.LockType != "" && !models.ValidLockType(req.LockType) {
+		return status.Error(codes.InvalidArgument, "lock type must be freeze, debit_block or credit_block")
+	}
+
+	if !models.ValidLockReason(req.ReasonCode) {
+		return status.Error(codes.InvalidArgument, "reason code must be one of "+strings.Join(models.LockReasons, ", "))
+	}
+
+	if utf8.RuneCountInString(req.Note) > maxLockNoteLen {
+		return status.Error(codes.InvalidArgument, "note is too long")
+	}
+
+	return nil
+}
+
+func validateAccountUnlock(req *bank_v1.AccountUnlockRequest) error {
+	if req.AccountId <= 0 {
+		return status.Error(codes.InvalidArgument, "incorrect or empty account id")
+	}
+
+	if utf8.RuneCountInString(req.Note) > maxLockNoteLen {
+		return status.Error(codes.InvalidArgument, "note is too long")
+	}
+
+	return nil
+}
+
+func validateGetAccount(req *bank_v1.GetAccountRequest) error {
+	if req.AccountId <= 0 {
+		return status.Error(codes.InvalidArgument, "incorrect or empty account id")
+	}
+
+	return nil
+}
+
+func validateListAccounts(req *bank_v1.ListAccountsRequest) error {
+	switch req.LockStatus {
+	case "", lockStatusLocked, lockStatusActive:
+	default:
+		return status.Error(codes.InvalidArgument, "lock status must be locked or active")
+	}
+
+	if req.PageSize < 0 {
+		return status.Error(codes.InvalidArgument, "incorrect page size")
+	}
+
+	return nil
+}
+
+func validateListTransactions(req *bank_v1.ListTransactionsRequest) error {
+	if req.AccountId <= 0 {
+		return status.Error(codes.InvalidArgument, "incorrect or empty account id")
+	}
+
+	for _, name := range req.Types {
+		if _, ok := transactionTypes[name]; !ok {
+			return status.Error(codes.InvalidArgument, "transaction type must be TopUp, Withdraw or Transfer")
+		}
+	}
+
+	if req.From < 0 || req.To < 0 || req.To != 0 && req.To <= req.From {
+		return status.Error(codes.InvalidArgument, "incorrect date range")
+	}
+
+	if req.MinAmount < 0 || req.MaxAmount < 0 || req.MaxAmount != 0 && req.MaxAmount < req.MinAmount {
+		return status.Error(codes.InvalidArgument, "incorrect amount range")
+	}
+
+	if req.PageSize < 0 {
+		return status.Error(codes.InvalidArgument, "incorrect page size")
+	}
+
+	return nil
+}
+
+func validateGenerateStatement(req *bank_v1.GenerateStatementRequest) error {
+	if req.AccountId <= 0 {
+		return status.Error(codes.InvalidArgument, "incorrect or empty account id")
+	}
+
+	if req.From <= 0 || req.To < 0 || req.To != 0 && req.To <= req.From {
+		return status.Error(codes.InvalidArgument, "incorrect date range")
+	}
+
+	from, to := statementPeriod(req)
+	if to.Sub(from) > maxStatementPeriod {
+		return status.Error(codes.InvalidArgument, "statement period is longer than a year")
+	}
+
+	return nil
+}
+
+// Returning [from, to) of the request, 0 to means now
+func statementPeriod(req *bank_v1.GenerateStatementRequest) (time.Time, time.Time) {
+	to := time.Now()
+	if req.To != 0 {
+		to = time.Unix(req.To, 0)
+	}
+
+	return time.Unix(req.From, 0), to
+}
+
+func validateSetFxRate(req *bank_v1.SetFxRateRequest) error {
+	if !fx.ValidCurrency(req.Base) || !fx.ValidCurrency(req.Quote) {
+		return status.Error(codes.InvalidArgument, "base and quote must be ISO 4217 codes")
+	}
+
+	if req.Base == req.Quote {
+		return status.Error(codes.InvalidArgument, "base and quote must differ")
+	}
+
+	if _, err := fx.ParseRate(req.Rate); err != nil {
+		return status.Error(codes.InvalidArgument, "rate must be a positive decimal with up to 12 digits on each side of the point")
+	}
+
 	return nil
 }
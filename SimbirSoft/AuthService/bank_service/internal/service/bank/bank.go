@@ -2,190 +2,726 @@ package bank
 
 import (
 	"bank_service/internal/domain/models"
+	"bank_service/internal/domain/models/money"
+	"bank_service/internal/domain/models/transaction"
+	"bank_service/internal/fx"
+	"bank_service/internal/metrics"
+	"bank_service/internal/statement"
 	"bank_service/internal/storage"
 	"bank_service/internal/storage/postgres"
 	"bank_service/pkg/logger/sl"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAccountsLimit     = 50
+	maxAccountsLimit         = 500
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 500
 )
 
 var (
 	ErrAccountLocked         = errors.New("account id is locked")
 	ErrAccountIDDoesNotExist = errors.New("account id does not exist")
+	ErrNotAccountOwner       = errors.New("account belongs to another owner")
+	ErrStatementUnreconciled = errors.New("statement does not reconcile")
+	ErrNoFxRate              = errors.New("no fx rate for the currencies")
+	ErrTransferTooSmall      = errors.New("converted amount rounds to zero")
+	ErrAmountOverflow        = errors.New("amount overflows the balance")
+	ErrAccountNotLocked      = errors.New("account id is not locked")
+	ErrLockedByBank          = errors.New("account is locked by the bank")
+)
+
+// Way the money moves on an account, the lock of the account is checked against it
+type movement int
+
+const (
+	debit movement = iota
+	credit
 )
 
 type Bank struct {
-	log               *slog.Logger
-	ownerModifier     OwnerModifier
-	accountModifier   AccountModifier
-	accountTransacter AccountTransacter
+	log                 *slog.Logger
+	ownerModifier       OwnerModifier
+	accountModifier     AccountModifier
+	accountTransacter   AccountTransacter
+	transactionProvider TransactionProvider
+	fxRateModifier      FxRateModifier
+	defaultCurrency     string
+	rounding            fx.Rounding
+	idempotencyTTL      time.Duration
 }
 
 type OwnerModifier interface {
-	CreateOwner(ctx context.Context, fullName, citizenship string) (models.Owner, error)
-	Owner(ctx context.Context, fullName string) (models.Owner, error)
+	CreateOwner(ctx context.Context, userID int64, fullName, citizenship string) (models.Owner, error)
+	Owner(ctx context.Context, userID int64) (models.Owner, error)
 }
 
 type AccountModifier interface {
-	// Returning created account ID, balance and error
-	CreateAccount(ctx context.Context, ownerID, balance int64) (models.Account, error)
+	// Returning created account and error
+	CreateAccount(ctx context.Context, ownerID, balance int64, currency string) (models.Account, error)
 	Account(ctx context.Context, id int64) (models.Account, error)
-	AccountLock(ctx context.Context, id int64) error
+	// Returning up to limit accounts of the owner after afterID ordered by ID, isLocked nil means any
+	OwnerAccounts(ctx context.Context, ownerID, afterID int64, isLocked *bool, limit int) ([]models.Account, error)
+	// Placing the lock on an unlocked account, the change is recorded in the lock history
+	AccountLock(ctx context.Context, id int64, lock models.AccountLock) error
+	// Lifting the lock of the account, the change is recorded in the lock history
+	AccountUnlock(ctx context.Context, id, userID int64, byBank bool, note string) error
 }
 
+// A non-nil key is stored with the balances in the transaction of the operation,
+// a replay of the key returns the stored balances
 type AccountTransacter interface {
 	// Returning updated account balance and error
-	AccountTopUp(ctx context.Context, accountID, amount int64) (int64, error)
+	AccountTopUp(ctx context.Context, accountID, amount int64, key *models.IdempotencyKey) (int64, error)
 	// Returning updated account balance and error
-	AccountWithdraw(ctx context.Context, accountID, amount int64) (int64, error)
-	// Returning updated accounts balances and error
-	AccountTransfer(ctx context.Context, writeOfAccountID, beneficiaryAccountID, amount int64) (int64, int64, error)
+	AccountWithdraw(ctx context.Context, accountID, amount int64, key *models.IdempotencyKey) (int64, error)
+	// Returning updated accounts balances and error, rate is empty for accounts in the same currency
+	AccountTransfer(
+		ctx context.Context,
+		writeOfAccountID, beneficiaryAccountID, amount, beneficiaryAmount int64,
+		rate string,
+		key *models.IdempotencyKey,
+	) (int64, int64, error)
+	// Returning the balances stored with the live key
+	IdempotentResponse(ctx context.Context, key models.IdempotencyKey) ([]int64, error)
+}
+
+type FxRateModifier interface {
+	// Returning the rate of the pair in either direction
+	FxRate(ctx context.Context, base, quote string) (models.FxRate, error)
+	SetFxRates(ctx context.Context, rates []models.FxRate) error
+}
+
+type TransactionProvider interface {
+	// Returning up to limit transactions of the account including incoming transfers, newest first
+	AccountTransactions(ctx context.Context, accountID int64, filter transaction.Filter, limit int) ([]transaction.Transaction, error)
+	// Reading the balances at from and to, the sum of the transactions between them and
+	// the transactions themselves, oldest first, from one snapshot
+	AccountStatement(
+		ctx context.Context,
+		accountID int64,
+		from, to time.Time,
+		begin func(opening, closing, net int64) error,
+		entry func(t transaction.Transaction) error,
+	) error
 }
 
+// Accounts are opened in defaultCurrency unless another one is asked for,
+// transfers between currencies are rounded to whole units by rounding.
+// Idempotency keys of money-moving operations expire after idempotencyTTL
 func New(
 	log *slog.Logger,
 	storage *postgres.Storage,
+	defaultCurrency string,
+	rounding fx.Rounding,
+	idempotencyTTL time.Duration,
 ) *Bank {
 	return &Bank{
-		log:               log,
-		ownerModifier:     storage,
-		accountModifier:   storage,
-		accountTransacter: storage,
+		log:                 log,
+		ownerModifier:       storage,
+		accountModifier:     storage,
+		accountTransacter:   storage,
+		transactionProvider: storage,
+		fxRateModifier:      storage,
+		defaultCurrency:     defaultCurrency,
+		rounding:            rounding,
+		idempotencyTTL:      idempotencyTTL,
 	}
 }
 
-// Returning created account ID, balance and error
-func (b *Bank) CreateAccount(ctx context.Context, fullName, citizenship string, balance int64) (int64, int64, error) {
+// Returning created account and error.
+// The account is opened for the owner of the auth user, the owner is created on the first account.
+// An empty currency means the default one
+func (b *Bank) CreateAccount(ctx context.Context, userID int64, fullName, citizenship, currency string, balance int64) (models.Account, error) {
 	const op = "internal.service.bank.CreateAccount"
 
-	log := b.log.With(slog.String("op", op))
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
 
 	// Check on owner and get his id if exist
-	owner, err := b.ownerModifier.Owner(ctx, fullName)
+	owner, err := b.ownerModifier.Owner(ctx, userID)
 	if err != nil {
 		if !errors.Is(err, storage.ErrOwnerDoesNotExist) { // If owner exist but err was not nil return by DB error
 			log.Error("failed to get owner", sl.Err(err))
-			return 0, 0, fmt.Errorf("%s: %w", op, err)
+			return models.Account{}, fmt.Errorf("%s: %w", op, err)
 		}
 
-		owner, err = b.ownerModifier.CreateOwner(ctx, fullName, citizenship)
+		owner, err = b.ownerModifier.CreateOwner(ctx, userID, fullName, citizenship)
 		if err != nil {
 			log.Error("failed to create owner", sl.Err(err))
-			return 0, 0, fmt.Errorf("%s: %w", op, err)
+			return models.Account{}, fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
-	account, err := b.accountModifier.CreateAccount(ctx, owner.ID, balance)
+	if currency == "" {
+		currency = b.defaultCurrency
+	}
+
+	account, err := b.accountModifier.CreateAccount(ctx, owner.ID, balance, currency)
 	if err != nil {
 		log.Error("failed to create account", sl.Err(err))
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return models.Account{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return account.ID, account.Balance, nil
+	return account, nil
 }
 
-// Returning updated account balance and error
-func (b *Bank) AccountTopUp(ctx context.Context, accountID, amount int64) (int64, error) {
+// Returning updated account balance and error.
+// A retry with the same idempotency key returns the balance of the first call
+func (b *Bank) AccountTopUp(ctx context.Context, userID, accountID, amount int64, idempotencyKey string) (int64, error) {
 	const op = "internal.service.bank.AccountTopUp"
 
-	log := b.log.With(slog.String("op", op))
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	key := b.idempotencyKey(userID, idempotencyKey, op, accountID, amount)
+	if replayed, err := b.replay(ctx, key, 1); replayed != nil || err != nil {
+		if err != nil {
+			log.Warn("failed to replay", sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		return replayed[0], nil
+	}
 
 	// Check on account
-	_, err := validateAccount(ctx, b, accountID)
+	account, err := validateAccount(ctx, b, accountID, credit)
 	if err != nil {
 		log.Error("failed to validate account id", sl.Err(err))
+		observe(metrics.TypeTopUp, account.Currency, amount, err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	balance, err := b.accountTransacter.AccountTopUp(ctx, accountID, amount)
+	err = validateOwner(ctx, b, userID, account)
+	if err != nil {
+		log.Warn("account of another owner", sl.Err(err))
+		observe(metrics.TypeTopUp, account.Currency, amount, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = validateCredit(account, amount)
+	if err != nil {
+		log.Warn("top up overflows the balance", sl.Err(err))
+		observe(metrics.TypeTopUp, account.Currency, amount, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	balance, err := b.accountTransacter.AccountTopUp(ctx, accountID, amount, key)
+	if errors.Is(err, storage.ErrAccountLocked) {
+		log.Warn("account id was locked before the top up", sl.Err(err))
+		observe(metrics.TypeTopUp, account.Currency, amount, ErrAccountLocked)
+		return 0, fmt.Errorf("%s: %w", op, ErrAccountLocked)
+	}
 	if err != nil {
 		log.Error("failed to get account", sl.Err(err))
+		observe(metrics.TypeTopUp, account.Currency, amount, err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	observe(metrics.TypeTopUp, account.Currency, amount, nil)
+
 	return balance, nil
 }
 
-// Returning updated account balance and error
-func (b *Bank) AccountWithdraw(ctx context.Context, accountID, amount int64) (int64, error) {
+// Returning updated account balance and error.
+// A retry with the same idempotency key returns the balance of the first call
+func (b *Bank) AccountWithdraw(ctx context.Context, userID, accountID, amount int64, idempotencyKey string) (int64, error) {
 	const op = "internal.service.bank.AccountWithdraw"
 
-	log := b.log.With(slog.String("op", op))
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	key := b.idempotencyKey(userID, idempotencyKey, op, accountID, amount)
+	if replayed, err := b.replay(ctx, key, 1); replayed != nil || err != nil {
+		if err != nil {
+			log.Warn("failed to replay", sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		return replayed[0], nil
+	}
 
 	// Check on account
-	_, err := validateAccount(ctx, b, accountID)
+	account, err := validateAccount(ctx, b, accountID, debit)
 	if err != nil {
 		log.Error("failed to validate account id", sl.Err(err))
+		observe(metrics.TypeWithdraw, account.Currency, amount, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = validateOwner(ctx, b, userID, account)
+	if err != nil {
+		log.Warn("account of another owner", sl.Err(err))
+		observe(metrics.TypeWithdraw, account.Currency, amount, err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	balance, err := b.accountTransacter.AccountWithdraw(ctx, accountID, amount)
+	balance, err := b.accountTransacter.AccountWithdraw(ctx, accountID, amount, key)
+	if errors.Is(err, storage.ErrAccountLocked) {
+		log.Warn("account id was locked before the withdrawal", sl.Err(err))
+		observe(metrics.TypeWithdraw, account.Currency, amount, ErrAccountLocked)
+		return 0, fmt.Errorf("%s: %w", op, ErrAccountLocked)
+	}
 	if err != nil {
 		log.Error("failed to withdraw", sl.Err(err))
+		observe(metrics.TypeWithdraw, account.Currency, amount, err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	observe(metrics.TypeWithdraw, account.Currency, amount, nil)
+
 	return balance, nil
 }
 
-// Returning updated accounts balances and error
-func (b *Bank) AccountTransfer(ctx context.Context, writeOfAccountID, beneficiaryAccountID, amount int64) (int64, int64, error) {
+// Returning updated accounts balances and error.
+// Only the write off account must belong to the user, the beneficiary may be anyone's.
+// Between accounts in different currencies the amount is converted by the stored rate.
+// A retry with the same idempotency key returns the balances of the first call
+func (b *Bank) AccountTransfer(ctx context.Context, userID, writeOfAccountID, beneficiaryAccountID, amount int64, idempotencyKey string) (int64, int64, error) {
 	const op = "internal.service.bank.AccountTransfer"
 
-	log := b.log.With(slog.String("op", op))
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	key := b.idempotencyKey(userID, idempotencyKey, op, writeOfAccountID, beneficiaryAccountID, amount)
+	if replayed, err := b.replay(ctx, key, 2); replayed != nil || err != nil {
+		if err != nil {
+			log.Warn("failed to replay", sl.Err(err))
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		return replayed[0], replayed[1], nil
+	}
 
 	// Check on account
-	_, err := validateAccount(ctx, b, writeOfAccountID)
+	writeOffAccount, err := validateAccount(ctx, b, writeOfAccountID, debit)
 	if err != nil {
 		log.Error("failed to validate write off account id", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
+		return 0, 0, fmt.Errorf("%s: write off %w", op, err)
+	}
+
+	err = validateOwner(ctx, b, userID, writeOffAccount)
+	if err != nil {
+		log.Warn("write off account of another owner", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
 		return 0, 0, fmt.Errorf("%s: write off %w", op, err)
 	}
 
 	// Check on beneficiary account
-	_, err = validateAccount(ctx, b, beneficiaryAccountID)
+	beneficiaryAccount, err := validateAccount(ctx, b, beneficiaryAccountID, credit)
 	if err != nil {
 		log.Error("failed to validate beneficiary account id", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
 		return 0, 0, fmt.Errorf("%s: beneficiary %w", op, err)
 	}
 
-	writeOffAccountBalance, bebeneficiaryAccountBalance, err := b.accountTransacter.AccountTransfer(ctx, writeOfAccountID, beneficiaryAccountID, amount)
+	beneficiaryAmount, rate := amount, ""
+	if writeOffAccount.Currency != beneficiaryAccount.Currency {
+		beneficiaryAmount, rate, err = b.convert(ctx, writeOffAccount.Currency, beneficiaryAccount.Currency, amount)
+		if err != nil {
+			log.Warn("failed to convert",
+				slog.String("from", writeOffAccount.Currency),
+				slog.String("to", beneficiaryAccount.Currency),
+				sl.Err(err),
+			)
+			observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
+			return 0, 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = validateCredit(beneficiaryAccount, beneficiaryAmount)
+	if err != nil {
+		log.Warn("transfer overflows the beneficiary balance", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
+		return 0, 0, fmt.Errorf("%s: beneficiary %w", op, err)
+	}
+
+	writeOffAccountBalance, bebeneficiaryAccountBalance, err := b.accountTransacter.AccountTransfer(ctx, writeOfAccountID, beneficiaryAccountID, amount, beneficiaryAmount, rate, key)
+	if errors.Is(err, storage.ErrAccountLocked) {
+		log.Warn("account id was locked before the transfer", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, ErrAccountLocked)
+		return 0, 0, fmt.Errorf("%s: %w", op, ErrAccountLocked)
+	}
 	if err != nil {
 		log.Error("failed to transfer", sl.Err(err))
+		observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, err)
 		return 0, 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	observe(metrics.TypeTransfer, writeOffAccount.Currency, amount, nil)
+
 	return writeOffAccountBalance, bebeneficiaryAccountBalance, nil
 }
 
-func (b *Bank) AccountLock(ctx context.Context, accountID int64) error {
+// Placing a lock on the account of the user, or on any account by the bank staff.
+// An empty lock type means a freeze
+func (b *Bank) AccountLock(ctx context.Context, userID int64, byBank bool, accountID int64, lockType, reason, note string) error {
 	const op = "internal.service.bank.AccountLock"
 
-	log := b.log.With(slog.String("op", op))
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("by_bank", byBank))
 
-	// Check on account
-	_, err := validateAccount(ctx, b, accountID)
-	if errors.Is(err, ErrAccountLocked) {
-		log.Error("account id is already locked")
+	account, err := lockableAccount(ctx, b, userID, byBank, accountID)
+	if err != nil {
+		log.Warn("failed to validate account id", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if account.IsLocked {
+		log.Warn("account id is already locked")
 		return fmt.Errorf("%s: %w", op, ErrAccountLocked)
 	}
-	if err != nil {
-		log.Error("failed to validate account id", sl.Err(err))
-		return fmt.Errorf("%s: failed to validate account id", op)
+
+	if lockType == "" {
+		lockType = models.LockFreeze
 	}
 
-	err = b.accountModifier.AccountLock(ctx, accountID)
+	err = b.accountModifier.AccountLock(ctx, accountID, models.AccountLock{
+		Type:     lockType,
+		Reason:   reason,
+		Note:     note,
+		LockedBy: userID,
+		ByBank:   byBank,
+	})
+	if errors.Is(err, storage.ErrAccountLocked) {
+		log.Warn("account id is already locked")
+		return fmt.Errorf("%s: %w", op, ErrAccountLocked)
+	}
 	if err != nil {
 		log.Error("failed to lock", sl.Err(err))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	log.Info("account locked", slog.Int64("account_id", accountID), slog.String("lock_type", lockType), slog.String("reason", reason))
+
 	return nil
 }
 
-// Return true if account id exists and not locked
-func validateAccount(ctx context.Context, b *Bank, accountID int64) (models.Account, error) {
+// Lifting the lock of the account of the user, or of any account by the bank staff.
+// A lock placed by the bank is lifted by the bank only
+func (b *Bank) AccountUnlock(ctx context.Context, userID int64, byBank bool, accountID int64, note string) error {
+	const op = "internal.service.bank.AccountUnlock"
+
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("by_bank", byBank))
+
+	account, err := lockableAccount(ctx, b, userID, byBank, accountID)
+	if err != nil {
+		log.Warn("failed to validate account id", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !account.IsLocked {
+		log.Warn("account id is not locked")
+		return fmt.Errorf("%s: %w", op, ErrAccountNotLocked)
+	}
+
+	if account.Lock.ByBank && !byBank {
+		log.Warn("account id is locked by the bank")
+		return fmt.Errorf("%s: %w", op, ErrLockedByBank)
+	}
+
+	err = b.accountModifier.AccountUnlock(ctx, accountID, userID, byBank, note)
+	if errors.Is(err, storage.ErrAccountNotLocked) {
+		log.Warn("account id is not locked")
+		return fmt.Errorf("%s: %w", op, ErrAccountNotLocked)
+	}
+	if err != nil {
+		log.Error("failed to unlock", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account unlocked", slog.Int64("account_id", accountID))
+
+	return nil
+}
+
+// Returning the account and its owner, the account must belong to the auth user. Locked accounts are returned too
+func (b *Bank) GetAccount(ctx context.Context, userID, accountID int64) (models.Account, models.Owner, error) {
+	const op = "internal.service.bank.GetAccount"
+
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	account, err := b.accountModifier.Account(ctx, accountID)
+	if errors.Is(err, storage.ErrAccountDoesNotExist) {
+		return models.Account{}, models.Owner{}, fmt.Errorf("%s: %w", op, ErrAccountIDDoesNotExist)
+	}
+	if err != nil {
+		log.Error("failed to get account", sl.Err(err))
+		return models.Account{}, models.Owner{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	owner, err := b.ownerModifier.Owner(ctx, userID)
+	if errors.Is(err, storage.ErrOwnerDoesNotExist) || err == nil && owner.ID != account.OwnerID {
+		log.Warn("account of another owner", slog.Int64("account_id", accountID))
+		return models.Account{}, models.Owner{}, fmt.Errorf("%s: %w", op, ErrNotAccountOwner)
+	}
+	if err != nil {
+		log.Error("failed to get owner", sl.Err(err))
+		return models.Account{}, models.Owner{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return account, owner, nil
+}
+
+// Returning a page of up to limit accounts of the auth user with ID greater than afterID.
+// isLocked filters by the lock status, nil means any. A user without an owner has no accounts
+func (b *Bank) ListAccounts(ctx context.Context, userID, afterID int64, isLocked *bool, limit int) (models.AccountsPage, error) {
+	const op = "internal.service.bank.ListAccounts"
+
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if limit <= 0 {
+		limit = defaultAccountsLimit
+	}
+	limit = min(limit, maxAccountsLimit)
+
+	owner, err := b.ownerModifier.Owner(ctx, userID)
+	if errors.Is(err, storage.ErrOwnerDoesNotExist) {
+		return models.AccountsPage{}, nil
+	}
+	if err != nil {
+		log.Error("failed to get owner", sl.Err(err))
+		return models.AccountsPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// One more account tells if there is a next page
+	accounts, err := b.accountModifier.OwnerAccounts(ctx, owner.ID, afterID, isLocked, limit+1)
+	if err != nil {
+		log.Error("failed to list accounts", sl.Err(err))
+		return models.AccountsPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := models.AccountsPage{Accounts: accounts, Owner: owner}
+	if len(accounts) > limit {
+		page.Accounts = accounts[:limit]
+		page.NextAfterID = page.Accounts[limit-1].ID
+	}
+
+	return page, nil
+}
+
+// Returning a page of up to limit transactions of the account of the auth user matching the filter,
+// newest first. Incoming transfers are included, the account may be locked
+func (b *Bank) ListTransactions(ctx context.Context, userID, accountID int64, filter transaction.Filter, limit int) (transaction.Page, error) {
+	const op = "internal.service.bank.ListTransactions"
+
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if limit <= 0 {
+		limit = defaultTransactionsLimit
+	}
+	limit = min(limit, maxTransactionsLimit)
+
+	_, _, err := b.GetAccount(ctx, userID, accountID)
+	if err != nil {
+		return transaction.Page{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// One more transaction tells if there is a next page
+	transactions, err := b.transactionProvider.AccountTransactions(ctx, accountID, filter, limit+1)
+	if err != nil {
+		log.Error("failed to list transactions", sl.Err(err))
+		return transaction.Page{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := transaction.Page{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextDate, page.NextID = last.Date, last.ID
+	}
+
+	return page, nil
+}
+
+// Renders the statement of the account of the auth user for [from, to): the opening balance,
+// the entries and the closing balance. Unless the opening balance plus the sum of the entries
+// equals the closing balance ErrStatementUnreconciled is returned before anything is rendered
+func (b *Bank) GenerateStatement(ctx context.Context, userID, accountID int64, from, to time.Time, r statement.Renderer) error {
+	const op = "internal.service.bank.GenerateStatement"
+
+	log := b.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Int64("account_id", accountID))
+
+	account, owner, err := b.GetAccount(ctx, userID, accountID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var balance, closing int64
+	var entries int
+
+	err = b.transactionProvider.AccountStatement(ctx, accountID, from, to,
+		func(opening, closingBalance, net int64) error {
+			balance, closing = opening, closingBalance
+
+			if opening+net != closing {
+				log.Error("statement does not reconcile",
+					slog.Int64("opening_balance", opening),
+					slog.Int64("closing_balance", closing),
+					slog.Int64("entries_sum", net),
+				)
+				return ErrStatementUnreconciled
+			}
+
+			return r.Begin(statement.Header{
+				AccountID:      accountID,
+				Owner:          owner.FullName,
+				Currency:       account.Currency,
+				From:           from,
+				To:             to,
+				OpeningBalance: opening,
+				ClosingBalance: closingBalance,
+				GeneratedAt:    time.Now(),
+			})
+		},
+		func(t transaction.Transaction) error {
+			balance += t.Net(accountID)
+			entries++
+
+			return r.Entry(statement.Entry{
+				TransactionID:         t.ID,
+				Date:                  t.Date,
+				Type:                  transaction.TypeNames[t.TransactionType],
+				Amount:                t.Net(accountID),
+				CounterpartyAccountID: t.Counterparty(accountID),
+				Balance:               balance,
+			})
+		},
+	)
+	if errors.Is(err, ErrStatementUnreconciled) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err != nil {
+		log.Error("failed to generate statement", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The entries are summed up by the query the same way, this only fails if the two drift apart
+	if balance != closing {
+		log.Error("statement entries do not reconcile",
+			slog.Int64("closing_balance", closing),
+			slog.Int64("entries_balance", balance),
+			slog.Int("entries", entries),
+		)
+		return fmt.Errorf("%s: %w", op, ErrStatementUnreconciled)
+	}
+
+	err = r.End()
+	if err != nil {
+		log.Error("failed to complete statement", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Sets the rate of base to quote: how many units of quote are given for one unit of base.
+// The rate of the opposite direction is used as 1/rate until it is set too
+func (b *Bank) SetFxRate(ctx context.Context, base, quote, rate string) error {
+	const op = "internal.service.bank.SetFxRate"
+
+	log := b.log.With(slog.String("op", op), slog.String("base", base), slog.String("quote", quote))
+
+	err := b.fxRateModifier.SetFxRates(ctx, []models.FxRate{{Base: base, Quote: quote, Rate: rate}})
+	if err != nil {
+		log.Error("failed to set fx rate", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("fx rate set", slog.String("rate", rate))
+
+	return nil
+}
+
+// Returning the amount converted from one currency to another and the rate it was converted by.
+// The rate is recorded with the transfer, so the amount is converted by the recorded one
+func (b *Bank) convert(ctx context.Context, from, to string, amount int64) (int64, string, error) {
+	const op = "convert"
+
+	stored, err := b.fxRateModifier.FxRate(ctx, from, to)
+	if errors.Is(err, storage.ErrFxRateDoesNotExist) {
+		return 0, "", fmt.Errorf("%s: %w: %s/%s", op, ErrNoFxRate, from, to)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	rate, err := fx.ParseRate(stored.Rate)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %s/%s: %w", op, stored.Base, stored.Quote, err)
+	}
+
+	if stored.Base != from {
+		rate, err = fx.ParseRate(fx.FormatRate(fx.Inverse(rate)))
+		if err != nil {
+			return 0, "", fmt.Errorf("%s: inverse of %s/%s: %w", op, stored.Base, stored.Quote, err)
+		}
+	}
+
+	converted, err := fx.Convert(amount, from, to, rate, b.rounding)
+	if errors.Is(err, fx.ErrOverflow) {
+		return 0, "", fmt.Errorf("%s: %w", op, ErrAmountOverflow)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+	if converted == 0 {
+		return 0, "", fmt.Errorf("%s: %w", op, ErrTransferTooSmall)
+	}
+
+	return converted, fx.FormatRate(rate), nil
+}
+
+// Returning the key of the request of the user, nil without a key. The fingerprint is the hash
+// of the operation and its arguments: the same key with other ones is another request
+func (b *Bank) idempotencyKey(userID int64, key, operation string, args ...int64) *models.IdempotencyKey {
+	if key == "" {
+		return nil
+	}
+
+	parts := []string{operation}
+	for _, arg := range args {
+		parts = append(parts, strconv.FormatInt(arg, 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+
+	return &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		TTL:         b.idempotencyTTL,
+	}
+}
+
+// Returning the n balances stored with the key if the request was already done, nil otherwise.
+// The replay comes before any check: the first call passed them, the account may have changed since.
+// A request racing with the first call is settled by the storage
+func (b *Bank) replay(ctx context.Context, key *models.IdempotencyKey, n int) ([]int64, error) {
+	const op = "replay"
+
+	if key == nil {
+		return nil, nil
+	}
+
+	balances, err := b.accountTransacter.IdempotentResponse(ctx, *key)
+	if errors.Is(err, storage.ErrIdempotencyKeyDoesNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(balances) != n {
+		return nil, fmt.Errorf("%s: %w: response of another operation", op, storage.ErrIdempotencyKeyMismatch)
+	}
+
+	return balances, nil
+}
+
+// Return the account if it exists and its lock lets the money move on it the way m.
+// This is a fast path only: the storage checks the lock again under the row lock
+func validateAccount(ctx context.Context, b *Bank, accountID int64, m movement) (models.Account, error) {
 	const op = "validateAccount"
 
 	log := b.log.With(slog.String("op", op))
@@ -200,10 +736,87 @@ func validateAccount(ctx context.Context, b *Bank, accountID int64) (models.Acco
 		return models.Account{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if account.IsLocked {
-		log.Error("account id is locked")
+	if m == debit && account.Lock.BlocksDebit() || m == credit && account.Lock.BlocksCredit() {
+		log.Error("account id is locked", slog.String("lock_type", account.Lock.Type))
 		return models.Account{}, fmt.Errorf("%s: %w", op, ErrAccountLocked)
 	}
 
 	return account, nil
 }
+
+// Return the account if the user may lock and unlock it: the bank staff any account, a user their own ones
+func lockableAccount(ctx context.Context, b *Bank, userID int64, byBank bool, accountID int64) (models.Account, error) {
+	const op = "lockableAccount"
+
+	account, err := b.accountModifier.Account(ctx, accountID)
+	if errors.Is(err, storage.ErrAccountDoesNotExist) {
+		return models.Account{}, fmt.Errorf("%s: %w", op, ErrAccountIDDoesNotExist)
+	}
+	if err != nil {
+		return models.Account{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !byBank {
+		err = validateOwner(ctx, b, userID, account)
+		if err != nil {
+			return models.Account{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return account, nil
+}
+
+// Return nil if the account belongs to the owner of the auth user.
+// Accounts opened before owners were bound to users belong to nobody
+func validateOwner(ctx context.Context, b *Bank, userID int64, account models.Account) error {
+	const op = "validateOwner"
+
+	owner, err := b.ownerModifier.Owner(ctx, userID)
+	if errors.Is(err, storage.ErrOwnerDoesNotExist) {
+		return fmt.Errorf("%s: %w", op, ErrNotAccountOwner)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if owner.ID != account.OwnerID {
+		return fmt.Errorf("%s: %w", op, ErrNotAccountOwner)
+	}
+
+	return nil
+}
+
+// Return nil if the amount can be credited to the account without overflowing its balance.
+// The storage refuses an overflow too, this only keeps such amounts away from it
+func validateCredit(account models.Account, amount int64) error {
+	const op = "validateCredit"
+
+	_, err := account.Money().Add(money.New(amount, account.Currency))
+	if err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrAmountOverflow, err)
+	}
+
+	return nil
+}
+
+// Records the outcome of a money-moving operation. The amount is in minor units of currency,
+// for a transfer the currency of the write off account
+func observe(operation, currency string, amount int64, err error) {
+	switch {
+	case err == nil:
+		metrics.Transactions.WithLabelValues(operation, metrics.StatusSuccess).Inc()
+		metrics.AmountMoved.WithLabelValues(operation, currency).Add(float64(amount))
+	case errors.Is(err, ErrAccountLocked):
+		metrics.Transactions.WithLabelValues(operation, metrics.StatusRejected).Inc()
+		metrics.LockedAccountRejections.WithLabelValues(operation).Inc()
+	case errors.Is(err, storage.ErrNotEnoughMoney):
+		metrics.Transactions.WithLabelValues(operation, metrics.StatusRejected).Inc()
+		metrics.InsufficientFunds.WithLabelValues(operation).Inc()
+	case errors.Is(err, ErrAccountIDDoesNotExist), errors.Is(err, ErrNotAccountOwner),
+		errors.Is(err, ErrNoFxRate), errors.Is(err, ErrTransferTooSmall),
+		errors.Is(err, ErrAmountOverflow), errors.Is(err, storage.ErrAmountOverflow):
+		metrics.Transactions.WithLabelValues(operation, metrics.StatusRejected).Inc()
+	default:
+		metrics.Transactions.WithLabelValues(operation, metrics.StatusFailed).Inc()
+	}
+}
@@ -0,0 +1,155 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ISO 20022 bank to customer statement, camt.053.001.02. Amounts are never negative,
+// the direction is CRDT or DBIT. Balances are OPBD (opening booked) and CLBD (closing booked)
+type camt053Renderer struct {
+	w        *xmlWriter
+	currency string
+}
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+const (
+	credit = "CRDT"
+	debit  = "DBIT"
+)
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	XMLName xml.Name   `xml:"Bal"`
+	Code    string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount  camtAmount `xml:"Amt"`
+	CdtDbt  string     `xml:"CdtDbtInd"`
+	Date    string     `xml:"Dt>DtTm"`
+}
+
+type camtAccount struct {
+	ID string `xml:"Id>Othr>Id"`
+}
+
+type camtEntry struct {
+	XMLName xml.Name       `xml:"Ntry"`
+	Ref     string         `xml:"NtryRef"`
+	Amount  camtAmount     `xml:"Amt"`
+	CdtDbt  string         `xml:"CdtDbtInd"`
+	Status  string         `xml:"Sts"`
+	Booking string         `xml:"BookgDt>DtTm"`
+	Code    string         `xml:"BkTxCd>Prtry>Cd"`
+	TxID    string         `xml:"NtryDtls>TxDtls>Refs>TxId"`
+	Parties *camtRltdPties `xml:"NtryDtls>TxDtls>RltdPties,omitempty"`
+}
+
+type camtRltdPties struct {
+	DebtorAccount   *camtAccount `xml:"DbtrAcct,omitempty"`
+	CreditorAccount *camtAccount `xml:"CdtrAcct,omitempty"`
+}
+
+func newCamt053(w io.Writer) *camt053Renderer {
+	return &camt053Renderer{w: newXMLWriter(w)}
+}
+
+func (r *camt053Renderer) Begin(h Header) error {
+	w := r.w
+	ccy := currency(h)
+	id := "STMT-" + strconv.FormatInt(h.AccountID, 10) + "-" + h.From.UTC().Format("20060102") + "-" + h.To.UTC().Format("20060102")
+
+	w.token(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)})
+	w.token(xml.CharData("\n"))
+	w.token(xml.StartElement{
+		Name: xml.Name{Local: "Document"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: camt053Namespace}},
+	})
+	w.start("BkToCstmrStmt", "GrpHdr")
+	w.element("MsgId", id)
+	w.element("CreDtTm", camtTime(h.GeneratedAt))
+	w.end("GrpHdr")
+
+	w.start("Stmt")
+	w.element("Id", id)
+	w.element("CreDtTm", camtTime(h.GeneratedAt))
+	w.start("FrToDt")
+	w.element("FrDtTm", camtTime(h.From))
+	w.element("ToDtTm", camtTime(h.To))
+	w.end("FrToDt")
+
+	w.start("Acct", "Id", "Othr")
+	w.element("Id", strconv.FormatInt(h.AccountID, 10))
+	w.end("Othr", "Id")
+	w.element("Ccy", ccy)
+	if h.Owner != "" {
+		w.start("Ownr")
+		w.element("Nm", h.Owner)
+		w.end("Ownr")
+	}
+	w.end("Acct")
+
+	w.encode(camtBalanceOf("OPBD", h.OpeningBalance, ccy, h.From))
+	w.encode(camtBalanceOf("CLBD", h.ClosingBalance, ccy, h.To))
+
+	r.currency = ccy
+
+	return w.err
+}
+
+func (r *camt053Renderer) Entry(e Entry) error {
+	entry := camtEntry{
+		Ref:     strconv.FormatInt(e.TransactionID, 10),
+		Amount:  camtAmount{Currency: r.currency, Value: formatAbs(e.Amount, r.currency)},
+		CdtDbt:  credit,
+		Status:  "BOOK",
+		Booking: camtTime(e.Date),
+		Code:    e.Type,
+		TxID:    strconv.FormatInt(e.TransactionID, 10),
+	}
+	if e.Amount < 0 {
+		entry.CdtDbt = debit
+	}
+
+	if e.CounterpartyAccountID != 0 {
+		counterparty := &camtAccount{ID: strconv.FormatInt(e.CounterpartyAccountID, 10)}
+		if entry.CdtDbt == credit {
+			entry.Parties = &camtRltdPties{DebtorAccount: counterparty}
+		} else {
+			entry.Parties = &camtRltdPties{CreditorAccount: counterparty}
+		}
+	}
+
+	r.w.encode(entry)
+
+	return r.w.err
+}
+
+func (r *camt053Renderer) End() error {
+	r.w.end("Stmt", "BkToCstmrStmt", "Document")
+
+	return r.w.flush()
+}
+
+func camtBalanceOf(code string, balance int64, ccy string, at time.Time) camtBalance {
+	b := camtBalance{
+		Code:   code,
+		Amount: camtAmount{Currency: ccy, Value: formatAbs(balance, ccy)},
+		CdtDbt: credit,
+		Date:   camtTime(at),
+	}
+	if balance < 0 {
+		b.CdtDbt = debit
+	}
+
+	return b
+}
+
+func camtTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
@@ -0,0 +1,66 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CSV statement: one row per entry between the opening and the closing balance rows
+//
+//	date,transaction_id,type,counterparty_account_id,amount,balance
+//	2024-07-01T00:00:00Z,,OpeningBalance,,,1000
+//	2024-07-03T10:15:00Z,42,Withdraw,,-200,800
+//	2024-08-01T00:00:00Z,,ClosingBalance,,,800
+type csvRenderer struct {
+	w      *csv.Writer
+	header Header
+}
+
+var csvColumns = []string{"date", "transaction_id", "type", "counterparty_account_id", "amount", "balance"}
+
+func newCSV(w io.Writer) *csvRenderer {
+	return &csvRenderer{w: csv.NewWriter(w)}
+}
+
+func (r *csvRenderer) Begin(h Header) error {
+	r.header = h
+
+	if err := r.w.Write(csvColumns); err != nil {
+		return err
+	}
+
+	return r.w.Write([]string{csvTime(h.From), "", "OpeningBalance", "", "", formatAmount(h.OpeningBalance, currency(h))})
+}
+
+func (r *csvRenderer) Entry(e Entry) error {
+	var counterparty string
+	if e.CounterpartyAccountID != 0 {
+		counterparty = strconv.FormatInt(e.CounterpartyAccountID, 10)
+	}
+
+	return r.w.Write([]string{
+		csvTime(e.Date),
+		strconv.FormatInt(e.TransactionID, 10),
+		e.Type,
+		counterparty,
+		formatAmount(e.Amount, currency(r.header)),
+		formatAmount(e.Balance, currency(r.header)),
+	})
+}
+
+func (r *csvRenderer) End() error {
+	err := r.w.Write([]string{csvTime(r.header.To), "", "ClosingBalance", "", "", formatAmount(r.header.ClosingBalance, currency(r.header))})
+	if err != nil {
+		return err
+	}
+
+	r.w.Flush()
+
+	return r.w.Error()
+}
+
+func csvTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
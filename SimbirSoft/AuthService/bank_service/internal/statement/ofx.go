@@ -0,0 +1,114 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// OFX 2.2 bank statement response. OFX has no opening balance, the closing one is LEDGERBAL
+type ofxRenderer struct {
+	w      *xmlWriter
+	header Header
+}
+
+const (
+	ofxBankID      = "bank_service"
+	ofxAccountType = "CHECKING"
+	ofxTimeLayout  = "20060102150405"
+)
+
+type ofxTransaction struct {
+	XMLName xml.Name `xml:"STMTTRN"`
+	Type    string   `xml:"TRNTYPE"`
+	Posted  string   `xml:"DTPOSTED"`
+	Amount  string   `xml:"TRNAMT"`
+	FITID   string   `xml:"FITID"`
+	Name    string   `xml:"NAME,omitempty"`
+	Memo    string   `xml:"MEMO"`
+}
+
+type ofxStatus struct {
+	XMLName  xml.Name `xml:"STATUS"`
+	Code     int      `xml:"CODE"`
+	Severity string   `xml:"SEVERITY"`
+}
+
+type ofxAccount struct {
+	XMLName xml.Name `xml:"BANKACCTFROM"`
+	BankID  string   `xml:"BANKID"`
+	AcctID  string   `xml:"ACCTID"`
+	Type    string   `xml:"ACCTTYPE"`
+}
+
+type ofxBalance struct {
+	XMLName xml.Name `xml:"LEDGERBAL"`
+	Amount  string   `xml:"BALAMT"`
+	AsOf    string   `xml:"DTASOF"`
+}
+
+func newOFX(w io.Writer) *ofxRenderer {
+	return &ofxRenderer{w: newXMLWriter(w)}
+}
+
+func (r *ofxRenderer) Begin(h Header) error {
+	r.header = h
+	w := r.w
+
+	w.token(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8" standalone="no"`)})
+	w.token(xml.ProcInst{Target: "OFX", Inst: []byte(`OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"`)})
+	w.token(xml.CharData("\n"))
+
+	w.start("OFX", "SIGNONMSGSRSV1", "SONRS")
+	w.encode(ofxStatus{Code: 0, Severity: "INFO"})
+	w.element("DTSERVER", ofxTime(h.GeneratedAt))
+	w.element("LANGUAGE", "ENG")
+	w.end("SONRS", "SIGNONMSGSRSV1")
+
+	w.start("BANKMSGSRSV1", "STMTTRNRS")
+	w.element("TRNUID", strconv.FormatInt(h.GeneratedAt.Unix(), 10))
+	w.encode(ofxStatus{Code: 0, Severity: "INFO"})
+	w.start("STMTRS")
+	w.element("CURDEF", currency(h))
+	w.encode(ofxAccount{BankID: ofxBankID, AcctID: strconv.FormatInt(h.AccountID, 10), Type: ofxAccountType})
+
+	w.start("BANKTRANLIST")
+	w.element("DTSTART", ofxTime(h.From))
+	w.element("DTEND", ofxTime(h.To))
+
+	return w.err
+}
+
+func (r *ofxRenderer) Entry(e Entry) error {
+	t := ofxTransaction{
+		Type:   "CREDIT",
+		Posted: ofxTime(e.Date),
+		Amount: formatAmount(e.Amount, currency(r.header)),
+		FITID:  strconv.FormatInt(e.TransactionID, 10),
+		Memo:   e.Type,
+	}
+	if e.Amount < 0 {
+		t.Type = "DEBIT"
+	}
+	if e.CounterpartyAccountID != 0 {
+		t.Type = "XFER"
+		t.Name = "Account " + strconv.FormatInt(e.CounterpartyAccountID, 10)
+	}
+
+	r.w.encode(t)
+
+	return r.w.err
+}
+
+func (r *ofxRenderer) End() error {
+	r.w.end("BANKTRANLIST")
+	r.w.encode(ofxBalance{Amount: formatAmount(r.header.ClosingBalance, currency(r.header)), AsOf: ofxTime(r.header.To)})
+	r.w.end("STMTRS", "STMTTRNRS", "BANKMSGSRSV1", "OFX")
+
+	return r.w.flush()
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format(ofxTimeLayout) + "[0:GMT]"
+}
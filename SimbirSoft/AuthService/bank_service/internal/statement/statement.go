@@ -0,0 +1,96 @@
+// Package statement renders account statements: the opening balance, the entries of
+// the period and the closing balance, in CSV, OFX or ISO 20022 camt.053.
+//
+// Renderers write as entries come, so a statement of any length is never held in memory.
+// A statement that failed halfway is left unfinished and must be thrown away.
+package statement
+
+import (
+	"bank_service/internal/domain/models/money"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatOFX     = "ofx"
+	FormatCamt053 = "camt053"
+)
+
+// ISO 4217 code for transactions without a currency
+const noCurrency = "XXX"
+
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+type Header struct {
+	AccountID      int64
+	Owner          string
+	Currency       string // ISO 4217, XXX if empty
+	From           time.Time
+	To             time.Time // exclusive
+	OpeningBalance int64
+	ClosingBalance int64
+	GeneratedAt    time.Time
+}
+
+type Entry struct {
+	TransactionID         int64
+	Date                  time.Time
+	Type                  string // TopUp, Withdraw or Transfer
+	Amount                int64  // minor units, positive credits the account, negative debits it
+	CounterpartyAccountID int64  // other account of a transfer, 0 otherwise
+	Balance               int64  // balance after the entry
+}
+
+type Renderer interface {
+	Begin(h Header) error
+	Entry(e Entry) error
+	// End completes the statement, it is called only after the statement reconciled
+	End() error
+}
+
+func New(format string, w io.Writer) (Renderer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSV(w), nil
+	case FormatOFX:
+		return newOFX(w), nil
+	case FormatCamt053:
+		return newCamt053(w), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// Extension of the file of the format, e.g. for the CLI
+func Extension(format string) string {
+	switch format {
+	case FormatOFX:
+		return ".ofx"
+	case FormatCamt053:
+		return ".xml"
+	}
+
+	return ".csv"
+}
+
+func currency(h Header) string {
+	if h.Currency == "" {
+		return noCurrency
+	}
+
+	return h.Currency
+}
+
+// Amounts are kept in minor units, statements show them in major ones, e.g. 12345 RUB is 123.45
+func formatAmount(amount int64, ccy string) string {
+	return money.FormatMinor(amount, ccy)
+}
+
+// Unsigned amount for the formats with a separate credit/debit indicator
+func formatAbs(amount int64, ccy string) string {
+	return strings.TrimPrefix(formatAmount(amount, ccy), "-")
+}
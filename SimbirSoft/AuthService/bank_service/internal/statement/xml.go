@@ -0,0 +1,60 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xmlWriter streams an XML document and remembers the first error, so a document
+// is written without checking every element
+type xmlWriter struct {
+	enc *xml.Encoder
+	err error
+}
+
+func newXMLWriter(w io.Writer) *xmlWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return &xmlWriter{enc: enc}
+}
+
+func (w *xmlWriter) token(t xml.Token) {
+	if w.err == nil {
+		w.err = w.enc.EncodeToken(t)
+	}
+}
+
+// start opens the elements from the outermost
+func (w *xmlWriter) start(names ...string) {
+	for _, name := range names {
+		w.token(xml.StartElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// end closes the elements from the innermost
+func (w *xmlWriter) end(names ...string) {
+	for _, name := range names {
+		w.token(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (w *xmlWriter) element(name, value string, attrs ...xml.Attr) {
+	if w.err == nil {
+		w.err = w.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs})
+	}
+}
+
+func (w *xmlWriter) encode(v any) {
+	if w.err == nil {
+		w.err = w.enc.Encode(v)
+	}
+}
+
+func (w *xmlWriter) flush() error {
+	if w.err == nil {
+		w.err = w.enc.Flush()
+	}
+
+	return w.err
+}
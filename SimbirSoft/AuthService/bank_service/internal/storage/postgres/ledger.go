@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Kinds of the system accounts, one of each kind per currency
+const (
+	kindCashIn  = "cash_in"  // money coming into the bank: top ups and opening balances
+	kindCashOut = "cash_out" // money leaving the bank: withdrawals
+	kindFx      = "fx"       // position of the bank in transfers between currencies
+)
+
+const (
+	qrSystemAccount       = `SELECT id FROM account WHERE kind = $1 AND currency = $2;`
+	qrCreateSystemAccount = `INSERT INTO account(kind, currency) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+	qrCreateJournalEntry  = `INSERT INTO journal_entries(transaction_id, created_at) VALUES ($1, CURRENT_TIMESTAMP) RETURNING id;`
+	qrCreatePosting       = `INSERT INTO postings(entry_id, account_id, amount) VALUES ($1, $2, $3);`
+)
+
+// Movement of money on an account in its currency: positive credits it, negative debits it
+type posting struct {
+	accountID int64
+	amount    int64
+}
+
+// Records a journal entry of the postings, transactionID is nil for an opening balance.
+// The balances of customer accounts follow the postings. The database refuses to commit
+// an entry which does not sum to zero in each currency
+func postEntry(ctx context.Context, tx *sql.Tx, transactionID any, postings ...posting) error {
+	var entryID int64
+
+	err := tx.QueryRowContext(ctx, qrCreateJournalEntry, transactionID).Scan(&entryID)
+	if err != nil {
+		return fmt.Errorf("journal entry: %w", err)
+	}
+
+	for _, p := range postings {
+		_, err = tx.ExecContext(ctx, qrCreatePosting, entryID, p.accountID, p.amount)
+		if err != nil {
+			return fmt.Errorf("posting to %d: %w", p.accountID, overflowErr(err))
+		}
+	}
+
+	return nil
+}
+
+// Creates the system accounts of every kind in the currency unless they exist. It runs outside
+// the transactions that move money: each insert commits on its own and a concurrent one waits
+// for the other and does nothing, while inside a repeatable read or serializable transaction
+// it would abort with a serialization error
+func createSystemAccounts(ctx context.Context, db *sql.DB, currency string) error {
+	for _, kind := range []string{kindCashIn, kindCashOut, kindFx} {
+		_, err := db.ExecContext(ctx, qrCreateSystemAccount, kind, currency)
+		if err != nil {
+			return fmt.Errorf("%s account in %s: %w", kind, currency, err)
+		}
+	}
+
+	return nil
+}
+
+// Returning the system account of the kind in the currency. They are created with the first
+// account in the currency, or by the migration for the currencies of older accounts
+func systemAccount(ctx context.Context, tx *sql.Tx, kind, currency string) (int64, error) {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, qrSystemAccount, kind, currency).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("no %s account in %s", kind, currency)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s account in %s: %w", kind, currency, err)
+	}
+
+	return id, nil
+}
@@ -6,33 +6,136 @@ import (
 	"bank_service/internal/storage"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	qrCreateOwner      = `INSERT INTO owner(full_name, citizenship) VALUES ($1, $2) RETURNING id;`
-	qrOwner            = `SELECT * FROM owner WHERE full_name = $1;`
-	qrCreateAccount    = `INSERT INTO account(owner_id, balance) VALUES ($1, $2) RETURNING id;`
-	qrAccount          = `SELECT * FROM account WHERE id = $1;`
-	qrAccountLock      = `UPDATE account SET is_locked = TRUE WHERE id = $1;`
-	qrAccountTopUp     = `UPDATE account SET balance = balance + $1 WHERE id = $2;`
-	qrAccountBalance   = `SELECT balance FROM account WHERE id = $1 FOR UPDATE;`
-	qrAccountWithdraw  = `UPDATE account SET balance = balance - $1 WHERE id = $2;`
-	qrCeateTransaction = `INSERT INTO transaction(account_id, participating_account_id, transaction_type, amount, date)
-						  VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP);`
-	qrTransaction = `SELECT * FROM transaction WHERE account_id = $1;`
+	qrCreateOwner   = `INSERT INTO owner(user_id, full_name, citizenship) VALUES ($1, $2, $3) RETURNING id;`
+	qrOwner         = `SELECT id, user_id, full_name, citizenship FROM owner WHERE user_id = $1;`
+	qrCreateAccount = `INSERT INTO account(owner_id, currency) VALUES ($1, $2) RETURNING id;`
+	// System accounts of the ledger are not visible as accounts
+	qrAccount       = `SELECT ` + accountColumns + ` FROM account WHERE id = $1 AND kind = 'customer';`
+	qrOwnerAccounts = `SELECT ` + accountColumns + ` FROM account
+						  WHERE owner_id = $1 AND id > $2 AND ($3::bool IS NULL OR is_locked = $3)
+						  ORDER BY id LIMIT $4;`
+	// A lock is placed on an unlocked account only, the change and its history are written by one statement
+	qrAccountLock = `WITH locked AS (
+						UPDATE account SET lock_type = $2, lock_reason = $3, lock_note = $4, locked_by = $5,
+							locked_by_bank = $6, locked_at = CURRENT_TIMESTAMP
+						WHERE id = $1 AND kind = 'customer' AND lock_type IS NULL
+						RETURNING id, lock_type, lock_reason, lock_note, locked_by, locked_by_bank, locked_at)
+					 INSERT INTO account_lock_history(account_id, action, lock_type, reason, note, actor_id, by_bank, created_at)
+					 SELECT id, 'lock', lock_type, lock_reason, lock_note, locked_by, locked_by_bank, locked_at FROM locked;`
+	// The history keeps the type and the reason of the lifted lock
+	qrAccountUnlock = `WITH lifted AS (
+						SELECT id, lock_type, lock_reason FROM account
+						WHERE id = $1 AND kind = 'customer' AND lock_type IS NOT NULL FOR UPDATE),
+					 unlocked AS (
+						UPDATE account SET lock_type = NULL, lock_reason = NULL, lock_note = NULL, locked_by = NULL,
+							locked_by_bank = NULL, locked_at = NULL
+						FROM lifted WHERE account.id = lifted.id)
+					 INSERT INTO account_lock_history(account_id, action, lock_type, reason, note, actor_id, by_bank)
+					 SELECT id, 'unlock', lock_type, lock_reason, $2::text, $3::bigint, $4::bool FROM lifted;`
+	// The lock type is read under the row lock: a lock placed after the check of the service still stops the money
+	qrAccountBalance = `SELECT balance, currency, lock_type FROM account WHERE id = $1 FOR UPDATE;`
+	// Rows are locked in the order of the sort, so concurrent transfers take the locks in the same order
+	qrLockAccounts     = `SELECT id, balance, currency, lock_type FROM account WHERE id = ANY($1) AND kind = 'customer' ORDER BY id FOR UPDATE;`
+	qrCeateTransaction = `INSERT INTO transaction(account_id, participating_account_id, transaction_type, amount,
+							participating_amount, fx_rate, date)
+						  VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP) RETURNING id;`
+	// Outgoing and incoming parts are merged so that each of them uses its index.
+	// A transfer to the same account is taken once
+	qrAccountTransactions = `SELECT ` + transactionColumns + ` FROM (
+							  (SELECT * FROM transaction WHERE account_id = $1 AND ` + transactionFilter + `
+							   AND ($5::bigint IS NULL OR amount >= $5) AND ($6::bigint IS NULL OR amount <= $6)
+							   ORDER BY date DESC, id DESC LIMIT $9)
+							  UNION ALL
+							  (SELECT * FROM transaction WHERE participating_account_id = $1 AND account_id <> $1 AND ` + transactionFilter + `
+							   AND ($5::bigint IS NULL OR COALESCE(participating_amount, amount) >= $5)
+							   AND ($6::bigint IS NULL OR COALESCE(participating_amount, amount) <= $6)
+							   ORDER BY date DESC, id DESC LIMIT $9)
+							 ) AS t ORDER BY date DESC, id DESC LIMIT $9;`
+	qrBalance               = `SELECT balance FROM account WHERE id = $1;`
+	qrStatementTransactions = `SELECT ` + transactionColumns + ` FROM transaction
+							   WHERE (account_id = $1 OR participating_account_id = $1) AND date >= $2 AND date < $3
+							   ORDER BY date, id;`
+	// Sum of the transactions of qrStatementTransactions taken the same as transaction.Transaction.Net
+	qrStatementNet = `SELECT COALESCE(SUM(CASE
+							WHEN transaction_type::int = 1 THEN amount
+							WHEN transaction_type::int = 2 THEN -amount
+							WHEN account_id = participating_account_id THEN 0
+							WHEN account_id = $1 THEN -amount
+							ELSE COALESCE(participating_amount, amount) END), 0)
+					  FROM transaction WHERE (account_id = $1 OR participating_account_id = $1) AND date >= $2 AND date < $3;`
+	// Balance of the account at the date by the ledger, not by the transaction log. An opening entry
+	// counts from the start: the entries of the migration to the ledger stand for the transactions
+	// made before it. Such transactions have no postings and are taken back the same as
+	// transaction.Transaction.Net: 1 is TopUp, 2 is Withdraw, 3 is Transfer. The beneficiary gets
+	// the converted amount
+	qrLedgerBalanceAt = `SELECT COALESCE((SELECT SUM(p.amount) FROM postings p JOIN journal_entries je ON je.id = p.entry_id
+								WHERE p.account_id = $1 AND (je.transaction_id IS NULL OR je.created_at < $2)), 0)
+							- COALESCE((SELECT SUM(CASE
+								WHEN transaction_type::int = 1 THEN amount
+								WHEN transaction_type::int = 2 THEN -amount
+								WHEN account_id = participating_account_id THEN 0
+								WHEN account_id = $1 THEN -amount
+								ELSE COALESCE(participating_amount, amount) END)
+							FROM transaction t WHERE (account_id = $1 OR participating_account_id = $1) AND date >= $2
+								AND NOT EXISTS (SELECT 1 FROM journal_entries je WHERE je.transaction_id = t.id)), 0);`
+	transactionFilter = `($2::int[] IS NULL OR transaction_type::int = ANY($2))
+						  AND ($3::timestamp IS NULL OR date >= $3) AND ($4::timestamp IS NULL OR date < $4)
+						  AND ($7::timestamp IS NULL OR (date, id) < ($7, $8::int))`
+	transactionColumns = `id, account_id, participating_account_id, transaction_type, amount,
+						  participating_amount, trim_scale(fx_rate)::text, date`
+	accountColumns = `id, balance, currency, owner_id, is_locked,
+						  lock_type, lock_reason, lock_note, locked_by, locked_by_bank, locked_at, created_at`
+	// The rate of the pair in either direction, the direct one if both are set
+	qrFxRate = `SELECT base, quote, trim_scale(rate)::text, updated_at FROM fx_rates
+				WHERE (base = $1 AND quote = $2) OR (base = $2 AND quote = $1)
+				ORDER BY base = $1 DESC LIMIT 1;`
+	// Expired keys of the user are deleted before a new one is claimed, a live key is left as is
+	qrDeleteExpiredIdempotencyKeys = `DELETE FROM idempotency_keys
+									  WHERE user_id = $1 AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $2);`
+	qrClaimIdempotencyKey = `INSERT INTO idempotency_keys(user_id, key, fingerprint, created_at)
+							 VALUES ($1, $2, $3, CURRENT_TIMESTAMP) ON CONFLICT (user_id, key) DO NOTHING;`
+	qrIdempotencyKey = `SELECT fingerprint, response FROM idempotency_keys
+						WHERE user_id = $1 AND key = $2 AND created_at >= CURRENT_TIMESTAMP - make_interval(secs => $3);`
+	qrSetIdempotentResponse = `UPDATE idempotency_keys SET response = $3 WHERE user_id = $1 AND key = $2;`
+	qrSetFxRate             = `INSERT INTO fx_rates(base, quote, rate, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+				   ON CONFLICT (base, quote) DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at;`
 )
 
+var tracer = otel.Tracer("bank_service/internal/storage/postgres")
+
 type Storage struct {
-	db *sql.DB
+	db        *sql.DB
+	isolation sql.IsolationLevel
+	txRetries int
 }
 
-func New(storageDriver, storageInfo string) (*Storage, error) {
+// Isolation is the level of the money transfers: "read_committed", "repeatable_read" or "serializable".
+// A transfer failed on a serialization error or a deadlock is run again up to txRetries times
+func New(storageDriver, storageInfo, isolation string, txRetries int) (*Storage, error) {
 	const op = "storage.postgres.New"
 
+	level, ok := isolationLevels[isolation]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown isolation level %q", op, isolation)
+	}
+
+	if txRetries < 0 {
+		return nil, fmt.Errorf("%s: negative number of transaction retries", op)
+	}
+
 	db, err := sql.Open(storageDriver, storageInfo)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -43,7 +146,7 @@ func New(storageDriver, storageInfo string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, isolation: level, txRetries: txRetries}, nil
 }
 
 func (s *Storage) Stop() error {
@@ -83,29 +186,22 @@ func (s *Storage) MigrationDown(storageURL, migrationPath string) error {
 }
 
 // Returning created owner and error
-func (s *Storage) CreateOwner(ctx context.Context, fullName, citizenship string) (models.Owner, error) {
+func (s *Storage) CreateOwner(ctx context.Context, userID int64, fullName, citizenship string) (models.Owner, error) {
 	const op = "storage.postgres.CreateOwner"
 
-	var owner models.Owner
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return models.Owner{}, fmt.Errorf("%s: %w", op, err)
-	}
+	var owner models.Owner
 
-	err = tx.QueryRowContext(ctx, qrCreateOwner, fullName, citizenship).Scan(&owner.ID)
-	if err != nil {
-		tx.Rollback()
-		return models.Owner{}, fmt.Errorf("%s: %w", op, err)
-	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, qrCreateOwner, userID, fullName, citizenship).Scan(&owner.ID)
+		if err != nil {
+			return err
+		}
 
-	err = tx.QueryRowContext(ctx, qrOwner, fullName).Scan(&owner.ID, &owner.FullName, &owner.Citizenship)
-	if err != nil {
-		tx.Rollback()
-		return models.Owner{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	err = tx.Commit()
+		return tx.QueryRowContext(ctx, qrOwner, userID).Scan(&owner.ID, &owner.UserID, &owner.FullName, &owner.Citizenship)
+	})
 	if err != nil {
 		return models.Owner{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -113,12 +209,16 @@ func (s *Storage) CreateOwner(ctx context.Context, fullName, citizenship string)
 	return owner, nil
 }
 
-func (s *Storage) Owner(ctx context.Context, fullName string) (models.Owner, error) {
+// Returning owner of the auth user and error
+func (s *Storage) Owner(ctx context.Context, userID int64) (models.Owner, error) {
 	const op = "storage.postgres.Owner"
 
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
 	var owner models.Owner
 
-	err := s.db.QueryRowContext(ctx, qrOwner, fullName).Scan(&owner.ID, &owner.FullName, &owner.Citizenship)
+	err := s.db.QueryRowContext(ctx, qrOwner, userID).Scan(&owner.ID, &owner.UserID, &owner.FullName, &owner.Citizenship)
 	if err != nil {
 		return models.Owner{}, fmt.Errorf("%s: %w", op, storage.ErrOwnerDoesNotExist)
 	}
@@ -126,30 +226,44 @@ func (s *Storage) Owner(ctx context.Context, fullName string) (models.Owner, err
 	return owner, nil
 }
 
-// Returning created account ID, balance and error
-func (s *Storage) CreateAccount(ctx context.Context, ownerID, balance int64) (models.Account, error) {
+// Returning created account and error.
+// The opening balance comes from the cash in account of the currency
+func (s *Storage) CreateAccount(ctx context.Context, ownerID, balance int64, currency string) (models.Account, error) {
 	const op = "storage.postgres.CreateAccount"
 
-	var account models.Account
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
 
-	tx, err := s.db.Begin()
+	err := createSystemAccounts(ctx, s.db, currency)
 	if err != nil {
 		return models.Account{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRowContext(ctx, qrCreateAccount, ownerID, balance).Scan(&account.ID)
-	if err != nil {
-		tx.Rollback()
-		return models.Account{}, fmt.Errorf("%s: %w", op, err)
-	}
+	var account models.Account
 
-	err = tx.QueryRowContext(ctx, qrAccount, account.ID).Scan(&account.ID, &account.Balance, &account.OwnerID, &account.IsLocked)
-	if err != nil {
-		tx.Rollback()
-		return models.Account{}, fmt.Errorf("%s: %w", op, err)
-	}
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		var id int64
 
-	err = tx.Commit()
+		err := tx.QueryRowContext(ctx, qrCreateAccount, ownerID, currency).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		if balance > 0 {
+			cashIn, err := systemAccount(ctx, tx, kindCashIn, currency)
+			if err != nil {
+				return err
+			}
+
+			err = postEntry(ctx, tx, nil, posting{id, balance}, posting{cashIn, -balance})
+			if err != nil {
+				return err
+			}
+		}
+
+		account, err = scanAccount(tx.QueryRowContext(ctx, qrAccount, id))
+		return err
+	})
 	if err != nil {
 		return models.Account{}, fmt.Errorf("%s: %w", op, err)
 	}
@@ -160,9 +274,10 @@ func (s *Storage) CreateAccount(ctx context.Context, ownerID, balance int64) (mo
 func (s *Storage) Account(ctx context.Context, id int64) (models.Account, error) {
 	const op = "storage.postgres.Account"
 
-	var account models.Account
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
 
-	err := s.db.QueryRowContext(ctx, qrAccount, id).Scan(&account.ID, &account.Balance, &account.OwnerID, &account.IsLocked)
+	account, err := scanAccount(s.db.QueryRowContext(ctx, qrAccount, id))
 	if err != nil {
 		return models.Account{}, fmt.Errorf("%s: %w", op, storage.ErrAccountDoesNotExist)
 	}
@@ -170,156 +285,684 @@ func (s *Storage) Account(ctx context.Context, id int64) (models.Account, error)
 	return account, nil
 }
 
-func (s *Storage) AccountLock(ctx context.Context, id int64) error {
+// Returning up to limit accounts of the owner with ID greater than afterID, ordered by ID.
+// isLocked filters by the lock status, nil means any
+func (s *Storage) OwnerAccounts(ctx context.Context, ownerID, afterID int64, isLocked *bool, limit int) ([]models.Account, error) {
+	const op = "storage.postgres.OwnerAccounts"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	rows, err := s.db.QueryContext(ctx, qrOwnerAccounts, ownerID, afterID, isLocked, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var accounts []models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return accounts, nil
+}
+
+// Placing the lock on the account and recording it in the lock history, lock.LockedAt is ignored
+func (s *Storage) AccountLock(ctx context.Context, id int64, lock models.AccountLock) error {
 	const op = "storage.postgres.AccountLock"
 
-	_, err := s.db.ExecContext(ctx, qrAccountLock, id)
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, qrAccountLock, id, lock.Type, lock.Reason, lock.Note, lock.LockedBy, lock.ByBank)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	locked, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if locked == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAccountLocked)
+	}
+
 	return nil
 }
 
-// Returning updated account balance and error
-func (s *Storage) AccountTopUp(ctx context.Context, accountID, amount int64) (int64, error) {
+// Lifting the lock of the account and recording it in the lock history with the note of the user
+func (s *Storage) AccountUnlock(ctx context.Context, id, userID int64, byBank bool, note string) error {
+	const op = "storage.postgres.AccountUnlock"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	res, err := s.db.ExecContext(ctx, qrAccountUnlock, id, note, userID, byBank)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	unlocked, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if unlocked == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrAccountNotLocked)
+	}
+
+	return nil
+}
+
+// Returning updated account balance and error. The money comes from the cash in account.
+// ErrAccountLocked if the lock of the account blocks credits.
+// With a key the balance is stored with it, a replay of the key returns the stored balance
+func (s *Storage) AccountTopUp(ctx context.Context, accountID, amount int64, key *models.IdempotencyKey) (int64, error) {
 	const op = "storage.postgres.AccountTopUp"
 
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
 	var balance int64
 
-	tx, err := s.db.Begin()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		replayed, err := claimIdempotencyKey(ctx, tx, key, 1)
+		if err != nil {
+			return err
+		}
+		if replayed != nil {
+			balance = replayed[0]
+			return nil
+		}
+
+		var (
+			currency string
+			lockType sql.NullString
+		)
+
+		err = tx.QueryRowContext(ctx, qrAccountBalance, accountID).Scan(&balance, &currency, &lockType)
+		if err != nil {
+			return err
+		}
+
+		if accountLock(lockType).BlocksCredit() {
+			return storage.ErrAccountLocked
+		}
+
+		cashIn, err := systemAccount(ctx, tx, kindCashIn, currency)
+		if err != nil {
+			return err
+		}
+
+		var transactionID int64
+		err = tx.QueryRowContext(ctx, qrCeateTransaction, accountID, nil, transaction.TopUp, amount, nil, nil).Scan(&transactionID)
+		if err != nil {
+			return err
+		}
+
+		err = postEntry(ctx, tx, transactionID, posting{accountID, amount}, posting{cashIn, -amount})
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, qrBalance, accountID).Scan(&balance)
+		if err != nil {
+			return err
+		}
+
+		return setIdempotentResponse(ctx, tx, key, balance)
+	})
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = tx.ExecContext(ctx, qrAccountTopUp, amount, accountID)
+	return balance, nil
+}
+
+// Returning updated account balance and error. The money goes to the cash out account.
+// ErrAccountLocked if the lock of the account blocks debits.
+// With a key the balance is stored with it, a replay of the key returns the stored balance
+func (s *Storage) AccountWithdraw(ctx context.Context, accountID, amount int64, key *models.IdempotencyKey) (int64, error) {
+	const op = "storage.postgres.AccountWithdraw"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	var balance int64
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		replayed, err := claimIdempotencyKey(ctx, tx, key, 1)
+		if err != nil {
+			return err
+		}
+		if replayed != nil {
+			balance = replayed[0]
+			return nil
+		}
+
+		var (
+			currency string
+			lockType sql.NullString
+		)
+
+		err = tx.QueryRowContext(ctx, qrAccountBalance, accountID).Scan(&balance, &currency, &lockType)
+		if err != nil {
+			return err
+		}
+
+		if accountLock(lockType).BlocksDebit() {
+			return storage.ErrAccountLocked
+		}
+
+		if amount > balance {
+			return storage.ErrNotEnoughMoney
+		}
+
+		cashOut, err := systemAccount(ctx, tx, kindCashOut, currency)
+		if err != nil {
+			return err
+		}
+
+		var transactionID int64
+		err = tx.QueryRowContext(ctx, qrCeateTransaction, accountID, nil, transaction.Withdraw, amount, nil, nil).Scan(&transactionID)
+		if err != nil {
+			return err
+		}
+
+		err = postEntry(ctx, tx, transactionID, posting{accountID, -amount}, posting{cashOut, amount})
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, qrBalance, accountID).Scan(&balance)
+		if err != nil {
+			return err
+		}
+
+		return setIdempotentResponse(ctx, tx, key, balance)
+	})
 	if err != nil {
-		tx.Rollback()
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, accountID).Scan(&balance)
+	return balance, nil
+}
+
+// Returning updated wtite off and beneficiary accounts balances and error.
+// The beneficiary gets beneficiaryAmount, rate is empty unless the accounts are in different currencies:
+// then the money goes through the fx accounts of both currencies.
+// ErrAccountLocked if a lock blocks debits of the write off account or credits of the beneficiary.
+// With a key the balances are stored with it, a replay of the key returns the stored balances.
+// Both accounts are locked at once in the order of their ids, so opposite transfers do not deadlock
+func (s *Storage) AccountTransfer(
+	ctx context.Context,
+	writeOfAccountID, beneficiaryAccountID, amount, beneficiaryAmount int64,
+	rate string,
+	key *models.IdempotencyKey,
+) (int64, int64, error) {
+	const op = "storage.postgres.AccountTransfer"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	var writeOffBalance, beneficiaryBalance int64
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		replayed, err := claimIdempotencyKey(ctx, tx, key, 2)
+		if err != nil {
+			return err
+		}
+		if replayed != nil {
+			writeOffBalance, beneficiaryBalance = replayed[0], replayed[1]
+			return nil
+		}
+
+		accounts, err := lockAccounts(ctx, tx, writeOfAccountID, beneficiaryAccountID)
+		if err != nil {
+			return err
+		}
+		writeOff, beneficiary := accounts[writeOfAccountID], accounts[beneficiaryAccountID]
+
+		if writeOff.Lock.BlocksDebit() {
+			return fmt.Errorf("write off %w", storage.ErrAccountLocked)
+		}
+		if beneficiary.Lock.BlocksCredit() {
+			return fmt.Errorf("beneficiary %w", storage.ErrAccountLocked)
+		}
+
+		if amount > writeOff.Balance {
+			return storage.ErrNotEnoughMoney
+		}
+
+		postings := []posting{{writeOfAccountID, -amount}, {beneficiaryAccountID, beneficiaryAmount}}
+		if writeOff.Currency != beneficiary.Currency {
+			fxFrom, err := systemAccount(ctx, tx, kindFx, writeOff.Currency)
+			if err != nil {
+				return err
+			}
+
+			fxTo, err := systemAccount(ctx, tx, kindFx, beneficiary.Currency)
+			if err != nil {
+				return err
+			}
+
+			postings = append(postings, posting{fxFrom, amount}, posting{fxTo, -beneficiaryAmount})
+		}
+
+		var participatingAmount, fxRate any
+		if rate != "" {
+			participatingAmount, fxRate = beneficiaryAmount, rate
+		}
+
+		var transactionID int64
+		err = tx.QueryRowContext(ctx, qrCeateTransaction, writeOfAccountID, beneficiaryAccountID, transaction.Transfer, amount, participatingAmount, fxRate).Scan(&transactionID)
+		if err != nil {
+			return err
+		}
+
+		err = postEntry(ctx, tx, transactionID, postings...)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, qrBalance, writeOfAccountID).Scan(&writeOffBalance)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, qrBalance, beneficiaryAccountID).Scan(&beneficiaryBalance)
+		if err != nil {
+			return err
+		}
+
+		return setIdempotentResponse(ctx, tx, key, writeOffBalance, beneficiaryBalance)
+	})
 	if err != nil {
-		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return writeOffBalance, beneficiaryBalance, nil
+}
+
+// Returning up to limit transactions of the account matching the filter, newest first.
+// Incoming transfers are included
+func (s *Storage) AccountTransactions(ctx context.Context, accountID int64, filter transaction.Filter, limit int) ([]transaction.Transaction, error) {
+	const op = "storage.postgres.AccountTransactions"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	var types pq.Int64Array
+	for _, t := range filter.Types {
+		types = append(types, int64(t))
 	}
 
-	_, err = tx.ExecContext(ctx, qrCeateTransaction, accountID, nil, transaction.TopUp, amount)
+	var beforeID any
+	if !filter.BeforeDate.IsZero() {
+		beforeID = filter.BeforeID
+	}
+
+	rows, err := s.db.QueryContext(ctx, qrAccountTransactions,
+		accountID,
+		types,
+		nullTime(filter.From),
+		nullTime(filter.To),
+		nullAmount(filter.MinAmount),
+		nullAmount(filter.MaxAmount),
+		nullTime(filter.BeforeDate),
+		beforeID,
+		limit,
+	)
 	if err != nil {
-		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer rows.Close()
 
-	err = tx.Commit()
+	var transactions []transaction.Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	err = rows.Err()
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return balance, nil
+	return transactions, nil
 }
 
-// Returning updated account balance and error
-func (s *Storage) AccountWithdraw(ctx context.Context, accountID, amount int64) (int64, error) {
-	const op = "storage.postgres.AccountWithdraw"
+// Reads the statement of the account for [from, to) from one snapshot. The balances at from and to
+// come from the ledger postings and the entries from the transaction log, begin gets the balances
+// and the sum of the entries before entry is called for each transaction of the period, oldest
+// first. The caller reconciles the sum with the balances before any entry is read, so a transaction
+// without its postings or the other way round does not go unnoticed
+func (s *Storage) AccountStatement(
+	ctx context.Context,
+	accountID int64,
+	from, to time.Time,
+	begin func(opening, closing, net int64) error,
+	entry func(t transaction.Transaction) error,
+) error {
+	const op = "storage.postgres.AccountStatement"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	var balance int64
+	var opening, closing, net int64
 
-	tx, err := s.db.Begin()
+	err = tx.QueryRowContext(ctx, qrLedgerBalanceAt, accountID, from.UTC()).Scan(&opening)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		tx.Rollback()
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, accountID).Scan(&balance)
+	err = tx.QueryRowContext(ctx, qrLedgerBalanceAt, accountID, to.UTC()).Scan(&closing)
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if amount > balance {
-		return 0, fmt.Errorf("%s: %w", op, storage.ErrNotEnoughMoney)
+	err = tx.QueryRowContext(ctx, qrStatementNet, accountID, from.UTC(), to.UTC()).Scan(&net)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = tx.ExecContext(ctx, qrAccountWithdraw, amount, accountID)
+	err = begin(opening, closing, net)
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, accountID).Scan(&balance)
+	rows, err := tx.QueryContext(ctx, qrStatementTransactions, accountID, from.UTC(), to.UTC())
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = tx.ExecContext(ctx, qrCeateTransaction, accountID, nil, transaction.Withdraw, amount)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err == nil {
+			err = entry(t)
+		}
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = rows.Err()
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return balance, nil
+	return nil
 }
 
-// Returning updated wtite off and beneficiary accounts balances and error
-func (s *Storage) AccountTransfer(ctx context.Context, writeOfAccountID, beneficiaryAccountID, amount int64) (int64, int64, error) {
-	const op = "storage.postgres.AccountTransfer"
+// Returning the balances stored with the live key.
+// ErrIdempotencyKeyMismatch if the key was used for another request
+func (s *Storage) IdempotentResponse(ctx context.Context, key models.IdempotencyKey) ([]int64, error) {
+	const op = "storage.postgres.IdempotentResponse"
 
-	var writeOffBalance, beneficiaryBalance int64
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
 
-	tx, err := s.db.Begin()
+	balances, err := idempotentResponse(ctx, s.db, key)
 	if err != nil {
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, writeOfAccountID).Scan(&writeOffBalance)
+	return balances, nil
+}
+
+// Returning the stored rate of the pair, it may be the rate of the opposite direction quote/base
+func (s *Storage) FxRate(ctx context.Context, base, quote string) (models.FxRate, error) {
+	const op = "storage.postgres.FxRate"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	var rate models.FxRate
+
+	err := s.db.QueryRowContext(ctx, qrFxRate, base, quote).Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.FxRate{}, fmt.Errorf("%s: %w", op, storage.ErrFxRateDoesNotExist)
+	}
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return models.FxRate{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if amount > writeOffBalance {
-		return 0, 0, fmt.Errorf("%s: %w", op, storage.ErrNotEnoughMoney)
+	return rate, nil
+}
+
+// Sets the rates in one transaction, either all of them are set or none
+func (s *Storage) SetFxRates(ctx context.Context, rates []models.FxRate) error {
+	const op = "storage.postgres.SetFxRates"
+
+	ctx, span := startSpan(ctx, op)
+	defer span.End()
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, rate := range rates {
+			_, err := tx.ExecContext(ctx, qrSetFxRate, rate.Base, rate.Quote, rate.Rate)
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", rate.Base, rate.Quote, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = tx.ExecContext(ctx, qrAccountWithdraw, amount, writeOfAccountID)
+	return nil
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func idempotentResponse(ctx context.Context, db queryRower, key models.IdempotencyKey) ([]int64, error) {
+	var (
+		fingerprint string
+		response    []byte
+	)
+
+	err := db.QueryRowContext(ctx, qrIdempotencyKey, key.UserID, key.Key, key.TTL.Seconds()).Scan(&fingerprint, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrIdempotencyKeyDoesNotExist
+	}
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+
+	if fingerprint != key.Fingerprint {
+		return nil, storage.ErrIdempotencyKeyMismatch
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, writeOfAccountID).Scan(&writeOffBalance)
+	var balances []int64
+	err = json.Unmarshal(response, &balances)
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("idempotent response: %w", err)
 	}
 
-	_, err = tx.ExecContext(ctx, qrAccountTopUp, amount, beneficiaryAccountID)
+	return balances, nil
+}
+
+// Claims the key in tx, so that a concurrent request with the same key waits for tx to end.
+// Returning the balances of a live key stored earlier instead, they must be n.
+// A nil key claims nothing
+func claimIdempotencyKey(ctx context.Context, tx *sql.Tx, key *models.IdempotencyKey, n int) ([]int64, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	_, err := tx.ExecContext(ctx, qrDeleteExpiredIdempotencyKeys, key.UserID, key.TTL.Seconds())
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	err = tx.QueryRowContext(ctx, qrAccountBalance, beneficiaryAccountID).Scan(&beneficiaryBalance)
+	res, err := tx.ExecContext(ctx, qrClaimIdempotencyKey, key.UserID, key.Key, key.Fingerprint)
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx, qrCeateTransaction, writeOfAccountID, beneficiaryAccountID, transaction.Transfer, amount)
+	claimed, err := res.RowsAffected()
 	if err != nil {
-		tx.Rollback()
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+	if claimed == 1 {
+		return nil, nil
 	}
 
-	err = tx.Commit()
+	balances, err := idempotentResponse(ctx, tx, *key)
 	if err != nil {
-		return 0, 0, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+	if len(balances) != n {
+		return nil, fmt.Errorf("%w: response of another operation", storage.ErrIdempotencyKeyMismatch)
 	}
 
-	return writeOffBalance, beneficiaryBalance, nil
+	return balances, nil
+}
+
+// Stores the balances the operation returned with the key claimed in tx
+func setIdempotentResponse(ctx context.Context, tx *sql.Tx, key *models.IdempotencyKey, balances ...int64) error {
+	if key == nil {
+		return nil
+	}
+
+	response, err := json.Marshal(balances)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, qrSetIdempotentResponse, key.UserID, key.Key, response)
+
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccount(row rowScanner) (models.Account, error) {
+	var (
+		account  models.Account
+		lockType sql.NullString
+		reason   sql.NullString
+		note     sql.NullString
+		lockedBy sql.NullInt64
+		byBank   sql.NullBool
+		lockedAt sql.NullTime
+	)
+
+	err := row.Scan(&account.ID, &account.Balance, &account.Currency, &account.OwnerID, &account.IsLocked,
+		&lockType, &reason, &note, &lockedBy, &byBank, &lockedAt, &account.CreatedAt)
+	if err != nil {
+		return models.Account{}, err
+	}
+
+	if lockType.Valid {
+		account.Lock = &models.AccountLock{
+			Type:     lockType.String,
+			Reason:   reason.String,
+			Note:     note.String,
+			LockedBy: lockedBy.Int64,
+			ByBank:   byBank.Bool,
+			LockedAt: lockedAt.Time,
+		}
+	}
+
+	return account, nil
+}
+
+// Lock of the type read with an account under the row lock, nil if it is not locked
+func accountLock(lockType sql.NullString) *models.AccountLock {
+	if !lockType.Valid {
+		return nil
+	}
+
+	return &models.AccountLock{Type: lockType.String}
+}
+
+func scanTransaction(rows *sql.Rows) (transaction.Transaction, error) {
+	var (
+		t                   transaction.Transaction
+		participating       sql.NullInt64
+		participatingAmount sql.NullInt64
+		fxRate              sql.NullString
+	)
+
+	err := rows.Scan(&t.ID, &t.AccountID, &participating, &t.TransactionType, &t.Amount, &participatingAmount, &fxRate, &t.Date)
+	if err != nil {
+		return transaction.Transaction{}, err
+	}
+	t.ParticipatingAccountID = participating.Int64
+	t.ParticipatingAmount = participatingAmount.Int64
+	t.FxRate = fxRate.String
+
+	return t, nil
+}
+
+// A balance past bigint is reported by postgres as numeric_value_out_of_range
+func overflowErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "22003" {
+		return storage.ErrAmountOverflow
+	}
+
+	return err
+}
+
+// Dates are timestamp without time zone which lib/pq reads as UTC, so they are compared in UTC too
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.UTC()
+}
+
+func nullAmount(amount int64) any {
+	if amount == 0 {
+		return nil
+	}
+
+	return amount
+}
+
+// Every storage call gets its own span so slow queries are visible in the trace
+func startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
 }
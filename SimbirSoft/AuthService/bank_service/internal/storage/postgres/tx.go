@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"bank_service/internal/domain/models"
+	"bank_service/internal/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"read_committed":  sql.LevelReadCommitted,
+	"repeatable_read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
+// Base delay before running a failed transaction again, it grows with each attempt
+const txRetryDelay = 10 * time.Millisecond
+
+// Runs fn in a transaction at the isolation level of the storage and commits it, an error of fn rolls it back.
+// On a serialization error or a deadlock fn runs again in a new transaction up to txRetries times
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, fn)
+		if err == nil || !retryable(err) || attempt >= s.txRetries {
+			return err
+		}
+
+		// jitter keeps the conflicting transactions from meeting again
+		delay := txRetryDelay*time.Duration(attempt+1) + rand.N(txRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *Storage) runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: s.isolation})
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Serialization failure and deadlock detected
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// Returning balances, currencies and lock types of the accounts by id, all of them are locked by one query
+func lockAccounts(ctx context.Context, tx *sql.Tx, ids ...int64) (map[int64]models.Account, error) {
+	rows, err := tx.QueryContext(ctx, qrLockAccounts, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[int64]models.Account, len(ids))
+	for rows.Next() {
+		var (
+			account  models.Account
+			lockType sql.NullString
+		)
+
+		err = rows.Scan(&account.ID, &account.Balance, &account.Currency, &lockType)
+		if err != nil {
+			return nil, err
+		}
+		account.Lock = accountLock(lockType)
+
+		accounts[account.ID] = account
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, ok := accounts[id]; !ok {
+			return nil, fmt.Errorf("account %d: %w", id, storage.ErrAccountDoesNotExist)
+		}
+	}
+
+	return accounts, nil
+}
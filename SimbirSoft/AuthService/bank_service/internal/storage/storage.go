@@ -6,4 +6,11 @@ var (
 	ErrOwnerDoesNotExist   = errors.New("owner does not exist")
 	ErrAccountDoesNotExist = errors.New("account does not exist")
 	ErrNotEnoughMoney      = errors.New("not enough money")
+	ErrFxRateDoesNotExist  = errors.New("fx rate does not exist")
+	ErrAmountOverflow      = errors.New("amount overflows the balance")
+	ErrAccountLocked       = errors.New("account is locked")
+	ErrAccountNotLocked    = errors.New("account is not locked")
+	// The idempotency key was used for another request
+	ErrIdempotencyKeyMismatch     = errors.New("idempotency key mismatch")
+	ErrIdempotencyKeyDoesNotExist = errors.New("idempotency key does not exist")
 )
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "account_owner_id_idx";
+
+ALTER TABLE "owner" ADD CONSTRAINT "owner_full_name_key" UNIQUE ("full_name");
+
+ALTER TABLE "owner" DROP COLUMN IF EXISTS "user_id";
\ No newline at end of file
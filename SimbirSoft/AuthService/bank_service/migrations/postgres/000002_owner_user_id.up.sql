@@ -0,0 +1,6 @@
+-- Владелец привязан к пользователю auth, ФИО больше не идентифицирует его
+ALTER TABLE "owner" ADD COLUMN IF NOT EXISTS "user_id" bigint UNIQUE;
+
+ALTER TABLE "owner" DROP CONSTRAINT IF EXISTS "owner_full_name_key";
+
+CREATE INDEX IF NOT EXISTS "account_owner_id_idx" ON "account" ("owner_id");
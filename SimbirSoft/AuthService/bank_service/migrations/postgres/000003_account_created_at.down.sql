@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "account_owner_id_id_idx";
+CREATE INDEX IF NOT EXISTS "account_owner_id_idx" ON "account" ("owner_id");
+
+ALTER TABLE "account" DROP COLUMN IF EXISTS "created_at";
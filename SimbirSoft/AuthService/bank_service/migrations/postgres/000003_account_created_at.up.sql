@@ -0,0 +1,5 @@
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Постраничный список счетов владельца идет по id
+DROP INDEX IF EXISTS "account_owner_id_idx";
+CREATE INDEX IF NOT EXISTS "account_owner_id_id_idx" ON "account" ("owner_id", "id");
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "transaction_participating_account_id_date_id_idx";
+DROP INDEX IF EXISTS "transaction_account_id_date_id_idx";
@@ -0,0 +1,5 @@
+-- История операций счета: исходящие по account_id, входящие переводы по participating_account_id
+CREATE INDEX IF NOT EXISTS "transaction_account_id_date_id_idx" ON "transaction" ("account_id", "date" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS "transaction_participating_account_id_date_id_idx" ON "transaction" ("participating_account_id", "date" DESC, "id" DESC)
+  WHERE "participating_account_id" IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE "transaction" DROP COLUMN IF EXISTS "fx_rate";
+ALTER TABLE "transaction" DROP COLUMN IF EXISTS "participating_amount";
+DROP TABLE IF EXISTS "fx_rates";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "currency";
@@ -0,0 +1,18 @@
+-- Счета, открытые до появления валют, считаются рублевыми
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "currency" char(3) NOT NULL DEFAULT 'RUB' CHECK ("currency" ~ '^[A-Z]{3}$');
+ALTER TABLE "account" ALTER COLUMN "currency" DROP DEFAULT;
+
+-- rate: сколько единиц quote дают за единицу base
+CREATE TABLE IF NOT EXISTS "fx_rates" (
+  "base" char(3) NOT NULL CHECK ("base" ~ '^[A-Z]{3}$'),
+  "quote" char(3) NOT NULL CHECK ("quote" ~ '^[A-Z]{3}$'),
+  "rate" numeric(24,12) NOT NULL CHECK ("rate" > 0),
+  "updated_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("base", "quote"),
+  CHECK ("base" <> "quote")
+);
+
+-- Перевод между валютами: amount списан в валюте счета account_id,
+-- participating_amount зачислен в валюте получателя по курсу fx_rate
+ALTER TABLE "transaction" ADD COLUMN IF NOT EXISTS "participating_amount" int;
+ALTER TABLE "transaction" ADD COLUMN IF NOT EXISTS "fx_rate" numeric(24,12);
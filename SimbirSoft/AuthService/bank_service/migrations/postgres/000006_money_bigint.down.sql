@@ -0,0 +1,7 @@
+ALTER TABLE "transaction" DROP CONSTRAINT IF EXISTS "transaction_participating_amount_check";
+ALTER TABLE "transaction" DROP CONSTRAINT IF EXISTS "transaction_amount_check";
+ALTER TABLE "transaction" ALTER COLUMN "participating_amount" TYPE int;
+ALTER TABLE "transaction" ALTER COLUMN "amount" TYPE int;
+
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS "account_balance_check";
+ALTER TABLE "account" ALTER COLUMN "balance" TYPE int;
@@ -0,0 +1,8 @@
+-- Суммы в минимальных единицах валюты (копейки, центы): int переполняется уже на 21 млн рублей
+ALTER TABLE "account" ALTER COLUMN "balance" TYPE bigint;
+ALTER TABLE "account" ADD CONSTRAINT "account_balance_check" CHECK ("balance" >= 0);
+
+ALTER TABLE "transaction" ALTER COLUMN "amount" TYPE bigint;
+ALTER TABLE "transaction" ALTER COLUMN "participating_amount" TYPE bigint;
+ALTER TABLE "transaction" ADD CONSTRAINT "transaction_amount_check" CHECK ("amount" > 0);
+ALTER TABLE "transaction" ADD CONSTRAINT "transaction_participating_amount_check" CHECK ("participating_amount" > 0);
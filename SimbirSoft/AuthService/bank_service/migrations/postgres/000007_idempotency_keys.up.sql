@@ -0,0 +1,10 @@
+-- Ключи идемпотентности операций с деньгами. response пуст, пока операция не завершилась:
+-- ключ и результат записываются в одной транзакции с изменением баланса
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+  "user_id" bigint NOT NULL,
+  "key" varchar(255) NOT NULL,
+  "fingerprint" char(64) NOT NULL,
+  "response" jsonb,
+  "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("user_id", "key")
+);
@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS "postings_check_balanced" ON "postings";
+DROP TRIGGER IF EXISTS "postings_immutable" ON "postings";
+DROP TRIGGER IF EXISTS "postings_apply_balance" ON "postings";
+DROP FUNCTION IF EXISTS "postings_check_balanced"();
+DROP FUNCTION IF EXISTS "postings_immutable"();
+DROP FUNCTION IF EXISTS "postings_apply_balance"();
+
+DROP TABLE IF EXISTS "postings";
+DROP TABLE IF EXISTS "journal_entries";
+
+DELETE FROM "account" WHERE "kind" <> 'customer';
+DROP INDEX IF EXISTS "account_system_kind_currency_idx";
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS "account_owner_kind_check";
+ALTER TABLE "account" ALTER COLUMN "owner_id" SET NOT NULL;
+ALTER TABLE "account" DROP COLUMN IF EXISTS "kind";
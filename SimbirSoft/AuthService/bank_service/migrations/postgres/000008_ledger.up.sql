@@ -0,0 +1,85 @@
+-- Двойная запись: каждая операция - проводка (journal entry) из движений (postings) по счетам,
+-- сумма движений проводки в каждой валюте равна нулю. Деньги приходят со счета cash_in и уходят
+-- на cash_out, перевод между валютами проходит через счета fx обеих валют.
+-- Системные счета по одному на вид и валюту, владельца у них нет.
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "kind" varchar NOT NULL DEFAULT 'customer'
+  CHECK ("kind" IN ('customer', 'cash_in', 'cash_out', 'fx'));
+ALTER TABLE "account" ALTER COLUMN "owner_id" DROP NOT NULL;
+ALTER TABLE "account" ADD CONSTRAINT "account_owner_kind_check" CHECK (("kind" = 'customer') = ("owner_id" IS NOT NULL));
+CREATE UNIQUE INDEX IF NOT EXISTS "account_system_kind_currency_idx" ON "account" ("kind", "currency") WHERE "kind" <> 'customer';
+
+CREATE TABLE IF NOT EXISTS "journal_entries" (
+  "id" bigserial PRIMARY KEY,
+  "transaction_id" int REFERENCES "transaction" ("id"), -- пусто у начального баланса счета
+  "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS "postings" (
+  "id" bigserial PRIMARY KEY,
+  "entry_id" bigint NOT NULL REFERENCES "journal_entries" ("id"),
+  "account_id" int NOT NULL REFERENCES "account" ("id"),
+  "amount" bigint NOT NULL CHECK ("amount" <> 0) -- в валюте счета, плюс зачисляет, минус списывает
+);
+
+CREATE INDEX IF NOT EXISTS "postings_entry_id_idx" ON "postings" ("entry_id");
+CREATE INDEX IF NOT EXISTS "postings_account_id_idx" ON "postings" ("account_id");
+
+-- Начальные проводки: текущий баланс каждого счета приходит с cash_in его валюты
+INSERT INTO "account" ("kind", "currency", "balance")
+SELECT DISTINCT 'cash_in', "currency", 0 FROM "account" WHERE "kind" = 'customer'
+ON CONFLICT DO NOTHING;
+
+DO $$
+DECLARE
+  acc record;
+  entry bigint;
+BEGIN
+  FOR acc IN SELECT "id", "balance", "currency" FROM "account" WHERE "kind" = 'customer' AND "balance" <> 0 LOOP
+    INSERT INTO "journal_entries" DEFAULT VALUES RETURNING "id" INTO entry;
+    INSERT INTO "postings" ("entry_id", "account_id", "amount") VALUES
+      (entry, acc."id", acc."balance"),
+      (entry, (SELECT "id" FROM "account" WHERE "kind" = 'cash_in' AND "currency" = acc."currency"), -acc."balance");
+  END LOOP;
+END $$;
+
+-- Баланс клиентского счета - сумма его движений, триггер держит его в account.balance.
+-- Балансы системных счетов не хранятся, иначе каждая операция ждала бы блокировку их строки
+CREATE OR REPLACE FUNCTION "postings_apply_balance"() RETURNS trigger AS $$
+BEGIN
+  UPDATE "account" SET "balance" = "balance" + NEW."amount" WHERE "id" = NEW."account_id" AND "kind" = 'customer';
+  RETURN NEW;
+END $$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "postings_apply_balance" AFTER INSERT ON "postings"
+  FOR EACH ROW EXECUTE FUNCTION "postings_apply_balance"();
+
+-- Движения не меняются и не удаляются, ошибка исправляется новой проводкой
+CREATE OR REPLACE FUNCTION "postings_immutable"() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'postings are append-only';
+END $$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "postings_immutable" BEFORE UPDATE OR DELETE ON "postings"
+  FOR EACH ROW EXECUTE FUNCTION "postings_immutable"();
+
+-- Проверяется при коммите, когда все движения проводки уже записаны
+CREATE OR REPLACE FUNCTION "postings_check_balanced"() RETURNS trigger AS $$
+DECLARE
+  ccy char(3);
+BEGIN
+  SELECT a."currency" INTO ccy
+  FROM "postings" p JOIN "account" a ON a."id" = p."account_id"
+  WHERE p."entry_id" = NEW."entry_id"
+  GROUP BY a."currency" HAVING SUM(p."amount") <> 0
+  LIMIT 1;
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'journal entry % is not balanced in %', NEW."entry_id", ccy USING ERRCODE = 'check_violation';
+  END IF;
+
+  RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER "postings_check_balanced" AFTER INSERT ON "postings"
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION "postings_check_balanced"();
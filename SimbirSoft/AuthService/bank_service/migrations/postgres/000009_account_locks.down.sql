@@ -0,0 +1,13 @@
+ALTER TABLE "account" DROP COLUMN IF EXISTS "is_locked";
+ALTER TABLE "account" ADD COLUMN "is_locked" bool NOT NULL DEFAULT false;
+UPDATE "account" SET "is_locked" = TRUE WHERE "lock_type" IS NOT NULL;
+
+DROP TABLE IF EXISTS "account_lock_history";
+
+ALTER TABLE "account" DROP CONSTRAINT IF EXISTS "account_lock_check";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "locked_at";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "locked_by_bank";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "locked_by";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "lock_note";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "lock_reason";
+ALTER TABLE "account" DROP COLUMN IF EXISTS "lock_type";
@@ -0,0 +1,41 @@
+-- Блокировка счета: freeze запрещает любое движение денег, debit_block - списания, credit_block - зачисления.
+-- На счете не больше одной блокировки, is_locked теперь вычисляется по ней
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "lock_type" varchar
+  CHECK ("lock_type" IN ('freeze', 'debit_block', 'credit_block'));
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "lock_reason" varchar;
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "lock_note" text;
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "locked_by" bigint; -- пользователь, пусто у блокировок до этой миграции
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "locked_by_bank" bool; -- снять ее может только сотрудник банка
+ALTER TABLE "account" ADD COLUMN IF NOT EXISTS "locked_at" timestamp;
+ALTER TABLE "account" ADD CONSTRAINT "account_lock_check" CHECK (
+  ("lock_type" IS NULL) = ("lock_reason" IS NULL) AND
+  ("lock_type" IS NULL) = ("lock_note" IS NULL) AND
+  ("lock_type" IS NULL) = ("locked_by_bank" IS NULL) AND
+  ("lock_type" IS NULL) = ("locked_at" IS NULL)
+);
+
+-- История всех установок и снятий блокировок
+CREATE TABLE IF NOT EXISTS "account_lock_history" (
+  "id" bigserial PRIMARY KEY,
+  "account_id" int NOT NULL REFERENCES "account" ("id"),
+  "action" varchar NOT NULL CHECK ("action" IN ('lock', 'unlock')),
+  "lock_type" varchar NOT NULL, -- установленной или снятой блокировки
+  "reason" varchar NOT NULL,
+  "note" text NOT NULL, -- при снятии - комментарий снявшего
+  "actor_id" bigint,
+  "by_bank" bool NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS "account_lock_history_account_id_idx" ON "account_lock_history" ("account_id", "id");
+
+-- Прежние блокировки без типа и причины становятся полной заморозкой банком
+UPDATE "account"
+SET "lock_type" = 'freeze', "lock_reason" = 'other', "lock_note" = '', "locked_by_bank" = TRUE, "locked_at" = CURRENT_TIMESTAMP
+WHERE "is_locked";
+
+INSERT INTO "account_lock_history" ("account_id", "action", "lock_type", "reason", "note", "by_bank", "created_at")
+SELECT "id", 'lock', "lock_type", "lock_reason", "lock_note", "locked_by_bank", "locked_at" FROM "account" WHERE "is_locked";
+
+ALTER TABLE "account" DROP COLUMN "is_locked";
+ALTER TABLE "account" ADD COLUMN "is_locked" bool GENERATED ALWAYS AS ("lock_type" IS NOT NULL) STORED;
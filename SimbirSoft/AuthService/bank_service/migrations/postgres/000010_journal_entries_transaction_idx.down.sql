@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "journal_entries_transaction_id_idx";
@@ -0,0 +1,2 @@
+-- Проводка операции по ее id: выписка сверяет журнал операций с проводками
+CREATE INDEX IF NOT EXISTS "journal_entries_transaction_id_idx" ON "journal_entries" ("transaction_id");
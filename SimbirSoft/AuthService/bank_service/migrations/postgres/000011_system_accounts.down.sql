@@ -0,0 +1 @@
+-- Системные счета остаются: на них ссылаются проводки
@@ -0,0 +1,8 @@
+-- Системные счета всех видов заводятся вместе с первым счетом валюты, а не внутри операции:
+-- при repeatable_read и serializable параллельное создание счета в операции прерывало бы ее.
+-- Здесь они заводятся для валют, счета в которых открыты раньше
+INSERT INTO "account" ("kind", "currency", "balance")
+SELECT k."kind", c."currency", 0
+FROM (SELECT DISTINCT "currency" FROM "account" WHERE "kind" = 'customer') AS c
+CROSS JOIN (VALUES ('cash_in'), ('cash_out'), ('fx')) AS k ("kind")
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_GetAccount_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	fullName := gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName()
+	citizenship := gofakeit.Country()
+	balance := int64(500)
+
+	respCreateAccount, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance})
+	require.NoError(t, err)
+	createTime := time.Now()
+
+	_, err = st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, ReasonCode: "customer_request"})
+	require.NoError(t, err)
+
+	respGetAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId})
+	require.NoError(t, err)
+
+	account := respGetAccount.GetAccount()
+	assert.Equal(t, respCreateAccount.AccountId, account.GetId())
+	assert.Equal(t, balance, account.GetBalance())
+	assert.True(t, account.GetIsLocked())
+	assert.Equal(t, fullName, account.GetOwner().GetFullName())
+	assert.Equal(t, citizenship, account.GetOwner().GetCitizenship())
+
+	const deltaSeconds = 5
+	assert.InDelta(t, createTime.Unix(), account.GetCreatedAt(), deltaSeconds)
+}
+
+func Test_GetAccount_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respCreateAccount, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.Jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Balance:     int64(500),
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		jwt       string
+		accountID int64
+		code      codes.Code
+	}{
+		{
+			name:      "invalid jwt",
+			jwt:       invalidJWT,
+			accountID: respCreateAccount.AccountId,
+			code:      codes.PermissionDenied,
+		},
+		{
+			name:      "account of another user",
+			jwt:       st.NewUserToken(ctx),
+			accountID: respCreateAccount.AccountId,
+			code:      codes.PermissionDenied,
+		},
+		{
+			name:      "nonexistent account id",
+			jwt:       st.Jwt,
+			accountID: int64(1000000000),
+			code:      codes.InvalidArgument,
+		},
+		{
+			name:      "negative account id",
+			jwt:       st.Jwt,
+			accountID: int64(-1),
+			code:      codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: tt.jwt, AccountId: tt.accountID})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func Test_ListAccounts_Pagination(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	fullName := gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName()
+	citizenship := gofakeit.Country()
+
+	const accountsCount = 5
+
+	var accountIDs []int64
+	for i := 0; i < accountsCount; i++ {
+		resp, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: int64(i)})
+		require.NoError(t, err)
+		accountIDs = append(accountIDs, resp.AccountId)
+	}
+
+	// чужие счета в список не попадают
+	_, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.NewUserToken(ctx),
+		FullName:    fullName,
+		Citizenship: citizenship,
+		Balance:     int64(500),
+	})
+	require.NoError(t, err)
+
+	var listed []int64
+	pageToken := ""
+	for {
+		resp, err := st.BankClient.ListAccounts(ctx, &bank_v1.ListAccountsRequest{Jwt: st.Jwt, PageSize: 2, PageToken: pageToken})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(resp.GetAccounts()), 2)
+
+		for _, account := range resp.GetAccounts() {
+			assert.Equal(t, fullName, account.GetOwner().GetFullName())
+			listed = append(listed, account.GetId())
+		}
+
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, accountIDs, listed)
+}
+
+func Test_ListAccounts_LockStatus(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	fullName := gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName()
+	citizenship := gofakeit.Country()
+
+	respActive, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: int64(100)})
+	require.NoError(t, err)
+
+	respLocked, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: int64(200)})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respLocked.AccountId, ReasonCode: "customer_request"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		lockStatus string
+		expected   []int64
+	}{
+		{
+			name:       "any",
+			lockStatus: "",
+			expected:   []int64{respActive.AccountId, respLocked.AccountId},
+		},
+		{
+			name:       "locked",
+			lockStatus: "locked",
+			expected:   []int64{respLocked.AccountId},
+		},
+		{
+			name:       "active",
+			lockStatus: "active",
+			expected:   []int64{respActive.AccountId},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := st.BankClient.ListAccounts(ctx, &bank_v1.ListAccountsRequest{Jwt: st.Jwt, LockStatus: tt.lockStatus})
+			require.NoError(t, err)
+			assert.Empty(t, resp.GetNextPageToken())
+
+			var listed []int64
+			for _, account := range resp.GetAccounts() {
+				listed = append(listed, account.GetId())
+			}
+			assert.Equal(t, tt.expected, listed)
+		})
+	}
+
+	_, err = st.BankClient.ListAccounts(ctx, &bank_v1.ListAccountsRequest{Jwt: st.Jwt, LockStatus: "frozen"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.BankClient.ListAccounts(ctx, &bank_v1.ListAccountsRequest{Jwt: st.Jwt, PageToken: "not a token"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
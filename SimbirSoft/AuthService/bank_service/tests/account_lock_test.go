@@ -2,8 +2,12 @@ package tests
 
 import (
 	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/internal/storage"
+	"bank_service/internal/storage/postgres"
 	"bank_service/tests/suite"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/assert"
@@ -17,14 +21,14 @@ func Test_AccountLock_HappyPath(t *testing.T) {
 	citizenship := gofakeit.Country()
 	balance := int64(500)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateAccount.AccountId}
+	reqAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqAccountLock)
 	require.NoError(t, err)
 }
@@ -36,14 +40,14 @@ func Test_AccountLock_DoubleLock(t *testing.T) {
 	citizenship := gofakeit.Country()
 	balance := int64(500)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateAccount.AccountId}
+	reqAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqAccountLock)
 	require.NoError(t, err)
 
@@ -59,33 +63,341 @@ func Test_AccountLock_FailCases(t *testing.T) {
 	citizenship := gofakeit.Country()
 	balance := int64(500)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
+	strangerJWT := st.NewUserToken(ctx)
+
 	tests := []struct {
 		name        string
+		jwt         string
 		accountID   int64
+		lockType    string
+		reasonCode  string
+		note        string
 		expectedErr string
 	}{{
 		name:        "empty account id",
+		jwt:         st.Jwt,
 		accountID:   int64(0),
+		reasonCode:  "customer_request",
 		expectedErr: "incorrect or empty account id",
 	},
 		{
 			name:        "negative account id",
+			jwt:         st.Jwt,
 			accountID:   int64(-1),
+			reasonCode:  "customer_request",
 			expectedErr: "incorrect or empty account id",
 		},
+		{
+			name:        "unknown lock type",
+			jwt:         st.Jwt,
+			accountID:   respCreateAccount.AccountId,
+			lockType:    "partial",
+			reasonCode:  "customer_request",
+			expectedErr: "lock type must be freeze, debit_block or credit_block",
+		},
+		{
+			name:        "empty reason code",
+			jwt:         st.Jwt,
+			accountID:   respCreateAccount.AccountId,
+			expectedErr: "reason code must be one of",
+		},
+		{
+			name:        "too long note",
+			jwt:         st.Jwt,
+			accountID:   respCreateAccount.AccountId,
+			reasonCode:  "customer_request",
+			note:        strings.Repeat("я", 501),
+			expectedErr: "note is too long",
+		},
+		{
+			name:        "account of another owner",
+			jwt:         strangerJWT,
+			accountID:   respCreateAccount.AccountId,
+			reasonCode:  "customer_request",
+			expectedErr: "account belongs to another owner",
+		},
+		{
+			name:        "invalid jwt",
+			jwt:         invalidJWT,
+			accountID:   respCreateAccount.AccountId,
+			reasonCode:  "customer_request",
+			expectedErr: "invalid token",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{
+				Jwt:        tt.jwt,
+				AccountId:  tt.accountID,
+				LockType:   tt.lockType,
+				ReasonCode: tt.reasonCode,
+				Note:       tt.note,
+			})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+}
+
+func Test_AccountLock_LockTypes(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		lockType      string
+		debitAllowed  bool
+		creditAllowed bool
+	}{
+		{lockType: "freeze"},
+		{lockType: "debit_block", creditAllowed: true},
+		{lockType: "credit_block", debitAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lockType, func(t *testing.T) {
+			accountID := createAccount(ctx, t, st, st.Jwt, 500)
+			otherID := createAccount(ctx, t, st, st.Jwt, 500)
+
+			_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{
+				Jwt:        st.Jwt,
+				AccountId:  accountID,
+				LockType:   tt.lockType,
+				ReasonCode: "lost_card",
+				Note:       "карта утеряна",
+			})
+			require.NoError(t, err)
+
+			// списания: снятие и исходящий перевод
+			_, errWithdraw := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 10})
+			_, errOutgoing := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+				Jwt: st.Jwt, WriteOffAccountId: accountID, BeneficiaryAccountId: otherID, TransferAmount: 10,
+			})
+			// зачисления: пополнение и входящий перевод
+			_, errTopUp := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 10})
+			_, errIncoming := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+				Jwt: st.Jwt, WriteOffAccountId: otherID, BeneficiaryAccountId: accountID, TransferAmount: 10,
+			})
+
+			for _, err := range []error{errWithdraw, errOutgoing} {
+				if tt.debitAllowed {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorContains(t, err, "account is locked")
+				}
+			}
+			for _, err := range []error{errTopUp, errIncoming} {
+				if tt.creditAllowed {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorContains(t, err, "account is locked")
+				}
+			}
+
+			respGetAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+			require.NoError(t, err)
+			lock := respGetAccount.GetAccount().GetLock()
+			assert.True(t, respGetAccount.GetAccount().GetIsLocked())
+			assert.Equal(t, tt.lockType, lock.GetLockType())
+			assert.Equal(t, "lost_card", lock.GetReasonCode())
+			assert.Equal(t, "карта утеряна", lock.GetNote())
+			assert.NotZero(t, lock.GetLockedBy())
+			assert.False(t, lock.GetByBank())
+			assert.InDelta(t, time.Now().Unix(), lock.GetLockedAt(), 5)
+		})
+	}
+}
+
+// Замок, поставленный после проверки сервиса, проверяется еще раз в транзакции хранилища:
+// хранилище вызывается напрямую, в обход проверки сервиса
+func Test_AccountLock_CheckedInTransaction(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	s, err := postgres.New(st.Cfg.Storage.Driver, st.Cfg.Storage.Info, st.Cfg.Storage.Isolation, st.Cfg.Storage.TxRetries)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Stop() })
+
+	tests := []struct {
+		lockType      string
+		debitAllowed  bool
+		creditAllowed bool
+	}{
+		{lockType: "freeze"},
+		{lockType: "debit_block", creditAllowed: true},
+		{lockType: "credit_block", debitAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lockType, func(t *testing.T) {
+			accountID := createAccount(ctx, t, st, st.Jwt, 500)
+			otherID := createAccount(ctx, t, st, st.Jwt, 500)
+
+			_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{
+				Jwt: st.Jwt, AccountId: accountID, LockType: tt.lockType, ReasonCode: "lost_card",
+			})
+			require.NoError(t, err)
+
+			_, errWithdraw := s.AccountWithdraw(ctx, accountID, 10, nil)
+			_, _, errOutgoing := s.AccountTransfer(ctx, accountID, otherID, 10, 10, "", nil)
+			_, errTopUp := s.AccountTopUp(ctx, accountID, 10, nil)
+			_, _, errIncoming := s.AccountTransfer(ctx, otherID, accountID, 10, 10, "", nil)
+
+			for _, err := range []error{errWithdraw, errOutgoing} {
+				if tt.debitAllowed {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, storage.ErrAccountLocked)
+				}
+			}
+			for _, err := range []error{errTopUp, errIncoming} {
+				if tt.creditAllowed {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, storage.ErrAccountLocked)
+				}
+			}
+		})
+	}
+}
+
+func Test_AccountUnlock_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 500)
+
+	_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: accountID, ReasonCode: "customer_request"})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountUnlock(ctx, &bank_v1.AccountUnlockRequest{Jwt: st.Jwt, AccountId: accountID, Note: "карта нашлась"})
+	require.NoError(t, err)
+
+	respGetAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	assert.False(t, respGetAccount.GetAccount().GetIsLocked())
+	assert.Nil(t, respGetAccount.GetAccount().GetLock())
+
+	respTopUp, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(510), respTopUp.GetBalance())
+
+	_, err = st.BankClient.AccountUnlock(ctx, &bank_v1.AccountUnlockRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "account is not locked")
+}
+
+func Test_AccountLock_ByBank(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 500)
+
+	// сотрудник банка блокирует чужой счет, владелец снять такую блокировку не может
+	adminJwt := st.NewAdminToken(ctx, st.Cfg.Locks.AdminScope)
+	_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{
+		Jwt:        adminJwt,
+		AccountId:  accountID,
+		ReasonCode: "court_order",
+		Note:       "арест по решению суда",
+	})
+	require.NoError(t, err)
+
+	respGetAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	assert.Equal(t, "freeze", respGetAccount.GetAccount().GetLock().GetLockType())
+	assert.True(t, respGetAccount.GetAccount().GetLock().GetByBank())
+
+	_, err = st.BankClient.AccountUnlock(ctx, &bank_v1.AccountUnlockRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "account is locked by the bank")
+
+	_, err = st.BankClient.AccountUnlock(ctx, &bank_v1.AccountUnlockRequest{Jwt: adminJwt, AccountId: accountID, Note: "арест снят"})
+	require.NoError(t, err)
+}
+
+func Test_AccountLock_StaffScopeNotSelfGranted(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 500)
+
+	// клиент не может выдать себе scope сотрудника: auth выдает его только администраторам
+	email, pass := st.RegisterUser(ctx)
+	_, err := st.AuthClient.Login(ctx, st.LoginRequest(email, pass, st.Cfg.Locks.AdminScope))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "scope requires the admin role")
+
+	respLogin, err := st.AuthClient.Login(ctx, st.LoginRequest(email, pass, ""))
+	require.NoError(t, err)
+
+	// и без него чужой счет не блокирует
+	_, err = st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{
+		Jwt:        respLogin.GetToken(),
+		AccountId:  accountID,
+		ReasonCode: "court_order",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "account belongs to another owner")
+}
+
+func Test_AccountUnlock_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 500)
+
+	_, err := st.BankClient.AccountLock(ctx, &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: accountID, ReasonCode: "customer_request"})
+	require.NoError(t, err)
+
+	strangerJWT := st.NewUserToken(ctx)
+
+	tests := []struct {
+		name        string
+		jwt         string
+		accountID   int64
+		note        string
+		expectedErr string
+	}{
+		{
+			name:        "invalid jwt",
+			jwt:         invalidJWT,
+			accountID:   accountID,
+			expectedErr: "invalid token",
+		},
+		{
+			name:        "empty account id",
+			jwt:         st.Jwt,
+			expectedErr: "incorrect or empty account id",
+		},
+		{
+			name:        "nonexistent account id",
+			jwt:         st.Jwt,
+			accountID:   int64(10000000),
+			expectedErr: "account id does not exist",
+		},
+		{
+			name:        "too long note",
+			jwt:         st.Jwt,
+			accountID:   accountID,
+			note:        strings.Repeat("я", 501),
+			expectedErr: "note is too long",
+		},
+		{
+			name:        "account of another owner",
+			jwt:         strangerJWT,
+			accountID:   accountID,
+			expectedErr: "account belongs to another owner",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.BankClient.AccountUnlock(ctx, &bank_v1.AccountUnlockRequest{
+				Jwt:       tt.jwt,
 				AccountId: tt.accountID,
+				Note:      tt.note,
 			})
 			require.Error(t, err)
 			require.Contains(t, err.Error(), tt.expectedErr)
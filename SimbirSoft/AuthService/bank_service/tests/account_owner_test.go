@@ -0,0 +1,100 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_AccountOwner_OtherUserAccount(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	balance := int64(250)
+	amount := int64(50)
+
+	respOwnerAccount, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.Jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Balance:     balance,
+	})
+	require.NoError(t, err)
+
+	strangerJWT := st.NewUserToken(ctx)
+
+	respStrangerAccount, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         strangerJWT,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Balance:     balance,
+	})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{
+		Jwt:            strangerJWT,
+		AccountId:      respOwnerAccount.AccountId,
+		WithdrawAmount: amount,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{
+		Jwt:         strangerJWT,
+		AccountId:   respOwnerAccount.AccountId,
+		TopUpAmount: amount,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  strangerJWT,
+		WriteOffAccountId:    respOwnerAccount.AccountId,
+		BeneficiaryAccountId: respStrangerAccount.AccountId,
+		TransferAmount:       amount,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// переводить на чужой счет можно
+	respTransfer, err := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  strangerJWT,
+		WriteOffAccountId:    respStrangerAccount.AccountId,
+		BeneficiaryAccountId: respOwnerAccount.AccountId,
+		TransferAmount:       amount,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, balance-amount, respTransfer.WriteOffAccountBalance)
+	assert.Equal(t, balance+amount, respTransfer.BeneficiaryAccountBalance)
+}
+
+func Test_AccountOwner_SameFullName(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	fullName := gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName()
+	citizenship := gofakeit.Country()
+	balance := int64(250)
+	withdrawAmount := int64(50)
+
+	respFirst, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance})
+	require.NoError(t, err)
+
+	// тезка - другой владелец, а не доступ к чужим счетам
+	namesakeJWT := st.NewUserToken(ctx)
+
+	respSecond, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{Jwt: namesakeJWT, FullName: fullName, Citizenship: citizenship, Balance: balance})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: namesakeJWT, AccountId: respFirst.AccountId, WithdrawAmount: withdrawAmount})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respWithdraw, err := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: namesakeJWT, AccountId: respSecond.AccountId, WithdrawAmount: withdrawAmount})
+	require.NoError(t, err)
+	assert.Equal(t, balance-withdrawAmount, respWithdraw.Balance)
+}
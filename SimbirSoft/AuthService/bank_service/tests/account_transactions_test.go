@@ -0,0 +1,230 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_ListTransactions_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	start := time.Now().Add(-time.Minute)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(1000))
+
+	strangerJWT := st.NewUserToken(ctx)
+	strangerAccountID := createAccount(ctx, t, st, strangerJWT, int64(1000))
+
+	_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 200})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    accountID,
+		BeneficiaryAccountId: strangerAccountID,
+		TransferAmount:       300,
+	})
+	require.NoError(t, err)
+
+	// входящий перевод хранится под счетом отправителя
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  strangerJWT,
+		WriteOffAccountId:    strangerAccountID,
+		BeneficiaryAccountId: accountID,
+		TransferAmount:       400,
+	})
+	require.NoError(t, err)
+
+	resp, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	require.Len(t, resp.GetTransactions(), 4)
+	assert.Empty(t, resp.GetNextPageToken())
+
+	incoming := resp.GetTransactions()[0]
+	assert.Equal(t, "Transfer", incoming.GetType())
+	assert.Equal(t, int64(400), incoming.GetAmount())
+	assert.Equal(t, strangerAccountID, incoming.GetCounterpartyAccountId())
+	assert.True(t, incoming.GetIncoming())
+	assert.GreaterOrEqual(t, incoming.GetDate(), start.Unix())
+
+	outgoing := resp.GetTransactions()[1]
+	assert.Equal(t, "Transfer", outgoing.GetType())
+	assert.Equal(t, int64(300), outgoing.GetAmount())
+	assert.Equal(t, strangerAccountID, outgoing.GetCounterpartyAccountId())
+	assert.False(t, outgoing.GetIncoming())
+
+	withdraw := resp.GetTransactions()[2]
+	assert.Equal(t, "Withdraw", withdraw.GetType())
+	assert.Zero(t, withdraw.GetCounterpartyAccountId())
+	assert.False(t, withdraw.GetIncoming())
+
+	topUp := resp.GetTransactions()[3]
+	assert.Equal(t, "TopUp", topUp.GetType())
+	assert.True(t, topUp.GetIncoming())
+}
+
+func Test_ListTransactions_Filters(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(0))
+
+	for _, amount := range []int64{100, 200, 300, 400, 500} {
+		_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: amount})
+		require.NoError(t, err)
+	}
+
+	_, err := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 250})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      *bank_v1.ListTransactionsRequest
+		expected []int64
+	}{
+		{
+			name:     "type",
+			req:      &bank_v1.ListTransactionsRequest{Types: []string{"Withdraw"}},
+			expected: []int64{250},
+		},
+		{
+			name:     "amount range",
+			req:      &bank_v1.ListTransactionsRequest{MinAmount: 200, MaxAmount: 400},
+			expected: []int64{250, 400, 300, 200},
+		},
+		{
+			name:     "date range",
+			req:      &bank_v1.ListTransactionsRequest{From: time.Now().Add(-time.Hour).Unix(), To: time.Now().Add(time.Hour).Unix(), Types: []string{"TopUp"}, MinAmount: 500},
+			expected: []int64{500},
+		},
+		{
+			name:     "future",
+			req:      &bank_v1.ListTransactionsRequest{From: time.Now().Add(time.Hour).Unix()},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Jwt = st.Jwt
+			tt.req.AccountId = accountID
+
+			resp, err := st.BankClient.ListTransactions(ctx, tt.req)
+			require.NoError(t, err)
+
+			var amounts []int64
+			for _, tr := range resp.GetTransactions() {
+				amounts = append(amounts, tr.GetAmount())
+			}
+			assert.Equal(t, tt.expected, amounts)
+		})
+	}
+}
+
+func Test_ListTransactions_Pagination(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(0))
+
+	const topUpsCount = 7
+
+	for i := 1; i <= topUpsCount; i++ {
+		_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: int64(i)})
+		require.NoError(t, err)
+	}
+
+	var amounts []int64
+	pageToken := ""
+	for {
+		resp, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID, PageSize: 3, PageToken: pageToken})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(resp.GetTransactions()), 3)
+
+		for _, tr := range resp.GetTransactions() {
+			amounts = append(amounts, tr.GetAmount())
+		}
+
+		pageToken = resp.GetNextPageToken()
+		if pageToken == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []int64{7, 6, 5, 4, 3, 2, 1}, amounts)
+}
+
+func Test_ListTransactions_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(100))
+
+	tests := []struct {
+		name string
+		req  *bank_v1.ListTransactionsRequest
+		code codes.Code
+	}{
+		{
+			name: "invalid jwt",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: invalidJWT, AccountId: accountID},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "account of another user",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: st.NewUserToken(ctx), AccountId: accountID},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "unknown type",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID, Types: []string{"Refund"}},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "reversed date range",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID, From: 2000, To: 1000},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "reversed amount range",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID, MinAmount: 500, MaxAmount: 100},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "invalid page token",
+			req:  &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID, PageToken: "not a token"},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.BankClient.ListTransactions(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func createAccount(ctx context.Context, t *testing.T, st *suite.Suite, jwt string, balance int64) int64 {
+	t.Helper()
+
+	resp, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Balance:     balance,
+	})
+	require.NoError(t, err)
+
+	return resp.AccountId
+}
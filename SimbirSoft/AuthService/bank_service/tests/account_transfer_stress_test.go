@@ -0,0 +1,72 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"sync"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_AccountTransfer_Concurrent(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	const (
+		accounts  = 4
+		balance   = 1000
+		workers   = 8
+		transfers = 25
+	)
+
+	ids := make([]int64, accounts)
+	for i := range ids {
+		ids[i] = createAccount(ctx, t, st, st.Jwt, balance)
+	}
+
+	// встречные переводы между одними и теми же счетами: без общего порядка блокировок они зависли бы
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*transfers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < transfers; i++ {
+				from, to := ids[gofakeit.Number(0, accounts-1)], ids[gofakeit.Number(0, accounts-1)]
+
+				_, err := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+					Jwt:                  st.Jwt,
+					WriteOffAccountId:    from,
+					BeneficiaryAccountId: to,
+					TransferAmount:       int64(gofakeit.Number(1, 300)),
+				})
+				// нехватка денег - допустимый исход, остальные ошибки нет
+				if err != nil && status.Code(err) != codes.ResourceExhausted {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// деньги только переходят между счетами, их сумма не меняется
+	var total int64
+	for _, id := range ids {
+		respAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: id})
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, respAccount.Account.Balance, int64(0))
+
+		total += respAccount.Account.Balance
+	}
+	assert.Equal(t, int64(accounts*balance), total)
+}
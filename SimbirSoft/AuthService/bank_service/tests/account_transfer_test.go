@@ -3,11 +3,14 @@ package tests
 import (
 	bank_v1 "bank_service/api/gen/bank"
 	"bank_service/tests/suite"
+	"math"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func Test_AccountTransfer_HappyPath(t *testing.T) {
@@ -21,21 +24,21 @@ func Test_AccountTransfer_HappyPath(t *testing.T) {
 	beneficiaryBalance := int64(250)
 	transferAmount := int64(50)
 
-	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
+	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
 	respCreateWriteOffAccount, err := st.BankClient.CreateAccount(ctx, reqCreateWriteOffAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateWriteOffAccount.AccountId)
 	assert.Equal(t, respCreateWriteOffAccount.Balance, writeOffBalance)
 
-	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
+	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
 	respCreateBeneficiaryAccount, err := st.BankClient.CreateAccount(ctx, reqCreateBeneficiaryAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateBeneficiaryAccount.AccountId)
 	assert.Equal(t, respCreateBeneficiaryAccount.Balance, beneficiaryBalance)
 
-	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: validJWT, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
+	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: st.Jwt, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
 	respAccountTransfer, err := st.BankClient.AccountTransfer(ctx, reqAccountTransfer)
 	require.NoError(t, err)
 
@@ -54,25 +57,25 @@ func Test_AccountTransfer_LockedWriteOffAccount(t *testing.T) {
 	beneficiaryBalance := int64(250)
 	transferAmount := int64(50)
 
-	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
+	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
 	respCreateWriteOffAccount, err := st.BankClient.CreateAccount(ctx, reqCreateWriteOffAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateWriteOffAccount.AccountId)
 	assert.Equal(t, respCreateWriteOffAccount.Balance, writeOffBalance)
 
-	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
+	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
 	respCreateBeneficiaryAccount, err := st.BankClient.CreateAccount(ctx, reqCreateBeneficiaryAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateBeneficiaryAccount.AccountId)
 	assert.Equal(t, respCreateBeneficiaryAccount.Balance, beneficiaryBalance)
 
-	reqWriteOffAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateWriteOffAccount.AccountId}
+	reqWriteOffAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateWriteOffAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqWriteOffAccountLock)
 	require.NoError(t, err)
 
-	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: validJWT, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
+	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: st.Jwt, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
 	_, err = st.BankClient.AccountTransfer(ctx, reqAccountTransfer)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "account is locked")
@@ -89,25 +92,25 @@ func Test_AccountTransfer_LockedBeneficiaryAccount(t *testing.T) {
 	beneficiaryBalance := int64(250)
 	transferAmount := int64(50)
 
-	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
+	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
 	respCreateWriteOffAccount, err := st.BankClient.CreateAccount(ctx, reqCreateWriteOffAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateWriteOffAccount.AccountId)
 	assert.Equal(t, respCreateWriteOffAccount.Balance, writeOffBalance)
 
-	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
+	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
 	respCreateBeneficiaryAccount, err := st.BankClient.CreateAccount(ctx, reqCreateBeneficiaryAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateBeneficiaryAccount.AccountId)
 	assert.Equal(t, respCreateBeneficiaryAccount.Balance, beneficiaryBalance)
 
-	reqBeneficiaryAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateBeneficiaryAccount.AccountId}
+	reqBeneficiaryAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateBeneficiaryAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqBeneficiaryAccountLock)
 	require.NoError(t, err)
 
-	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: validJWT, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
+	reqAccountTransfer := &bank_v1.AccountTransferRequest{Jwt: st.Jwt, WriteOffAccountId: respCreateWriteOffAccount.AccountId, BeneficiaryAccountId: respCreateBeneficiaryAccount.AccountId, TransferAmount: transferAmount}
 	_, err = st.BankClient.AccountTransfer(ctx, reqAccountTransfer)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "account is locked")
@@ -124,14 +127,14 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 	beneficiaryBalance := int64(250)
 	transferAmount := int64(50)
 
-	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
+	reqCreateWriteOffAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: writeOffFullName, Citizenship: writeOffCitizenship, Balance: writeOffBalance}
 	respCreateWriteOffAccount, err := st.BankClient.CreateAccount(ctx, reqCreateWriteOffAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateWriteOffAccount.AccountId)
 	assert.Equal(t, respCreateWriteOffAccount.Balance, writeOffBalance)
 
-	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
+	reqCreateBeneficiaryAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: beneficiaryFullName, Citizenship: beneficiaryCitizenship, Balance: beneficiaryBalance}
 	respCreateBeneficiaryAccount, err := st.BankClient.CreateAccount(ctx, reqCreateBeneficiaryAccount)
 	require.NoError(t, err)
 
@@ -156,7 +159,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "nonexistent write off account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    int64(1000000),
 			beneficiaryAccountID: respCreateBeneficiaryAccount.AccountId,
 			amount:               transferAmount,
@@ -164,7 +167,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "nonexistent beneficiary account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    respCreateWriteOffAccount.AccountId,
 			beneficiaryAccountID: int64(1000000),
 			amount:               transferAmount,
@@ -172,7 +175,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "nonexistent both account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    int64(1000000),
 			beneficiaryAccountID: int64(1000000),
 			amount:               transferAmount,
@@ -180,7 +183,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "empty write off account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    int64(-1),
 			beneficiaryAccountID: respCreateBeneficiaryAccount.AccountId,
 			amount:               transferAmount,
@@ -188,7 +191,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "negative beneficiary account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    respCreateWriteOffAccount.AccountId,
 			beneficiaryAccountID: int64(-1),
 			amount:               transferAmount,
@@ -196,7 +199,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "negative both account id",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    int64(-1),
 			beneficiaryAccountID: int64(-1),
 			amount:               transferAmount,
@@ -204,7 +207,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "empty amount",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    respCreateWriteOffAccount.AccountId,
 			beneficiaryAccountID: respCreateBeneficiaryAccount.AccountId,
 			amount:               int64(0),
@@ -212,7 +215,7 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		},
 		{
 			name:                 "negative amount",
-			jwt:                  validJWT,
+			jwt:                  st.Jwt,
 			writeOffAccountID:    respCreateWriteOffAccount.AccountId,
 			beneficiaryAccountID: respCreateBeneficiaryAccount.AccountId,
 			amount:               int64(-50),
@@ -233,3 +236,24 @@ func Test_AccountTransfer_FailCases(t *testing.T) {
 		})
 	}
 }
+
+func Test_AccountTransfer_Overflow(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	writeOffID := createAccount(ctx, t, st, st.Jwt, 100)
+	beneficiaryID := createAccount(ctx, t, st, st.Jwt, math.MaxInt64-10)
+
+	_, err := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    writeOffID,
+		BeneficiaryAccountId: beneficiaryID,
+		TransferAmount:       11,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// списания не было
+	respAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: writeOffID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), respAccount.Account.Balance)
+}
@@ -18,14 +18,14 @@ func Test_AccountWithdraw_HappyPath(t *testing.T) {
 	balance := int64(250)
 	withdrawAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountWithdraw := &bank_v1.AccountWithdrawRequest{Jwt: validJWT, AccountId: respCreateAccount.AccountId, WithdrawAmount: withdrawAmount}
+	reqAccountWithdraw := &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, WithdrawAmount: withdrawAmount}
 	respAccountWithdraw, err := st.BankClient.AccountWithdraw(ctx, reqAccountWithdraw)
 	require.NoError(t, err)
 
@@ -40,18 +40,18 @@ func Test_AccountWithdraw_LockedAccount(t *testing.T) {
 	balance := int64(250)
 	withdrawAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateAccount.AccountId}
+	reqAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqAccountLock)
 	require.NoError(t, err)
 
-	reqAccountWithdraw := &bank_v1.AccountWithdrawRequest{Jwt: validJWT, AccountId: respCreateAccount.AccountId, WithdrawAmount: withdrawAmount}
+	reqAccountWithdraw := &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, WithdrawAmount: withdrawAmount}
 	_, err = st.BankClient.AccountWithdraw(ctx, reqAccountWithdraw)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "account is locked")
@@ -65,7 +65,7 @@ func Test_AccountWithdraw_FailCases(t *testing.T) {
 	balance := int64(500)
 	withdrawAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
@@ -88,42 +88,42 @@ func Test_AccountWithdraw_FailCases(t *testing.T) {
 		},
 		{
 			name:        "nonexistent account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(10000000),
 			amount:      withdrawAmount,
 			expectedErr: "account id does not exist",
 		},
 		{
 			name:        "empty account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(0),
 			amount:      withdrawAmount,
 			expectedErr: "incorrect or empty account id",
 		},
 		{
 			name:        "negative account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(-1),
 			amount:      withdrawAmount,
 			expectedErr: "incorrect or empty account id",
 		},
 		{
 			name:        "empty amount",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   respCreateAccount.AccountId,
 			amount:      int64(0),
 			expectedErr: "incorrect or empty amount",
 		},
 		{
 			name:        "negative amount",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   respCreateAccount.AccountId,
 			amount:      int64(-15),
 			expectedErr: "incorrect or empty amount",
 		},
 		{
 			name:        "too much amount",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   respCreateAccount.AccountId,
 			amount:      balance + withdrawAmount,
 			expectedErr: "not enough money",
@@ -3,11 +3,14 @@ package tests
 import (
 	bank_v1 "bank_service/api/gen/bank"
 	"bank_service/tests/suite"
+	"math"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func Test_AccountTopUp_HappyPath(t *testing.T) {
@@ -18,14 +21,14 @@ func Test_AccountTopUp_HappyPath(t *testing.T) {
 	balance := int64(250)
 	topUpAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountTopUp := &bank_v1.AccountTopUpRequest{Jwt: validJWT, AccountId: respCreateAccount.AccountId, TopUpAmount: topUpAmount}
+	reqAccountTopUp := &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, TopUpAmount: topUpAmount}
 	respAccountTopUp, err := st.BankClient.AccountTopUp(ctx, reqAccountTopUp)
 	require.NoError(t, err)
 
@@ -40,18 +43,18 @@ func Test_AccountTopUp_LockedAccount(t *testing.T) {
 	balance := int64(500)
 	topUpAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
 	assert.NotEmpty(t, respCreateAccount.AccountId)
 	assert.Equal(t, respCreateAccount.Balance, balance)
 
-	reqAccountLock := &bank_v1.AccountLockRequest{AccountId: respCreateAccount.AccountId}
+	reqAccountLock := &bank_v1.AccountLockRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, ReasonCode: "customer_request"}
 	_, err = st.BankClient.AccountLock(ctx, reqAccountLock)
 	require.NoError(t, err)
 
-	reqAccountTopUp := &bank_v1.AccountTopUpRequest{Jwt: validJWT, AccountId: respCreateAccount.AccountId, TopUpAmount: topUpAmount}
+	reqAccountTopUp := &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: respCreateAccount.AccountId, TopUpAmount: topUpAmount}
 	_, err = st.BankClient.AccountTopUp(ctx, reqAccountTopUp)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "account is locked")
@@ -65,7 +68,7 @@ func Test_AccountTopUp_FailCases(t *testing.T) {
 	balance := int64(500)
 	topUpAmount := int64(50)
 
-	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: validJWT, FullName: fullName, Citizenship: citizenship, Balance: balance}
+	reqCreateAccount := &bank_v1.CreateAccountRequest{Jwt: st.Jwt, FullName: fullName, Citizenship: citizenship, Balance: balance}
 	respCreateAccount, err := st.BankClient.CreateAccount(ctx, reqCreateAccount)
 	require.NoError(t, err)
 
@@ -88,35 +91,35 @@ func Test_AccountTopUp_FailCases(t *testing.T) {
 		},
 		{
 			name:        "nonexistent account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(1000000),
 			amount:      topUpAmount,
 			expectedErr: "account id does not exist",
 		},
 		{
 			name:        "empty account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(0),
 			amount:      topUpAmount,
 			expectedErr: "incorrect or empty account id",
 		},
 		{
 			name:        "negative account id",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   int64(-1),
 			amount:      topUpAmount,
 			expectedErr: "incorrect or empty account id",
 		},
 		{
 			name:        "empty amount",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   respCreateAccount.AccountId,
 			amount:      int64(0),
 			expectedErr: "incorrect or empty amount",
 		},
 		{
 			name:        "negative amount",
-			jwt:         validJWT,
+			jwt:         st.Jwt,
 			accountID:   respCreateAccount.AccountId,
 			amount:      int64(-15),
 			expectedErr: "incorrect or empty amount",
@@ -135,3 +138,18 @@ func Test_AccountTopUp_FailCases(t *testing.T) {
 		})
 	}
 }
+
+func Test_AccountTopUp_Overflow(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, math.MaxInt64-10)
+
+	_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 11})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// до предела баланс пополняется
+	resp, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), resp.Balance)
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/internal/domain/models/money"
+	"bank_service/tests/suite"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Fx_CrossCurrencyTransfer(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// курсы общие для всех тестов, поэтому у каждого теста свои валюты
+	base, quote := randomCurrency(), randomCurrency()
+	for quote == base {
+		quote = randomCurrency()
+	}
+
+	adminJwt := st.NewAdminToken(ctx, st.Cfg.FX.AdminScope)
+	_, err := st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: adminJwt, Base: base, Quote: quote, Rate: "1.5"})
+	require.NoError(t, err)
+
+	writeOffID := createCurrencyAccount(ctx, t, st, base, 1000)
+	beneficiaryID := createCurrencyAccount(ctx, t, st, quote, 0)
+
+	// 101 * 1.5 = 151.5, по умолчанию округление half_even
+	resp, err := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    writeOffID,
+		BeneficiaryAccountId: beneficiaryID,
+		TransferAmount:       101,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(899), resp.WriteOffAccountBalance)
+	assert.Equal(t, int64(152), resp.BeneficiaryAccountBalance)
+
+	respIncoming, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: beneficiaryID})
+	require.NoError(t, err)
+	require.Len(t, respIncoming.Transactions, 1)
+	assert.True(t, respIncoming.Transactions[0].Incoming)
+	assert.Equal(t, int64(152), respIncoming.Transactions[0].Amount)
+	assert.Equal(t, int64(101), respIncoming.Transactions[0].CounterpartyAmount)
+	assert.Equal(t, "1.5", respIncoming.Transactions[0].FxRate)
+
+	respOutgoing, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: writeOffID})
+	require.NoError(t, err)
+	require.Len(t, respOutgoing.Transactions, 1)
+	assert.Equal(t, int64(101), respOutgoing.Transactions[0].Amount)
+	assert.Equal(t, int64(152), respOutgoing.Transactions[0].CounterpartyAmount)
+
+	// обратного курса нет, берется 1/1.5
+	resp, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    beneficiaryID,
+		BeneficiaryAccountId: writeOffID,
+		TransferAmount:       3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(149), resp.WriteOffAccountBalance)
+	assert.Equal(t, int64(901), resp.BeneficiaryAccountBalance)
+
+	respAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: beneficiaryID})
+	require.NoError(t, err)
+	assert.Equal(t, quote, respAccount.Account.Currency)
+}
+
+func Test_Fx_MinorUnits(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminJwt := st.NewAdminToken(ctx, st.Cfg.FX.AdminScope)
+
+	tests := []struct {
+		name            string
+		base            string
+		quote           string
+		rate            string
+		amount          int64
+		wantBeneficiary int64
+	}{
+		// 100.00 USD * 150 = 15000 JPY, у иены нет дробных единиц
+		{name: "USD to JPY", base: "USD", quote: "JPY", rate: "150", amount: 10000, wantBeneficiary: 15000},
+		// 1.234 KWD * 3.25 = 4.0105 USD, у динара три знака
+		{name: "KWD to USD", base: "KWD", quote: "USD", rate: "3.25", amount: 1234, wantBeneficiary: 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: adminJwt, Base: tt.base, Quote: tt.quote, Rate: tt.rate})
+			require.NoError(t, err)
+
+			writeOffID := createCurrencyAccount(ctx, t, st, tt.base, 100000)
+			beneficiaryID := createCurrencyAccount(ctx, t, st, tt.quote, 0)
+
+			resp, err := st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+				Jwt:                  st.Jwt,
+				WriteOffAccountId:    writeOffID,
+				BeneficiaryAccountId: beneficiaryID,
+				TransferAmount:       tt.amount,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 100000-tt.amount, resp.WriteOffAccountBalance)
+			assert.Equal(t, tt.wantBeneficiary, resp.BeneficiaryAccountBalance)
+		})
+	}
+}
+
+func Test_Fx_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	base, quote := randomCurrency(), randomCurrency()
+	for quote == base {
+		quote = randomCurrency()
+	}
+
+	// валюта по умолчанию
+	respCreate, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.Jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, st.Cfg.FX.DefaultCurrency, respCreate.Currency)
+
+	_, err = st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.Jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Currency:    "usd",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// курса между валютами нет
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    createCurrencyAccount(ctx, t, st, base, 100),
+		BeneficiaryAccountId: createCurrencyAccount(ctx, t, st, quote, 0),
+		TransferAmount:       10,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// токен без scope администратора курсов
+	_, err = st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: st.Jwt, Base: base, Quote: quote, Rate: "2"})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// и получить его себе нельзя: auth выдает этот scope только администраторам
+	email, pass := st.RegisterUser(ctx)
+	_, err = st.AuthClient.Login(ctx, st.LoginRequest(email, pass, st.Cfg.FX.AdminScope))
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	adminJwt := st.NewAdminToken(ctx, st.Cfg.FX.AdminScope)
+
+	tests := []struct {
+		name  string
+		base  string
+		quote string
+		rate  string
+	}{
+		{name: "Lower case currency", base: strings.ToLower(base), quote: quote, rate: "2"},
+		{name: "Same currencies", base: base, quote: base, rate: "2"},
+		{name: "Zero rate", base: base, quote: quote, rate: "0"},
+		{name: "Negative rate", base: base, quote: quote, rate: "-2"},
+		{name: "Exponent", base: base, quote: quote, rate: "2e3"},
+		{name: "Too precise", base: base, quote: quote, rate: "0.0000000000001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: adminJwt, Base: tt.base, Quote: tt.quote, Rate: tt.rate})
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+
+	// сумма меньше единицы валюты получателя
+	_, err = st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: adminJwt, Base: base, Quote: quote, Rate: "0.01"})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    createCurrencyAccount(ctx, t, st, base, 100),
+		BeneficiaryAccountId: createCurrencyAccount(ctx, t, st, quote, 0),
+		TransferAmount:       10,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func createCurrencyAccount(ctx context.Context, t *testing.T, st *suite.Suite, currency string, balance int64) int64 {
+	t.Helper()
+
+	resp, err := st.BankClient.CreateAccount(ctx, &bank_v1.CreateAccountRequest{
+		Jwt:         st.Jwt,
+		FullName:    gofakeit.FirstName() + " " + gofakeit.MiddleName() + " " + gofakeit.LastName(),
+		Citizenship: gofakeit.Country(),
+		Balance:     balance,
+		Currency:    currency,
+	})
+	require.NoError(t, err)
+	require.Equal(t, currency, resp.Currency)
+
+	return resp.AccountId
+}
+
+// A code with two digits of minor units, the amounts of the tests with random currencies
+// are not scaled
+func randomCurrency() string {
+	for {
+		currency := strings.ToUpper(gofakeit.LetterN(3))
+		if money.Exponent(currency) == 2 {
+			return currency
+		}
+	}
+}
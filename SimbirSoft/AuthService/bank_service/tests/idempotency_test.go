@@ -0,0 +1,168 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Idempotency_Replay(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 1000)
+	beneficiaryID := createAccount(ctx, t, st, st.Jwt, 0)
+
+	topUp := &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100, IdempotencyKey: gofakeit.UUID()}
+	withdraw := &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 300, IdempotencyKey: gofakeit.UUID()}
+	transfer := &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    accountID,
+		BeneficiaryAccountId: beneficiaryID,
+		TransferAmount:       50,
+		IdempotencyKey:       gofakeit.UUID(),
+	}
+
+	// повтор возвращает первый ответ, а не баланс после второго раза
+	for i := 0; i < 2; i++ {
+		respTopUp, err := st.BankClient.AccountTopUp(ctx, topUp)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1100), respTopUp.Balance)
+
+		respWithdraw, err := st.BankClient.AccountWithdraw(ctx, withdraw)
+		require.NoError(t, err)
+		assert.Equal(t, int64(800), respWithdraw.Balance)
+
+		respTransfer, err := st.BankClient.AccountTransfer(ctx, transfer)
+		require.NoError(t, err)
+		assert.Equal(t, int64(750), respTransfer.WriteOffAccountBalance)
+		assert.Equal(t, int64(50), respTransfer.BeneficiaryAccountBalance)
+	}
+
+	respAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(750), respAccount.Account.Balance)
+
+	respTransactions, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	assert.Len(t, respTransactions.Transactions, 3)
+
+	// ключи у каждого пользователя свои
+	otherJwt := st.NewUserToken(ctx)
+	otherAccountID := createAccount(ctx, t, st, otherJwt, 0)
+
+	respOther, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{
+		Jwt:            otherJwt,
+		AccountId:      otherAccountID,
+		TopUpAmount:    100,
+		IdempotencyKey: topUp.IdempotencyKey,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), respOther.Balance)
+}
+
+func Test_Idempotency_ConcurrentRetries(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 0)
+	req := &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100, IdempotencyKey: gofakeit.UUID()}
+
+	const retries = 5
+
+	var wg sync.WaitGroup
+	balances := make([]int64, retries)
+	errs := make([]error, retries)
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			resp, err := st.BankClient.AccountTopUp(ctx, req)
+			balances[i], errs[i] = resp.GetBalance(), err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < retries; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, int64(100), balances[i])
+	}
+
+	respAccount, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), respAccount.Account.Balance)
+}
+
+func Test_Idempotency_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, 1000)
+	key := gofakeit.UUID()
+
+	_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100, IdempotencyKey: key})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{
+			name: "Same key, other amount",
+			call: func() error {
+				_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 200, IdempotencyKey: key})
+				return err
+			},
+			code: codes.FailedPrecondition,
+		},
+		{
+			name: "Same key, other operation",
+			call: func() error {
+				_, err := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 100, IdempotencyKey: key})
+				return err
+			},
+			code: codes.FailedPrecondition,
+		},
+		{
+			name: "Too long key",
+			call: func() error {
+				_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{
+					Jwt:            st.Jwt,
+					AccountId:      accountID,
+					TopUpAmount:    100,
+					IdempotencyKey: strings.Repeat("k", 256),
+				})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	// неуспешная операция ключ не занимает
+	failedKey := gofakeit.UUID()
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 5000, IdempotencyKey: failedKey})
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 5000, IdempotencyKey: gofakeit.UUID()})
+	require.NoError(t, err)
+
+	respWithdraw, err := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 5000, IdempotencyKey: failedKey})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1100), respWithdraw.Balance)
+}
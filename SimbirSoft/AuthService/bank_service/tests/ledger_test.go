@@ -0,0 +1,87 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Ledger_BalancesReconcile(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	base, quote := randomCurrency(), randomCurrency()
+	for quote == base {
+		quote = randomCurrency()
+	}
+
+	adminJwt := st.NewAdminToken(ctx, st.Cfg.FX.AdminScope)
+	_, err := st.BankClient.SetFxRate(ctx, &bank_v1.SetFxRateRequest{Jwt: adminJwt, Base: base, Quote: quote, Rate: "2"})
+	require.NoError(t, err)
+
+	const opening = 1000
+	firstID := createCurrencyAccount(ctx, t, st, base, opening)
+	secondID := createCurrencyAccount(ctx, t, st, base, opening)
+	foreignID := createCurrencyAccount(ctx, t, st, quote, opening)
+
+	_, err = st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: firstID, TopUpAmount: 150})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: secondID, WithdrawAmount: 70})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    firstID,
+		BeneficiaryAccountId: secondID,
+		TransferAmount:       300,
+	})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  st.Jwt,
+		WriteOffAccountId:    secondID,
+		BeneficiaryAccountId: foreignID,
+		TransferAmount:       50,
+	})
+	require.NoError(t, err)
+
+	// отклоненная операция не оставляет движений
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: firstID, WithdrawAmount: 100000})
+	require.Error(t, err)
+
+	// перевод в одной валюте не меняет сумму балансов, пополнение и снятие меняют ее на свою сумму
+	first, second := accountBalance(ctx, t, st, firstID), accountBalance(ctx, t, st, secondID)
+	assert.Equal(t, int64(850), first)
+	assert.Equal(t, int64(1180), second)
+	assert.Equal(t, int64(2*opening+150-70-50), first+second)
+	assert.Equal(t, int64(opening+100), accountBalance(ctx, t, st, foreignID))
+
+	// баланс каждого счета - начальный баланс и сумма его операций
+	for _, id := range []int64{firstID, secondID, foreignID} {
+		resp, err := st.BankClient.ListTransactions(ctx, &bank_v1.ListTransactionsRequest{Jwt: st.Jwt, AccountId: id})
+		require.NoError(t, err)
+
+		balance := int64(opening)
+		for _, tr := range resp.GetTransactions() {
+			if tr.GetIncoming() {
+				balance += tr.GetAmount()
+			} else {
+				balance -= tr.GetAmount()
+			}
+		}
+		assert.Equal(t, balance, accountBalance(ctx, t, st, id))
+	}
+}
+
+func accountBalance(ctx context.Context, t *testing.T, st *suite.Suite, accountID int64) int64 {
+	t.Helper()
+
+	resp, err := st.BankClient.GetAccount(ctx, &bank_v1.GetAccountRequest{Jwt: st.Jwt, AccountId: accountID})
+	require.NoError(t, err)
+
+	return resp.GetAccount().GetBalance()
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	bank_v1 "bank_service/api/gen/bank"
+	"bank_service/tests/suite"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_GenerateStatement_CSV(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	from := time.Now().Add(-time.Minute)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(1000))
+
+	strangerJWT := st.NewUserToken(ctx)
+	strangerAccountID := createAccount(ctx, t, st, strangerJWT, int64(1000))
+
+	_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 300})
+	require.NoError(t, err)
+
+	_, err = st.BankClient.AccountTransfer(ctx, &bank_v1.AccountTransferRequest{
+		Jwt:                  strangerJWT,
+		WriteOffAccountId:    strangerAccountID,
+		BeneficiaryAccountId: accountID,
+		TransferAmount:       50,
+	})
+	require.NoError(t, err)
+
+	data, err := generateStatement(ctx, st, &bank_v1.GenerateStatementRequest{
+		Jwt:       st.Jwt,
+		AccountId: accountID,
+		From:      from.Unix(),
+		To:        time.Now().Add(time.Minute).Unix(),
+		Format:    "csv",
+	})
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6) // columns, opening, 3 entries, closing
+
+	assert.Equal(t, []string{"date", "transaction_id", "type", "counterparty_account_id", "amount", "balance"}, rows[0])
+	assert.Equal(t, "OpeningBalance", rows[1][2])
+	// суммы в копейках, в выписке в рублях
+	assert.Equal(t, "10.00", rows[1][5])
+
+	assert.Equal(t, []string{"TopUp", "", "1.00", "11.00"}, rows[2][2:])
+	assert.Equal(t, []string{"Withdraw", "", "-3.00", "8.00"}, rows[3][2:])
+	assert.Equal(t, []string{"Transfer", strconv.FormatInt(strangerAccountID, 10), "0.50", "8.50"}, rows[4][2:])
+
+	assert.Equal(t, "ClosingBalance", rows[5][2])
+	assert.Equal(t, "8.50", rows[5][5])
+}
+
+func Test_GenerateStatement_XML(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	from := time.Now().Add(-time.Minute)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(500))
+
+	_, err := st.BankClient.AccountWithdraw(ctx, &bank_v1.AccountWithdrawRequest{Jwt: st.Jwt, AccountId: accountID, WithdrawAmount: 200})
+	require.NoError(t, err)
+
+	data, err := generateStatement(ctx, st, &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, From: from.Unix(), Format: "camt053"})
+	require.NoError(t, err)
+
+	var camt struct {
+		Balances []struct {
+			Code   string `xml:"Tp>CdOrPrtry>Cd"`
+			Amount string `xml:"Amt"`
+			CdtDbt string `xml:"CdtDbtInd"`
+		} `xml:"BkToCstmrStmt>Stmt>Bal"`
+		Entries []struct {
+			Amount string `xml:"Amt"`
+			CdtDbt string `xml:"CdtDbtInd"`
+		} `xml:"BkToCstmrStmt>Stmt>Ntry"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &camt))
+
+	require.Len(t, camt.Balances, 2)
+	assert.Equal(t, "OPBD", camt.Balances[0].Code)
+	assert.Equal(t, "5.00", camt.Balances[0].Amount)
+	assert.Equal(t, "CLBD", camt.Balances[1].Code)
+	assert.Equal(t, "3.00", camt.Balances[1].Amount)
+
+	require.Len(t, camt.Entries, 1)
+	assert.Equal(t, "2.00", camt.Entries[0].Amount)
+	assert.Equal(t, "DBIT", camt.Entries[0].CdtDbt)
+
+	data, err = generateStatement(ctx, st, &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, From: from.Unix(), Format: "ofx"})
+	require.NoError(t, err)
+
+	var ofx struct {
+		Transactions []struct {
+			Amount string `xml:"TRNAMT"`
+		} `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS>BANKTRANLIST>STMTTRN"`
+		Balance string `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS>LEDGERBAL>BALAMT"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &ofx))
+
+	require.Len(t, ofx.Transactions, 1)
+	assert.Equal(t, "-2.00", ofx.Transactions[0].Amount)
+	assert.Equal(t, "3.00", ofx.Balance)
+}
+
+func Test_GenerateStatement_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(100))
+	from := time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		name string
+		req  *bank_v1.GenerateStatementRequest
+		code codes.Code
+	}{
+		{
+			name: "invalid jwt",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: invalidJWT, AccountId: accountID, From: from, Format: "csv"},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "account of another user",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: st.NewUserToken(ctx), AccountId: accountID, From: from, Format: "csv"},
+			code: codes.PermissionDenied,
+		},
+		{
+			name: "unknown format",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, From: from, Format: "pdf"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "empty period",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, From: from, To: from, Format: "csv"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "no start",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, Format: "csv"},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "period over a year",
+			req:  &bank_v1.GenerateStatementRequest{Jwt: st.Jwt, AccountId: accountID, From: 1, Format: "csv"},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generateStatement(ctx, st, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func Test_GenerateStatement_Unreconciled(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	from := time.Now().Add(-time.Minute)
+
+	accountID := createAccount(ctx, t, st, st.Jwt, int64(1000))
+
+	_, err := st.BankClient.AccountTopUp(ctx, &bank_v1.AccountTopUpRequest{Jwt: st.Jwt, AccountId: accountID, TopUpAmount: 100})
+	require.NoError(t, err)
+
+	// операция в журнале без проводок: балансы выписки берутся из проводок, поэтому она не сходится
+	st.ExecStorage(ctx, `INSERT INTO transaction(account_id, transaction_type, amount, date) VALUES ($1, '1', 20, CURRENT_TIMESTAMP)`,
+		accountID)
+
+	stream, err := st.BankClient.GenerateStatement(ctx, &bank_v1.GenerateStatementRequest{
+		Jwt:       st.Jwt,
+		AccountId: accountID,
+		From:      from.Unix(),
+		To:        time.Now().Add(time.Minute).Unix(),
+		Format:    "csv",
+	})
+	require.NoError(t, err)
+
+	// ни одной части выписки до ошибки
+	_, err = stream.Recv()
+	require.Error(t, err)
+	assert.Equal(t, codes.DataLoss, status.Code(err))
+}
+
+func generateStatement(ctx context.Context, st *suite.Suite, req *bank_v1.GenerateStatementRequest) ([]byte, error) {
+	stream, err := st.BankClient.GenerateStatement(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, chunk.GetData()...)
+	}
+}
@@ -4,16 +4,29 @@ import (
 	bank_v1 "bank_service/api/gen/bank"
 	"bank_service/internal/config"
 	"context"
+	"database/sql"
+	"os"
 	"testing"
 
+	"github.com/brianvoe/gofakeit/v6"
+	_ "github.com/lib/pq"
+	auth_v1 "gitlab.simbirsoft/verify/m.zemtsov/auth/api/gen"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+const passDefaultLen = 12
+
+// storage_path of auth/configs/local.yaml
+const authStorageDefault = "postgres://myUser:12345@db:5432/myDb?sslmode=disable"
+
 type Suite struct {
 	*testing.T
 	Cfg        *config.Config
 	BankClient bank_v1.BankClient
+	AuthClient auth_v1.AuthClient
+	// Token of the user the test acts as, accounts created with it belong to this user
+	Jwt string
 }
 
 func New(t *testing.T) (context.Context, *Suite) {
@@ -31,8 +44,107 @@ func New(t *testing.T) (context.Context, *Suite) {
 
 	cc, err := grpc.NewClient(cfg.MyGRPC.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		t.Fatalf("can't make client connection", err)
+		t.Fatalf("can't make client connection: %v", err)
+	}
+
+	authCC, err := grpc.NewClient(cfg.Auth.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("can't make auth client connection: %v", err)
+	}
+
+	st := &Suite{T: t, Cfg: cfg, BankClient: bank_v1.NewBankClient(cc), AuthClient: auth_v1.NewAuthClient(authCC)}
+	st.Jwt = st.NewUserToken(ctx)
+
+	return ctx, st
+}
+
+// ExecStorage runs the query on the bank database directly, e.g. to break what the gRPC API keeps consistent
+func (s *Suite) ExecStorage(ctx context.Context, query string, args ...any) {
+	s.Helper()
+
+	db, err := sql.Open(s.Cfg.Storage.Driver, s.Cfg.Storage.Info)
+	if err != nil {
+		s.Fatalf("can't open storage: %v", err)
 	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		s.Fatalf("can't exec %q: %v", query, err)
+	}
+}
+
+// NewUserToken registers a new user in auth and returns its token accepted by bank_service
+func (s *Suite) NewUserToken(ctx context.Context) string {
+	s.Helper()
+
+	email, pass := s.RegisterUser(ctx)
+
+	resp, err := s.AuthClient.Login(ctx, s.LoginRequest(email, pass, ""))
+	if err != nil {
+		s.Fatalf("can't login: %v", err)
+	}
+
+	return resp.GetToken()
+}
+
+// NewAdminToken is NewUserToken of a bank employee: auth grants the admin only scope,
+// e.g. the fx admin scope, only to admins of the realm, so the user is made one first
+func (s *Suite) NewAdminToken(ctx context.Context, scope string) string {
+	s.Helper()
+
+	email, pass := s.RegisterUser(ctx)
+	s.GrantAuthAdmin(ctx, email)
 
-	return ctx, &Suite{T: t, Cfg: cfg, BankClient: bank_v1.NewBankClient(cc)}
+	resp, err := s.AuthClient.Login(ctx, s.LoginRequest(email, pass, scope))
+	if err != nil {
+		s.Fatalf("can't login: %v", err)
+	}
+
+	return resp.GetToken()
+}
+
+// RegisterUser registers a new user in auth and returns its email and password
+func (s *Suite) RegisterUser(ctx context.Context) (string, string) {
+	s.Helper()
+
+	email := gofakeit.Email()
+	pass := gofakeit.Password(true, true, true, true, false, passDefaultLen)
+
+	_, err := s.AuthClient.Register(ctx, &auth_v1.RegisterRequest{Email: email, Password: pass, Realm: s.Cfg.Auth.Realm})
+	if err != nil {
+		s.Fatalf("can't register user: %v", err)
+	}
+
+	return email, pass
+}
+
+// LoginRequest asks auth for a token accepted by bank_service, limited to the scope if it is not empty
+func (s *Suite) LoginRequest(email, pass, scope string) *auth_v1.LoginRequest {
+	req := &auth_v1.LoginRequest{Email: email, Password: pass, Realm: s.Cfg.Auth.Realm, AppId: s.Cfg.Auth.AppID, Scope: scope}
+	if s.Cfg.Auth.Audience != "" {
+		req.Audience = []string{s.Cfg.Auth.Audience}
+	}
+
+	return req
+}
+
+// GrantAuthAdmin gives the user the admin role directly in the auth database, as userctl grant-admin does,
+// the gRPC API of auth has no way to do it. The database is AUTH_STORAGE_PATH or the one of the auth local config
+func (s *Suite) GrantAuthAdmin(ctx context.Context, email string) {
+	s.Helper()
+
+	storagePath := os.Getenv("AUTH_STORAGE_PATH")
+	if storagePath == "" {
+		storagePath = authStorageDefault
+	}
+
+	db, err := sql.Open("postgres", storagePath)
+	if err != nil {
+		s.Fatalf("can't open auth storage: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET is_admin = TRUE WHERE email = $1", email); err != nil {
+		s.Fatalf("can't grant admin to %s: %v", email, err)
+	}
 }